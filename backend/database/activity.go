@@ -0,0 +1,436 @@
+package database
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/thompsonmanda08/task-sync/models"
+	"gorm.io/gorm"
+)
+
+// The group activity feeds are derived from the change history: RecordGroupActivity
+// listens to the change records of every statement and turns those of resources that
+// belong to a group into activities. Changes outside of groups are not reported.
+
+// resourceChange gathers the change records a statement made to one resource
+type resourceChange struct {
+	id      string
+	actorID *string
+	action  string                         // create, delete, restore or purge, empty if only fields changed
+	updates map[string]models.ChangeRecord // Field updates by field
+}
+
+// changed reports whether a field was updated
+func (change resourceChange) changed(field string) bool {
+	_, ok := change.updates[field]
+	return ok
+}
+
+// values returns the decoded values of a field before and after its update
+func (change resourceChange) values(field string) (interface{}, interface{}) {
+	var oldValue, newValue interface{}
+	if record, ok := change.updates[field]; ok {
+		if record.OldValue != nil {
+			json.Unmarshal([]byte(*record.OldValue), &oldValue)
+		}
+		if record.NewValue != nil {
+			json.Unmarshal([]byte(*record.NewValue), &newValue)
+		}
+	}
+	return oldValue, newValue
+}
+
+// updatedFields returns the updated fields, in the order of the audited columns
+func (change resourceChange) updatedFields(resourceType string) []string {
+	fields := []string{}
+	for _, table := range auditedTables {
+		if table.resource != resourceType {
+			continue
+		}
+		for _, field := range table.fields {
+			if change.changed(field) {
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields
+}
+
+// listContext is a todo list as needed to describe its activity
+type listContext struct {
+	ID        string
+	Name      string
+	GroupID   *string
+	DeletedAt *time.Time
+}
+
+// memberContext is a group membership as needed to describe its activity
+type memberContext struct {
+	ID             string
+	UserID         string
+	UserName       string
+	GroupID        string
+	RoleID         string
+	RoleName       string
+	ExistingMember bool // The user held another role in the group already
+}
+
+// RecordGroupActivity is a change listener writing the activities of the changes made to
+// groups, their memberships, their todo lists and the todos of those lists, and their
+// deliveries to the webhooks of the groups
+func RecordGroupActivity(tx *gorm.DB, records []models.ChangeRecord) error {
+	changes := groupChangeRecords(records)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	var activities []models.Activity
+	var err error
+
+	switch records[0].ResourceType {
+	case "todo":
+		activities, err = todoActivities(tx, changes)
+	case "todo_list":
+		activities, err = todoListActivities(tx, changes)
+	case "group":
+		activities = groupActivities(changes)
+	case "group_member":
+		activities, err = memberActivities(tx, changes)
+	}
+
+	if err != nil || len(activities) == 0 {
+		return err
+	}
+
+	if err := tx.CreateInBatches(&activities, 500).Error; err != nil {
+		return err
+	}
+
+	return enqueueWebhookDeliveries(tx, activities)
+}
+
+// groupChangeRecords gathers the change records by resource, in the order they were made
+func groupChangeRecords(records []models.ChangeRecord) []resourceChange {
+	changes := []resourceChange{}
+	indexes := map[string]int{}
+
+	for _, record := range records {
+		index, ok := indexes[record.ResourceID]
+		if !ok {
+			index = len(changes)
+			indexes[record.ResourceID] = index
+			changes = append(changes, resourceChange{
+				id:      record.ResourceID,
+				actorID: record.ActorID,
+				updates: map[string]models.ChangeRecord{},
+			})
+		}
+
+		if record.Action == models.ChangeUpdate {
+			changes[index].updates[record.Field] = record
+		} else {
+			changes[index].action = record.Action
+		}
+	}
+
+	return changes
+}
+
+func newActivity(groupID string, activityType string, resourceType string, change resourceChange, data map[string]interface{}) models.Activity {
+	activity := models.Activity{
+		GroupID:      groupID,
+		Type:         activityType,
+		ActorID:      change.actorID,
+		ResourceType: resourceType,
+		ResourceID:   change.id,
+	}
+
+	if len(data) > 0 {
+		if encoded, err := json.Marshal(data); err == nil {
+			value := string(encoded)
+			activity.Data = &value
+		}
+	}
+
+	return activity
+}
+
+// findLists loads the todo lists with the given IDs, including those in the trash
+func findLists(tx *gorm.DB, ids []string) (map[string]listContext, error) {
+	var rows []listContext
+	if err := tx.Raw(`SELECT id, name, group_id, deleted_at FROM todo_lists WHERE id IN ?`, ids).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	lists := make(map[string]listContext, len(rows))
+	for _, row := range rows {
+		lists[row.ID] = row
+	}
+	return lists, nil
+}
+
+func todoActivities(tx *gorm.DB, changes []resourceChange) ([]models.Activity, error) {
+	ids := make([]string, 0, len(changes))
+	for _, change := range changes {
+		ids = append(ids, change.id)
+	}
+
+	var todos []struct {
+		ID         string
+		Task       string
+		TodoListID string
+	}
+	if err := tx.Raw(`SELECT id, task, todo_list_id FROM todos WHERE id IN ?`, ids).Scan(&todos).Error; err != nil {
+		return nil, err
+	}
+
+	// THE LISTS OF THE TODOS, AND THE LISTS MOVED TODOS COME FROM
+	listIDs := []string{}
+	for _, todo := range todos {
+		listIDs = append(listIDs, todo.TodoListID)
+	}
+	for _, change := range changes {
+		if from, ok := change.updates["todo_list_id"]; ok && from.OldValue != nil {
+			var fromID string
+			if json.Unmarshal([]byte(*from.OldValue), &fromID) == nil {
+				listIDs = append(listIDs, fromID)
+			}
+		}
+	}
+
+	lists, err := findLists(tx, listIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]int, len(todos))
+	for i, todo := range todos {
+		byID[todo.ID] = i
+	}
+
+	activities := []models.Activity{}
+	for _, change := range changes {
+		index, ok := byID[change.id]
+		if !ok {
+			continue // Purged
+		}
+		todo := todos[index]
+
+		// TODOS OF A LIST IN THE TRASH ARE REPORTED THROUGH THE LIST
+		list, ok := lists[todo.TodoListID]
+		if !ok || list.DeletedAt != nil {
+			continue
+		}
+
+		data := map[string]interface{}{"task": todo.Task, "list_id": list.ID, "list_name": list.Name}
+		add := func(groupID *string, activityType string) {
+			if groupID != nil {
+				activities = append(activities, newActivity(*groupID, activityType, "todo", change, data))
+			}
+		}
+
+		switch change.action {
+		case models.ChangeCreate:
+			add(list.GroupID, models.ActivityTaskCreated)
+			continue
+		case models.ChangeDelete:
+			add(list.GroupID, models.ActivityTaskDeleted)
+			continue
+		case models.ChangeRestore:
+			add(list.GroupID, models.ActivityTaskRestored)
+		}
+
+		if change.changed("todo_list_id") {
+			fromID, _ := change.values("todo_list_id")
+			fromListID, _ := fromID.(string)
+			from := lists[fromListID]
+			data["from_list_id"] = from.ID
+			data["from_list_name"] = from.Name
+
+			add(list.GroupID, models.ActivityTaskMoved)
+			if from.GroupID != nil && (list.GroupID == nil || *from.GroupID != *list.GroupID) {
+				add(from.GroupID, models.ActivityTaskMoved)
+			}
+		}
+
+		if change.changed("is_completed") {
+			if _, completed := change.values("is_completed"); completed == true {
+				add(list.GroupID, models.ActivityTaskCompleted)
+			} else {
+				add(list.GroupID, models.ActivityTaskReopened)
+			}
+		}
+
+		if change.changed("assignee_id") {
+			_, assigneeID := change.values("assignee_id")
+			data["assignee_id"] = assigneeID
+			add(list.GroupID, models.ActivityTaskAssigned)
+			delete(data, "assignee_id")
+		}
+
+		fields := []string{}
+		for _, field := range change.updatedFields("todo") {
+			if field != "todo_list_id" && field != "is_completed" && field != "assignee_id" {
+				fields = append(fields, field)
+			}
+		}
+		if len(fields) > 0 {
+			data["fields"] = fields
+			add(list.GroupID, models.ActivityTaskUpdated)
+		}
+	}
+
+	return activities, nil
+}
+
+func todoListActivities(tx *gorm.DB, changes []resourceChange) ([]models.Activity, error) {
+	ids := make([]string, 0, len(changes))
+	for _, change := range changes {
+		ids = append(ids, change.id)
+	}
+
+	lists, err := findLists(tx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	activities := []models.Activity{}
+	for _, change := range changes {
+		list, ok := lists[change.id]
+		if !ok {
+			continue // Purged
+		}
+
+		data := map[string]interface{}{"list_name": list.Name}
+		add := func(groupID *string, activityType string) {
+			if groupID != nil {
+				activities = append(activities, newActivity(*groupID, activityType, "todo_list", change, data))
+			}
+		}
+
+		switch change.action {
+		case models.ChangeCreate:
+			add(list.GroupID, models.ActivityListCreated)
+			continue
+		case models.ChangeDelete:
+			add(list.GroupID, models.ActivityListDeleted)
+			continue
+		case models.ChangeRestore:
+			add(list.GroupID, models.ActivityListRestored)
+		}
+
+		if change.changed("group_id") {
+			from, to := change.values("group_id")
+			if from, ok := from.(string); ok {
+				add(&from, models.ActivityListRemovedFromGroup)
+			}
+			if to, ok := to.(string); ok {
+				add(&to, models.ActivityListAddedToGroup)
+			}
+		}
+
+		if change.changed("name") {
+			oldName, _ := change.values("name")
+			data["old_name"] = oldName
+			add(list.GroupID, models.ActivityListRenamed)
+		}
+
+		fields := []string{}
+		for _, field := range change.updatedFields("todo_list") {
+			if field == "description" || field == "color" {
+				fields = append(fields, field)
+			}
+		}
+		if len(fields) > 0 {
+			data["fields"] = fields
+			add(list.GroupID, models.ActivityListUpdated)
+		}
+	}
+
+	return activities, nil
+}
+
+func groupActivities(changes []resourceChange) []models.Activity {
+	activities := []models.Activity{}
+	for _, change := range changes {
+		switch change.action {
+		case models.ChangeCreate:
+			activities = append(activities, newActivity(change.id, models.ActivityGroupCreated, "group", change, nil))
+		case models.ChangeDelete:
+			activities = append(activities, newActivity(change.id, models.ActivityGroupDeleted, "group", change, nil))
+		case "":
+			data := map[string]interface{}{"fields": change.updatedFields("group")}
+			if change.changed("name") {
+				oldName, newName := change.values("name")
+				data["old_name"] = oldName
+				data["name"] = newName
+			}
+			activities = append(activities, newActivity(change.id, models.ActivityGroupUpdated, "group", change, data))
+		}
+	}
+	return activities
+}
+
+func memberActivities(tx *gorm.DB, changes []resourceChange) ([]models.Activity, error) {
+	ids := make([]string, 0, len(changes))
+	for _, change := range changes {
+		ids = append(ids, change.id)
+	}
+
+	var rows []memberContext
+	if err := tx.Raw(`
+		SELECT mapping.id, mapping.user_id, users.name AS user_name, mapping.group_id, mapping.role_id, roles.name AS role_name,
+			EXISTS (
+				SELECT 1 FROM user_group_role_mappings other
+				WHERE other.user_id = mapping.user_id AND other.group_id = mapping.group_id
+					AND other.id <> mapping.id AND other.deleted_at IS NULL
+			) AS existing_member
+		FROM user_group_role_mappings mapping
+		LEFT JOIN users ON users.id = mapping.user_id
+		LEFT JOIN roles ON roles.id = mapping.role_id
+		WHERE mapping.id IN ?`, ids).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	members := make(map[string]memberContext, len(rows))
+	for _, row := range rows {
+		members[row.ID] = row
+	}
+
+	activities := []models.Activity{}
+	for _, change := range changes {
+		member, ok := members[change.id]
+		if !ok || member.GroupID == "" {
+			continue // Purged
+		}
+
+		data := map[string]interface{}{
+			"user_id":   member.UserID,
+			"user_name": member.UserName,
+			"role_id":   member.RoleID,
+			"role_name": member.RoleName,
+		}
+		add := func(activityType string) {
+			activities = append(activities, newActivity(member.GroupID, activityType, "group_member", change, data))
+		}
+
+		switch {
+		case change.action == models.ChangeCreate && member.ExistingMember:
+			add(models.ActivityRoleChanged)
+		case change.action == models.ChangeCreate || change.action == models.ChangeRestore:
+			add(models.ActivityMemberJoined)
+		case change.action == models.ChangeDelete && member.ExistingMember:
+			add(models.ActivityRoleChanged)
+		case change.action == models.ChangeDelete && change.actorID != nil && *change.actorID == member.UserID:
+			add(models.ActivityMemberLeft)
+		case change.action == models.ChangeDelete:
+			add(models.ActivityMemberRemoved)
+		case change.changed("role_id"):
+			oldRoleID, _ := change.values("role_id")
+			data["old_role_id"] = oldRoleID
+			add(models.ActivityRoleChanged)
+		}
+	}
+
+	return activities, nil
+}
@@ -0,0 +1,335 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/thompsonmanda08/task-sync/merge"
+	"github.com/thompsonmanda08/task-sync/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// The audit callbacks record the history of todos, todo lists, groups and group
+// memberships centrally, for every create, update and delete made through GORM. Updates
+// and deletes snapshot the matched rows before the statement runs and compare them with
+// the rows afterwards, so bulk updates are captured too. The records are written in the
+// statement's transaction.
+
+const (
+	actorKey = "audit:actor_id"
+	clockKey = "audit:clock"
+)
+
+// auditedTable describes the history kept for a table: its resource type and the
+// columns whose changes are recorded
+type auditedTable struct {
+	resource string
+	fields   []string
+}
+
+var auditedTables = map[string]auditedTable{
+	"todos": {
+		resource: "todo",
+		fields:   []string{"task", "description", "is_completed", "start_date", "end_date", "all_day", "priority", "todo_list_id", "parent_id", "assignee_id"},
+	},
+	"todo_lists": {
+		resource: "todo_list",
+		fields:   []string{"name", "description", "color", "group_id", "owner_id"},
+	},
+	"groups": {
+		resource: "group",
+		fields:   []string{"name", "description", "owner_id"},
+	},
+	"user_group_role_mappings": {
+		resource: "group_member",
+		fields:   []string{"user_id", "group_id", "role_id"},
+	},
+}
+
+// A ChangeListener is called with the change records of every audited statement, after
+// they are written and in the statement's transaction. Returning an error fails the
+// statement.
+type ChangeListener func(tx *gorm.DB, records []models.ChangeRecord) error
+
+var changeListeners []ChangeListener
+
+// OnChange registers a change listener. Listeners must be registered at startup, before
+// the database is used.
+func OnChange(listener ChangeListener) {
+	changeListeners = append(changeListeners, listener)
+}
+
+// WithActor returns a database handle that attributes the changes made through it to a
+// user in the change history
+func WithActor(db *gorm.DB, actorID string) *gorm.DB {
+	return db.Set(actorKey, actorID).Session(&gorm.Session{})
+}
+
+// WithClock returns a database handle that records the changes made through it at a
+// hybrid logical clock timestamp, the client's for edits it made offline. Changes are
+// otherwise recorded at a timestamp of the server's clock.
+func WithClock(db *gorm.DB, clock merge.Timestamp) *gorm.DB {
+	return db.Set(clockKey, clock.String()).Session(&gorm.Session{})
+}
+
+// RegisterAuditCallbacks registers the callbacks recording the change history
+func RegisterAuditCallbacks(db *gorm.DB) error {
+	if err := db.Callback().Create().After("gorm:create").Register("audit:after_create", auditCreate); err != nil {
+		return err
+	}
+
+	if err := db.Callback().Update().After("gorm:setup_reflect_value").Before("gorm:update").Register("audit:before_update", auditSnapshot); err != nil {
+		return err
+	}
+
+	if err := db.Callback().Update().After("gorm:update").Register("audit:after_update", auditChanges); err != nil {
+		return err
+	}
+
+	if err := db.Callback().Delete().Before("gorm:delete").Register("audit:before_delete", auditSnapshot); err != nil {
+		return err
+	}
+
+	return db.Callback().Delete().After("gorm:delete").Register("audit:after_delete", auditChanges)
+}
+
+// auditSession returns a fresh session on the statement's connection, so queries and
+// inserts made by the callbacks run in the statement's transaction
+func auditSession(db *gorm.DB) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true}).Unscoped()
+}
+
+func auditedTableOf(db *gorm.DB) (auditedTable, bool) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return auditedTable{}, false
+	}
+
+	table, ok := auditedTables[db.Statement.Schema.Table]
+	return table, ok
+}
+
+// newModel returns a new value of the statement's model, to query its table
+func newModel(db *gorm.DB) interface{} {
+	return reflect.New(db.Statement.Schema.ModelType).Interface()
+}
+
+func auditActor(db *gorm.DB) *string {
+	if actor, ok := db.Get(actorKey); ok {
+		if actorID, ok := actor.(string); ok && actorID != "" {
+			return &actorID
+		}
+	}
+	return nil
+}
+
+func auditClock(db *gorm.DB) string {
+	if clock, ok := db.Get(clockKey); ok {
+		if value, ok := clock.(string); ok && value != "" {
+			return value
+		}
+	}
+	return merge.Server.Now().String()
+}
+
+// auditCreate records the creation of every created row
+func auditCreate(db *gorm.DB) {
+	table, ok := auditedTableOf(db)
+	if !ok || db.Statement.Schema.PrioritizedPrimaryField == nil {
+		return
+	}
+
+	var records []models.ChangeRecord
+	actorID, clock := auditActor(db), auditClock(db)
+	appendRecord := func(value reflect.Value) {
+		id, isZero := db.Statement.Schema.PrioritizedPrimaryField.ValueOf(db.Statement.Context, value)
+		if isZero {
+			return
+		}
+
+		records = append(records, models.ChangeRecord{
+			ResourceType: table.resource,
+			ResourceID:   fmt.Sprint(id),
+			Action:       models.ChangeCreate,
+			ActorID:      actorID,
+			Clock:        clock,
+		})
+	}
+
+	switch value := reflect.Indirect(db.Statement.ReflectValue); value.Kind() {
+	case reflect.Struct:
+		appendRecord(value)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			appendRecord(reflect.Indirect(value.Index(i)))
+		}
+	}
+
+	saveChangeRecords(db, records)
+}
+
+// auditSnapshot loads the rows an update or delete is about to change
+func auditSnapshot(db *gorm.DB) {
+	table, ok := auditedTableOf(db)
+	if !ok {
+		return
+	}
+
+	query := auditSession(db).Model(newModel(db)).Select(append([]string{"id", "deleted_at"}, table.fields...))
+	conditions := 0
+
+	if where, ok := db.Statement.Clauses["WHERE"]; ok {
+		if expression, ok := where.Expression.(clause.Where); ok && len(expression.Exprs) > 0 {
+			query = query.Clauses(expression)
+			conditions++
+		}
+	}
+
+	// GORM ADDS A PRIMARY KEY CONDITION FOR MODELS THAT HAVE ONE
+	if field := db.Statement.Schema.PrioritizedPrimaryField; field != nil {
+		switch value := reflect.Indirect(db.Statement.ReflectValue); value.Kind() {
+		case reflect.Struct:
+			if id, isZero := field.ValueOf(db.Statement.Context, value); !isZero {
+				query = query.Where(field.DBName+" = ?", id)
+				conditions++
+			}
+		case reflect.Slice, reflect.Array:
+			ids := []interface{}{}
+			for i := 0; i < value.Len(); i++ {
+				if id, isZero := field.ValueOf(db.Statement.Context, reflect.Indirect(value.Index(i))); !isZero {
+					ids = append(ids, id)
+				}
+			}
+			if len(ids) > 0 {
+				query = query.Where(field.DBName+" IN ?", ids)
+				conditions++
+			}
+		}
+	}
+
+	// Statements without conditions are refused by GORM
+	if conditions == 0 {
+		return
+	}
+
+	var rows []map[string]interface{}
+	if err := query.Find(&rows).Error; err != nil {
+		db.AddError(fmt.Errorf("failed to snapshot change history: %w", err))
+		return
+	}
+
+	db.Statement.Settings.Store("audit:snapshot", rows)
+}
+
+// auditChanges compares the rows snapshotted before an update or delete with the rows
+// afterwards and records the differences
+func auditChanges(db *gorm.DB) {
+	table, ok := auditedTableOf(db)
+	if !ok {
+		return
+	}
+
+	snapshot, ok := db.Statement.Settings.LoadAndDelete("audit:snapshot")
+	if !ok || db.Statement.RowsAffected == 0 {
+		return
+	}
+
+	before := snapshot.([]map[string]interface{})
+	if len(before) == 0 {
+		return
+	}
+
+	ids := make([]interface{}, 0, len(before))
+	for _, row := range before {
+		ids = append(ids, row["id"])
+	}
+
+	var rows []map[string]interface{}
+	if err := auditSession(db).Model(newModel(db)).
+		Select(append([]string{"id", "deleted_at"}, table.fields...)).
+		Where("id IN ?", ids).
+		Find(&rows).Error; err != nil {
+		db.AddError(fmt.Errorf("failed to record change history: %w", err))
+		return
+	}
+
+	after := make(map[string]map[string]interface{}, len(rows))
+	for _, row := range rows {
+		after[fmt.Sprint(row["id"])] = row
+	}
+
+	actorID, clock := auditActor(db), auditClock(db)
+	var records []models.ChangeRecord
+
+	for _, old := range before {
+		id := fmt.Sprint(old["id"])
+		record := models.ChangeRecord{ResourceType: table.resource, ResourceID: id, ActorID: actorID, Clock: clock}
+
+		current, exists := after[id]
+		switch {
+		case !exists:
+			// THE ROW IS GONE, ITS LAST STATE IS KEPT SO SYNC CAN TELL WHO COULD SEE IT
+			snapshot := encodeAuditValue(old)
+			record.Action = models.ChangePurge
+			record.OldValue = &snapshot
+			records = append(records, record)
+			continue
+		case old["deleted_at"] == nil && current["deleted_at"] != nil:
+			record.Action = models.ChangeDelete
+			records = append(records, record)
+		case old["deleted_at"] != nil && current["deleted_at"] == nil:
+			record.Action = models.ChangeRestore
+			records = append(records, record)
+		}
+
+		for _, field := range table.fields {
+			oldValue, newValue := encodeAuditValue(old[field]), encodeAuditValue(current[field])
+			if oldValue == newValue {
+				continue
+			}
+
+			records = append(records, models.ChangeRecord{
+				ResourceType: table.resource,
+				ResourceID:   id,
+				Action:       models.ChangeUpdate,
+				Field:        field,
+				OldValue:     &oldValue,
+				NewValue:     &newValue,
+				ActorID:      actorID,
+				Clock:        clock,
+			})
+		}
+	}
+
+	saveChangeRecords(db, records)
+}
+
+// saveChangeRecords writes the change records of a statement and notifies the change
+// listeners. A failure fails the statement, so no change goes unrecorded.
+func saveChangeRecords(db *gorm.DB, records []models.ChangeRecord) {
+	if len(records) == 0 {
+		return
+	}
+
+	tx := auditSession(db)
+	if err := tx.CreateInBatches(&records, 500).Error; err != nil {
+		db.AddError(fmt.Errorf("failed to record change history: %w", err))
+		return
+	}
+
+	for _, listener := range changeListeners {
+		if err := listener(tx, records); err != nil {
+			db.AddError(fmt.Errorf("change listener failed: %w", err))
+			return
+		}
+	}
+}
+
+func encodeAuditValue(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "null"
+	}
+	return string(data)
+}
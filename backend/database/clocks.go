@@ -0,0 +1,47 @@
+package database
+
+import (
+	"encoding/json"
+
+	"github.com/thompsonmanda08/task-sync/models"
+	"gorm.io/gorm"
+)
+
+// StampFieldClocks is a change listener recording on todos the clock and resulting
+// version of the last change of each field, against which pushed edits are merged. It
+// runs for every writer, so edits made through the API are merged with as well.
+func StampFieldClocks(tx *gorm.DB, records []models.ChangeRecord) error {
+	ids := []string{}
+	clocks := map[string]map[string]string{}
+
+	for _, record := range records {
+		if record.ResourceType != "todo" || record.Action != models.ChangeUpdate || record.Field == "" || record.Clock == "" {
+			continue
+		}
+
+		if clocks[record.ResourceID] == nil {
+			ids = append(ids, record.ResourceID)
+			clocks[record.ResourceID] = map[string]string{}
+		}
+		clocks[record.ResourceID][record.Field] = record.Clock
+	}
+
+	for _, id := range ids {
+		data, err := json.Marshal(clocks[id])
+		if err != nil {
+			return err
+		}
+
+		// THE VERSION IS THE ONE THE CHANGE PRODUCED, THIS UPDATE DOES NOT INCREASE IT
+		if err := tx.Exec(`
+			UPDATE todos SET field_clocks = COALESCE(field_clocks, '{}'::jsonb) || (
+				SELECT jsonb_object_agg(key, jsonb_build_object('clock', value, 'version', todos.version))
+				FROM jsonb_each_text(?::jsonb)
+			)
+			WHERE id = ?`, string(data), id).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
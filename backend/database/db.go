@@ -84,6 +84,20 @@ func Initialize(models ...interface{}) error {
 
 	fmt.Println("Database connection established!")
 
+	// RECORD THE CHANGE HISTORY OF TODOS, LISTS, GROUPS AND MEMBERSHIPS
+	if err := RegisterAuditCallbacks(db); err != nil {
+		log.Fatalf("Failed to register audit callbacks: %v", err)
+	}
+
+	// DERIVE THE GROUP ACTIVITY FEEDS FROM THE CHANGE HISTORY
+	OnChange(RecordGroupActivity)
+
+	// KEEP REMINDERS RELATIVE TO A TODO'S END DATE IN STEP WITH IT
+	OnChange(RescheduleReminders)
+
+	// RECORD WHEN EACH FIELD OF A TODO LAST CHANGED, TO MERGE CONCURRENT EDITS
+	OnChange(StampFieldClocks)
+
 	DBConn = db
 
 	if len(models) > 0 {
@@ -101,6 +115,21 @@ func Initialize(models ...interface{}) error {
 		if err := SeedRolesAndPermissions(DBConn); err != nil {
 			log.Fatalf("failed to seed roles and permissions: %v", err)
 		}
+
+		// GIVE ROWS CREATED BEFORE MANUAL ORDERING A POSITION
+		if err := BackfillPositions(DBConn); err != nil {
+			log.Fatalf("failed to backfill todo positions: %v", err)
+		}
+
+		// FULL-TEXT SEARCH COLUMNS AND INDEXES
+		if err := CreateSearchIndexes(DBConn); err != nil {
+			log.Fatalf("failed to create search indexes: %v", err)
+		}
+
+		// RECORD VERSIONS FOR CONDITIONAL REQUESTS
+		if err := CreateVersionTriggers(DBConn); err != nil {
+			log.Fatalf("failed to create version triggers: %v", err)
+		}
 	} else {
 
 		fmt.Println("No models provided for migration.")
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"github.com/thompsonmanda08/task-sync/models"
+	"github.com/thompsonmanda08/task-sync/utils"
+	"gorm.io/gorm"
+)
+
+// BackfillPositions gives every todo and todo list created before manual ordering
+// existed a position key. Todos keep their creation order at the end of their list and
+// lists keep the newest-first order they used to be listed in.
+func BackfillPositions(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		// 1. Todos, per list
+		var listIDs []string
+		if err := tx.Unscoped().Model(&models.Todo{}).
+			Where("position IS NULL OR position = ''").
+			Distinct().Pluck("todo_list_id", &listIDs).Error; err != nil {
+			return err
+		}
+
+		for _, listID := range listIDs {
+			var last string
+			if err := tx.Unscoped().Model(&models.Todo{}).
+				Where("todo_list_id = ? AND position <> ''", listID).
+				Select("COALESCE(MAX(position), '')").Scan(&last).Error; err != nil {
+				return err
+			}
+
+			var todos []models.Todo
+			if err := tx.Unscoped().Select("id").
+				Where("todo_list_id = ? AND (position IS NULL OR position = '')", listID).
+				Order("created_at ASC").Find(&todos).Error; err != nil {
+				return err
+			}
+
+			keys, err := utils.PositionsBetween(last, "", len(todos))
+			if err != nil {
+				return err
+			}
+
+			for i, todo := range todos {
+				if err := tx.Unscoped().Model(&models.Todo{}).Where("id = ?", todo.ID).UpdateColumn("position", keys[i]).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		// 2. Todo lists, per owner
+		var ownerIDs []string
+		if err := tx.Unscoped().Model(&models.TodoList{}).
+			Where("position IS NULL OR position = ''").
+			Distinct().Pluck("owner_id", &ownerIDs).Error; err != nil {
+			return err
+		}
+
+		for _, ownerID := range ownerIDs {
+			var first string
+			if err := tx.Unscoped().Model(&models.TodoList{}).
+				Where("owner_id = ? AND position <> ''", ownerID).
+				Select("COALESCE(MIN(position), '')").Scan(&first).Error; err != nil {
+				return err
+			}
+
+			var lists []models.TodoList
+			if err := tx.Unscoped().Select("id").
+				Where("owner_id = ? AND (position IS NULL OR position = '')", ownerID).
+				Order("created_at DESC").Find(&lists).Error; err != nil {
+				return err
+			}
+
+			keys, err := utils.PositionsBetween("", first, len(lists))
+			if err != nil {
+				return err
+			}
+
+			for i, list := range lists {
+				if err := tx.Unscoped().Model(&models.TodoList{}).Where("id = ?", list.ID).UpdateColumn("position", keys[i]).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"github.com/thompsonmanda08/task-sync/models"
+	"gorm.io/gorm"
+)
+
+// RescheduleReminders is a change listener moving the relative reminders of todos whose
+// end date changed, so they keep firing the same time before it. Reminders already sent
+// fire again if they move to the future. The lease or retry time in next_attempt_at is
+// kept, so a reminder being delivered is not claimed twice.
+func RescheduleReminders(tx *gorm.DB, records []models.ChangeRecord) error {
+	ids := []string{}
+	for _, record := range records {
+		if record.ResourceType == "todo" && record.Action == models.ChangeUpdate && record.Field == "end_date" {
+			ids = append(ids, record.ResourceID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	// TODOS WITHOUT AN END DATE STORE THE ZERO TIME, THEIR RELATIVE REMINDERS ARE UNSCHEDULED
+	return tx.Exec(`
+		UPDATE reminders SET
+			due_at = rescheduled.due_at,
+			sent_at = CASE WHEN rescheduled.due_at > now() THEN NULL ELSE reminders.sent_at END,
+			attempts = CASE WHEN rescheduled.due_at > now() THEN 0 ELSE reminders.attempts END,
+			updated_at = now()
+		FROM (
+			SELECT reminders.id,
+				CASE WHEN EXTRACT(YEAR FROM todos.end_date) > 1
+					THEN todos.end_date - reminders.offset_minutes * interval '1 minute'
+				END AS due_at
+			FROM reminders JOIN todos ON todos.id = reminders.todo_id
+			WHERE reminders.todo_id IN ? AND reminders.offset_minutes IS NOT NULL
+		) AS rescheduled
+		WHERE reminders.id = rescheduled.id`, ids).Error
+}
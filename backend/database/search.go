@@ -0,0 +1,47 @@
+package database
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// SearchConfig is the Postgres text search configuration used to build and query the
+// search vectors
+const SearchConfig = "english"
+
+// searchVectors lists the searchable tables and the weighted tsvector expression each
+// one keeps in its generated "search_vector" column. Weight A is given to titles.
+var searchVectors = []struct {
+	table      string
+	expression string
+}{
+	{"todos", weightedVector("task", "A") + " || " + weightedVector("description", "B")},
+	{"todo_lists", weightedVector("name", "A") + " || " + weightedVector("description", "B")},
+	{"groups", weightedVector("name", "A") + " || " + weightedVector("description", "B")},
+	{"comments", weightedVector("body", "B")},
+}
+
+func weightedVector(column string, weight string) string {
+	return fmt.Sprintf("setweight(to_tsvector('%s', coalesce(%s, '')), '%s')", SearchConfig, column, weight)
+}
+
+// CreateSearchIndexes adds the generated "search_vector" columns and their GIN indexes
+// used by full-text search. The columns are maintained by Postgres, so they are not part
+// of the models and AutoMigrate leaves them alone.
+func CreateSearchIndexes(db *gorm.DB) error {
+	for _, vector := range searchVectors {
+		statements := []string{
+			fmt.Sprintf(`ALTER TABLE %q ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (%s) STORED`, vector.table, vector.expression),
+			fmt.Sprintf(`CREATE INDEX IF NOT EXISTS idx_%s_search_vector ON %q USING GIN (search_vector)`, vector.table, vector.table),
+		}
+
+		for _, statement := range statements {
+			if err := db.Exec(statement).Error; err != nil {
+				return fmt.Errorf("failed to create search index on %s: %w", vector.table, err)
+			}
+		}
+	}
+
+	return nil
+}
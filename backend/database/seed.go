@@ -7,7 +7,7 @@ import (
 
 func SeedRolesAndPermissions(db *gorm.DB) error {
 	// 1. Define permission names
-	permissionNames := []string{"view", "edit", "invite", "delete_todo", "delete_list", "change_role"}
+	permissionNames := []string{"view", "edit", "invite", "delete_todo", "delete_list", "change_role", "manage_webhooks"}
 	var permissions []models.Permission
 
 	for _, name := range permissionNames {
@@ -34,7 +34,7 @@ func SeedRolesAndPermissions(db *gorm.DB) error {
 		Name            string
 		PermissionNames []string
 	}{
-		{"Owner", []string{"view", "edit", "invite", "delete_todo", "delete_list", "change_role"}},
+		{"Owner", []string{"view", "edit", "invite", "delete_todo", "delete_list", "change_role", "manage_webhooks"}},
 		{"Contributor", []string{"view", "edit"}},
 		{"Viewer", []string{"view"}},
 	}
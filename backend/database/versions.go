@@ -0,0 +1,45 @@
+package database
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// versionedTables lists the tables whose rows carry a "version" column. Postgres
+// increases the version on every update of a row, including moves, deletes to the trash
+// and updates made with raw SQL, so clients can tell whether their copy is current.
+// Updates only stamping the field clocks of a row leave its version alone.
+var versionedTables = []string{"todos", "todo_lists", "groups"}
+
+// CreateVersionTriggers installs the triggers increasing the "version" column of the
+// versioned tables. AutoMigrate creates the columns, which start at 1.
+func CreateVersionTriggers(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		statements := []string{`CREATE OR REPLACE FUNCTION increment_version() RETURNS trigger AS $$
+BEGIN
+	IF to_jsonb(NEW) - 'version' - 'field_clocks' - 'search_vector' = to_jsonb(OLD) - 'version' - 'field_clocks' - 'search_vector' THEN
+		NEW.version := OLD.version;
+		RETURN NEW;
+	END IF;
+	NEW.version := OLD.version + 1;
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql`}
+
+		for _, table := range versionedTables {
+			statements = append(statements,
+				fmt.Sprintf(`DROP TRIGGER IF EXISTS increment_version ON %q`, table),
+				fmt.Sprintf(`CREATE TRIGGER increment_version BEFORE UPDATE ON %q FOR EACH ROW EXECUTE FUNCTION increment_version()`, table),
+			)
+		}
+
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return fmt.Errorf("failed to create version triggers: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/thompsonmanda08/task-sync/models"
+	"gorm.io/gorm"
+)
+
+// enqueueWebhookDeliveries writes the deliveries of new activities to the active webhooks
+// of their groups that subscribe to them. They are written in the transaction of the
+// change, so webhooks report exactly the changes that were committed, and are sent later
+// by the webhooks package.
+func enqueueWebhookDeliveries(tx *gorm.DB, activities []models.Activity) error {
+	groupIDs := []string{}
+	actorIDs := []string{}
+	for _, activity := range activities {
+		groupIDs = append(groupIDs, activity.GroupID)
+		if activity.ActorID != nil {
+			actorIDs = append(actorIDs, *activity.ActorID)
+		}
+	}
+
+	var webhooks []models.Webhook
+	if err := tx.Where("group_id IN ? AND active = ?", groupIDs, true).Find(&webhooks).Error; err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	actors := map[string]models.UserMinimal{}
+	if len(actorIDs) > 0 {
+		var users []models.UserMinimal
+		if err := tx.Model(&models.User{}).Select("id, name, email").Where("id IN ?", actorIDs).Scan(&users).Error; err != nil {
+			return err
+		}
+		for _, user := range users {
+			actors[user.ID] = user
+		}
+	}
+
+	now := time.Now()
+	deliveries := []models.WebhookDelivery{}
+	for _, activity := range activities {
+		var payload []byte
+		for _, webhook := range webhooks {
+			if webhook.GroupID != activity.GroupID || !slices.Contains(webhook.EventList(), activity.Type) {
+				continue
+			}
+
+			// THE PAYLOAD IS THE SAME FOR EVERY WEBHOOK OF THE GROUP
+			if payload == nil {
+				encoded, err := json.Marshal(webhookPayload(activity, actors))
+				if err != nil {
+					return err
+				}
+				payload = encoded
+			}
+
+			deliveries = append(deliveries, models.WebhookDelivery{
+				WebhookID:     webhook.ID,
+				Event:         activity.Type,
+				Payload:       string(payload),
+				Status:        models.DeliveryPending,
+				NextAttemptAt: &now,
+			})
+		}
+	}
+
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return tx.CreateInBatches(&deliveries, 500).Error
+}
+
+func webhookPayload(activity models.Activity, actors map[string]models.UserMinimal) models.WebhookPayload {
+	response := models.ActivityResponse{
+		ID:           activity.ID,
+		GroupID:      activity.GroupID,
+		Type:         activity.Type,
+		ResourceType: activity.ResourceType,
+		ResourceID:   activity.ResourceID,
+		CreatedAt:    activity.CreatedAt,
+	}
+
+	if activity.Data != nil {
+		response.Data = json.RawMessage(*activity.Data)
+	}
+
+	if activity.ActorID != nil {
+		actor, ok := actors[*activity.ActorID]
+		if !ok {
+			actor = models.UserMinimal{ID: *activity.ActorID}
+		}
+		response.Actor = &actor
+	}
+
+	return models.WebhookPayload{Event: activity.Type, Activity: response}
+}
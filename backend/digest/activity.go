@@ -0,0 +1,84 @@
+package digest
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/thompsonmanda08/task-sync/models"
+)
+
+// describeActivity returns a sentence describing a group activity, e.g. "Jane completed
+// Write report in Q3"
+func describeActivity(activity models.Activity) string {
+	actor := "Someone"
+	if activity.Actor != nil && activity.Actor.Name != "" {
+		actor = activity.Actor.Name
+	}
+
+	data := map[string]interface{}{}
+	if activity.Data != nil {
+		_ = json.Unmarshal([]byte(*activity.Data), &data)
+	}
+
+	value := func(key string) string {
+		text, _ := data[key].(string)
+		return text
+	}
+
+	task, list, user := value("task"), value("list_name"), value("user_name")
+
+	switch activity.Type {
+	case models.ActivityGroupCreated:
+		return fmt.Sprintf("%s created the group", actor)
+	case models.ActivityGroupUpdated:
+		if name := value("name"); name != "" {
+			return fmt.Sprintf("%s renamed the group to %s", actor, name)
+		}
+		return fmt.Sprintf("%s updated the group", actor)
+	case models.ActivityGroupDeleted:
+		return fmt.Sprintf("%s deleted the group", actor)
+
+	case models.ActivityMemberJoined:
+		return fmt.Sprintf("%s joined the group", user)
+	case models.ActivityMemberRemoved:
+		return fmt.Sprintf("%s removed %s from the group", actor, user)
+	case models.ActivityMemberLeft:
+		return fmt.Sprintf("%s left the group", user)
+	case models.ActivityRoleChanged:
+		return fmt.Sprintf("%s made %s %s", actor, user, value("role_name"))
+
+	case models.ActivityListCreated:
+		return fmt.Sprintf("%s created the list %s", actor, list)
+	case models.ActivityListUpdated:
+		return fmt.Sprintf("%s updated the list %s", actor, list)
+	case models.ActivityListRenamed:
+		return fmt.Sprintf("%s renamed the list %s to %s", actor, value("old_name"), list)
+	case models.ActivityListDeleted:
+		return fmt.Sprintf("%s deleted the list %s", actor, list)
+	case models.ActivityListRestored:
+		return fmt.Sprintf("%s restored the list %s", actor, list)
+	case models.ActivityListAddedToGroup:
+		return fmt.Sprintf("%s added the list %s to the group", actor, list)
+	case models.ActivityListRemovedFromGroup:
+		return fmt.Sprintf("%s removed the list %s from the group", actor, list)
+
+	case models.ActivityTaskCreated:
+		return fmt.Sprintf("%s added %s to %s", actor, task, list)
+	case models.ActivityTaskUpdated:
+		return fmt.Sprintf("%s updated %s in %s", actor, task, list)
+	case models.ActivityTaskAssigned:
+		return fmt.Sprintf("%s assigned %s in %s", actor, task, list)
+	case models.ActivityTaskCompleted:
+		return fmt.Sprintf("%s completed %s in %s", actor, task, list)
+	case models.ActivityTaskReopened:
+		return fmt.Sprintf("%s reopened %s in %s", actor, task, list)
+	case models.ActivityTaskMoved:
+		return fmt.Sprintf("%s moved %s from %s to %s", actor, task, value("from_list_name"), list)
+	case models.ActivityTaskDeleted:
+		return fmt.Sprintf("%s deleted %s from %s", actor, task, list)
+	case models.ActivityTaskRestored:
+		return fmt.Sprintf("%s restored %s in %s", actor, task, list)
+	}
+
+	return fmt.Sprintf("%s: %s", actor, activity.Type)
+}
@@ -0,0 +1,300 @@
+package digest
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/thompsonmanda08/task-sync/models"
+	"github.com/thompsonmanda08/task-sync/notify"
+	"github.com/thompsonmanda08/task-sync/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxItems    = 50 // Per section
+	maxActivity = 20
+)
+
+//go:embed templates
+var templateFiles embed.FS
+
+var (
+	htmlTemplate = htmltemplate.Must(htmltemplate.ParseFS(templateFiles, "templates/digest.html"))
+	textTemplate = texttemplate.Must(texttemplate.ParseFS(templateFiles, "templates/digest.txt"))
+)
+
+// A Digest summarizes, for a user, the todos needing attention and the recent activity in
+// their groups. The todos are those assigned to the user and the unassigned todos of
+// lists they own.
+type Digest struct {
+	User      models.User
+	Frequency string    // daily or weekly
+	Date      time.Time // In the user's timezone
+
+	Overdue     []Item
+	DueToday    []Item // Due today and not overdue
+	DueThisWeek []Item // Due in the six days after today
+
+	Activity     []ActivityItem
+	MoreActivity int64 // Activities left out of the digest
+}
+
+// An Item is a todo listed in a digest
+type Item struct {
+	Task     string
+	ListName string
+	EndDate  time.Time // In the user's timezone, or the date at midnight UTC for all-day todos
+	AllDay   bool
+	Due      string // The due date, in the user's date format
+	Priority models.Priority
+}
+
+// An ActivityItem is a group activity listed in a digest
+type ActivityItem struct {
+	GroupName string
+	Text      string
+	At        time.Time // In the user's timezone
+	When      string    // At, in the user's date format
+}
+
+// Empty reports whether the digest has nothing to report
+func (d *Digest) Empty() bool {
+	return len(d.Overdue) == 0 && len(d.DueToday) == 0 && len(d.DueThisWeek) == 0 && len(d.Activity) == 0
+}
+
+// Due reports whether a digest should be sent under the given preferences: once on the
+// chosen day, from the chosen hour, in the user's timezone
+func Due(preferences models.UserPreferences, now time.Time) bool {
+	location, err := utils.LoadTimezone(preferences.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+	local := now.In(location)
+
+	switch preferences.DigestFrequency {
+	case models.DigestDaily:
+	case models.DigestWeekly:
+		if int(local.Weekday()) != preferences.DigestWeekday {
+			return false
+		}
+	default:
+		return false
+	}
+
+	if local.Hour() < preferences.DigestHour {
+		return false
+	}
+
+	return preferences.LastDigestAt == nil || preferences.LastDigestAt.Before(utils.StartOfDay(local))
+}
+
+// Compile builds the digest of a user at the given time
+func Compile(ctx context.Context, db *gorm.DB, user models.User, preferences models.UserPreferences, now time.Time) (*Digest, error) {
+	location, err := utils.LoadTimezone(preferences.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+
+	local := now.In(location)
+	today := utils.StartOfDay(local)
+
+	digest := &Digest{User: user, Frequency: preferences.DigestFrequency, Date: local}
+	db = db.WithContext(ctx)
+
+	todos := db.Table("todos").
+		Select("todos.task, todo_lists.name AS list_name, todos.end_date, todos.all_day, todos.priority").
+		Joins("JOIN todo_lists ON todo_lists.id = todos.todo_list_id AND todo_lists.deleted_at IS NULL").
+		Where("todos.deleted_at IS NULL AND todos.is_completed = false").
+		Where("todos.assignee_id = ? OR (todos.assignee_id IS NULL AND todo_lists.owner_id = ?)", user.ID, user.ID).
+		Order("todos.end_date ASC, todos.id ASC").
+		Limit(maxItems).
+		Session(&gorm.Session{})
+
+	overdue, overdueArgs := models.OverdueSQL(now, location)
+	dueToday, dueTodayArgs := models.DueOnSQL(now, location, 0, 1)
+	dueThisWeek, dueThisWeekArgs := models.DueOnSQL(now, location, 1, 7)
+
+	sections := []struct {
+		items *[]Item
+		query *gorm.DB
+	}{
+		{&digest.Overdue, todos.Where(overdue, overdueArgs...)},
+		{&digest.DueToday, todos.Where(dueToday, dueTodayArgs...).Not(overdue, overdueArgs...)},
+		{&digest.DueThisWeek, todos.Where(dueThisWeek, dueThisWeekArgs...)},
+	}
+
+	layout := preferences.DateLayout()
+
+	for _, section := range sections {
+		if err := section.query.Scan(section.items).Error; err != nil {
+			return nil, fmt.Errorf("failed to load todos: %w", err)
+		}
+
+		// ALL-DAY TODOS ARE DUE ON A DATE, NOT AT A TIME
+		for i := range *section.items {
+			item := &(*section.items)[i]
+			if item.AllDay {
+				item.Due = item.EndDate.UTC().Format(layout)
+			} else {
+				item.EndDate = item.EndDate.In(location)
+				item.Due = item.EndDate.Format(layout + " 15:04")
+			}
+		}
+	}
+
+	// ACTIVITY SINCE THE LAST DIGEST, BY OTHER USERS
+	since := today.AddDate(0, 0, -1)
+	if preferences.DigestFrequency == models.DigestWeekly {
+		since = today.AddDate(0, 0, -7)
+	}
+	if preferences.LastDigestAt != nil && preferences.LastDigestAt.After(since) {
+		since = *preferences.LastDigestAt
+	}
+
+	activity := db.Model(&models.Activity{}).
+		Where("group_id IN (?) AND created_at >= ? AND (actor_id IS NULL OR actor_id <> ?)", utils.AccessibleGroupIDs(db, user.ID), since, user.ID)
+
+	var total int64
+	if err := activity.Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count activity: %w", err)
+	}
+
+	var activities []models.Activity
+	if err := activity.
+		Preload("Actor", func(db *gorm.DB) *gorm.DB {
+			return db.Select("id, name")
+		}).
+		Order("created_at DESC, id DESC").
+		Limit(maxActivity).
+		Find(&activities).Error; err != nil {
+		return nil, fmt.Errorf("failed to load activity: %w", err)
+	}
+
+	groupNames := map[string]string{}
+	if len(activities) > 0 {
+		groupIDs := []string{}
+		for _, activity := range activities {
+			groupIDs = append(groupIDs, activity.GroupID)
+		}
+
+		var groups []models.Group
+		if err := db.Unscoped().Select("id, name").Where("id IN ?", groupIDs).Find(&groups).Error; err != nil {
+			return nil, fmt.Errorf("failed to load groups: %w", err)
+		}
+		for _, group := range groups {
+			groupNames[group.ID] = group.Name
+		}
+	}
+
+	for _, activity := range activities {
+		digest.Activity = append(digest.Activity, ActivityItem{
+			GroupName: groupNames[activity.GroupID],
+			Text:      describeActivity(activity),
+			At:        activity.CreatedAt.In(location),
+			When:      activity.CreatedAt.In(location).Format(layout + " 15:04"),
+		})
+	}
+	digest.MoreActivity = total - int64(len(activities))
+
+	return digest, nil
+}
+
+// Render renders a digest to an email, with HTML and plain-text versions
+func Render(digest *Digest) (notify.Email, error) {
+	var html, text bytes.Buffer
+
+	if err := htmlTemplate.Execute(&html, digest); err != nil {
+		return notify.Email{}, fmt.Errorf("failed to render digest: %w", err)
+	}
+
+	if err := textTemplate.Execute(&text, digest); err != nil {
+		return notify.Email{}, fmt.Errorf("failed to render digest: %w", err)
+	}
+
+	subject := "Your daily digest for " + digest.Date.Format("Monday, 2 January")
+	if digest.Frequency == models.DigestWeekly {
+		subject = "Your weekly digest for the week of " + digest.Date.Format("2 January")
+	}
+
+	return notify.Email{
+		To:      []string{digest.User.Email},
+		Subject: subject,
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+// SendDue sends the digests due at the given time and returns how many were sent. Each
+// user's preferences row is locked with FOR UPDATE SKIP LOCKED while their digest is
+// sent, so any number of app instances can run it at once without sending a digest
+// twice. Users with nothing to report get no email.
+func SendDue(ctx context.Context, db *gorm.DB, mailer notify.Mailer, now time.Time) (int, error) {
+	var candidates []models.UserPreferences
+	if err := db.WithContext(ctx).
+		Where("digest_frequency IN ?", []string{models.DigestDaily, models.DigestWeekly}).
+		Find(&candidates).Error; err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	var errs []error
+
+	for _, candidate := range candidates {
+		if ctx.Err() != nil {
+			break
+		}
+
+		if !Due(candidate, now) {
+			continue
+		}
+
+		err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			// ANOTHER INSTANCE MAY HAVE SENT IT SINCE, OR BE SENDING IT
+			var preferences models.UserPreferences
+			result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("id = ?", candidate.ID).
+				Limit(1).
+				Find(&preferences)
+			if result.Error != nil || result.RowsAffected == 0 || !Due(preferences, now) {
+				return result.Error
+			}
+
+			var user models.User
+			if err := tx.Select("id, name, email").Where("id = ?", preferences.UserID).First(&user).Error; err != nil {
+				return err
+			}
+
+			digest, err := Compile(ctx, tx, user, preferences, now)
+			if err != nil {
+				return err
+			}
+
+			if !digest.Empty() {
+				email, err := Render(digest)
+				if err != nil {
+					return err
+				}
+
+				if err := mailer.Send(ctx, email); err != nil {
+					return err
+				}
+				sent++
+			}
+
+			return tx.Model(&preferences).UpdateColumn("last_digest_at", now).Error
+		})
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("digest of user %s: %w", candidate.UserID, err))
+		}
+	}
+
+	return sent, errors.Join(errs...)
+}
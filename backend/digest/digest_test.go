@@ -0,0 +1,466 @@
+package digest
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thompsonmanda08/task-sync/models"
+	"github.com/thompsonmanda08/task-sync/notify"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Monday 19 October 2026
+var monday = time.Date(2026, time.October, 19, 6, 30, 0, 0, time.UTC)
+
+func TestDue(t *testing.T) {
+	at := func(t time.Time) *time.Time { return &t }
+
+	tests := []struct {
+		name        string
+		preferences models.UserPreferences
+		now         time.Time
+		want        bool
+	}{
+		{
+			name:        "off",
+			preferences: models.UserPreferences{DigestFrequency: "off", Timezone: "UTC"},
+			now:         monday,
+			want:        false,
+		},
+		{
+			name:        "daily before the hour",
+			preferences: models.UserPreferences{DigestFrequency: models.DigestDaily, DigestHour: 7, Timezone: "UTC"},
+			now:         monday,
+			want:        false,
+		},
+		{
+			name:        "daily from the hour",
+			preferences: models.UserPreferences{DigestFrequency: models.DigestDaily, DigestHour: 6, Timezone: "UTC"},
+			now:         monday,
+			want:        true,
+		},
+		{
+			name:        "daily from the hour in the user's timezone",
+			preferences: models.UserPreferences{DigestFrequency: models.DigestDaily, DigestHour: 8, Timezone: "Africa/Lusaka"}, // 08:30 local
+			now:         monday,
+			want:        true,
+		},
+		{
+			name:        "daily before the hour in the user's timezone",
+			preferences: models.UserPreferences{DigestFrequency: models.DigestDaily, DigestHour: 6, Timezone: "America/New_York"}, // 02:30 local
+			now:         monday,
+			want:        false,
+		},
+		{
+			name:        "invalid timezone falls back to UTC",
+			preferences: models.UserPreferences{DigestFrequency: models.DigestDaily, DigestHour: 6, Timezone: "Nowhere/Invalid"},
+			now:         monday,
+			want:        true,
+		},
+		{
+			name:        "weekly on the weekday",
+			preferences: models.UserPreferences{DigestFrequency: models.DigestWeekly, DigestWeekday: int(time.Monday), DigestHour: 6, Timezone: "UTC"},
+			now:         monday,
+			want:        true,
+		},
+		{
+			name:        "weekly on another weekday",
+			preferences: models.UserPreferences{DigestFrequency: models.DigestWeekly, DigestWeekday: int(time.Tuesday), DigestHour: 6, Timezone: "UTC"},
+			now:         monday,
+			want:        false,
+		},
+		{
+			name:        "weekly on the weekday of the user's timezone",
+			preferences: models.UserPreferences{DigestFrequency: models.DigestWeekly, DigestWeekday: int(time.Tuesday), DigestHour: 1, Timezone: "Africa/Lusaka"},
+			now:         time.Date(2026, time.October, 19, 23, 30, 0, 0, time.UTC), // Tuesday 01:30 local
+			want:        true,
+		},
+		{
+			name:        "weekly on the UTC weekday only",
+			preferences: models.UserPreferences{DigestFrequency: models.DigestWeekly, DigestWeekday: int(time.Monday), DigestHour: 1, Timezone: "Africa/Lusaka"},
+			now:         time.Date(2026, time.October, 19, 23, 30, 0, 0, time.UTC),
+			want:        false,
+		},
+		{
+			name:        "already sent on the local day",
+			preferences: models.UserPreferences{DigestFrequency: models.DigestDaily, DigestHour: 6, Timezone: "UTC", LastDigestAt: at(monday.Add(-10 * time.Minute))},
+			now:         monday,
+			want:        false,
+		},
+		{
+			name:        "sent on the previous local day",
+			preferences: models.UserPreferences{DigestFrequency: models.DigestDaily, DigestHour: 8, Timezone: "Africa/Lusaka", LastDigestAt: at(time.Date(2026, time.October, 18, 21, 59, 0, 0, time.UTC))}, // 23:59 local
+			now:         monday,
+			want:        true,
+		},
+		{
+			name:        "sent after midnight in the user's timezone",
+			preferences: models.UserPreferences{DigestFrequency: models.DigestDaily, DigestHour: 8, Timezone: "Africa/Lusaka", LastDigestAt: at(time.Date(2026, time.October, 18, 22, 1, 0, 0, time.UTC))}, // 00:01 local
+			now:         monday,
+			want:        false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Due(tt.preferences, tt.now); got != tt.want {
+				t.Errorf("Due() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	digest := &Digest{
+		User:      models.User{Name: "Jane <Admin>", Email: "jane@example.com"},
+		Frequency: models.DigestDaily,
+		Date:      monday,
+		Overdue:   []Item{{Task: "Write report", ListName: "Work", Due: "2026-10-18 10:00", Priority: models.Priority("high")}},
+		DueToday:  []Item{{Task: "Call the bank", ListName: "Home", Due: "2026-10-19", AllDay: true}},
+		Activity:  []ActivityItem{{GroupName: "Team", Text: "Sam completed Plan sprint", When: "2026-10-18 16:00"}},
+
+		MoreActivity: 3,
+	}
+
+	email, err := Render(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(email.To) != 1 || email.To[0] != "jane@example.com" {
+		t.Errorf("To = %v, want jane@example.com", email.To)
+	}
+	if email.Subject != "Your daily digest for Monday, 19 October" {
+		t.Errorf("Subject = %q", email.Subject)
+	}
+
+	for _, want := range []string{"Hi Jane <Admin>,", "OVERDUE", "Write report (Work), due 2026-10-18 10:00, high priority", "DUE TODAY", "Call the bank (Home)", "[Team] Sam completed Plan sprint", "and 3 more"} {
+		if !strings.Contains(email.Text, want) {
+			t.Errorf("text body does not contain %q:\n%s", want, email.Text)
+		}
+	}
+	if strings.Contains(email.Text, "DUE THIS WEEK") {
+		t.Errorf("text body contains an empty section:\n%s", email.Text)
+	}
+
+	// THE HTML BODY ESCAPES USER CONTENT
+	for _, want := range []string{"Hi Jane &lt;Admin&gt;,", "<strong>Write report</strong>", "Overdue", "Due today", "Sam completed Plan sprint", "and 3 more"} {
+		if !strings.Contains(email.HTML, want) {
+			t.Errorf("HTML body does not contain %q:\n%s", want, email.HTML)
+		}
+	}
+
+	digest.Frequency = models.DigestWeekly
+	if email, _ := Render(digest); email.Subject != "Your weekly digest for the week of 19 October" {
+		t.Errorf("weekly Subject = %q", email.Subject)
+	}
+}
+
+// TestRenderThroughSMTP sends a rendered digest through the SMTP mailer to a local SMTP
+// stand-in and checks that both bodies arrive
+func TestRenderThroughSMTP(t *testing.T) {
+	server := newSMTPStandIn(t)
+
+	host, port, _ := net.SplitHostPort(server.listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	mailer, err := notify.NewSMTPMailer(notify.SMTPConfig{Host: host, Port: portNumber, From: "Task Sync <digests@example.com>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	email, err := Render(&Digest{
+		User:      models.User{Name: "Jane", Email: "jane@example.com"},
+		Frequency: models.DigestDaily,
+		Date:      monday,
+		Overdue:   []Item{{Task: "Write report", ListName: "Work", Due: "2026-10-18 10:00"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mailer.Send(context.Background(), email); err != nil {
+		t.Fatal(err)
+	}
+
+	received := server.wait(t)
+	if received.from != "digests@example.com" || len(received.to) != 1 || received.to[0] != "jane@example.com" {
+		t.Errorf("envelope from %q to %v", received.from, received.to)
+	}
+
+	message, err := mail.ReadMessage(strings.NewReader(received.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject, _ := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject")); subject != email.Subject {
+		t.Errorf("Subject = %q, want %q", subject, email.Subject)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, want multipart/alternative", message.Header.Get("Content-Type"))
+	}
+
+	bodies := map[string]string{}
+	parts := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := parts.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(quotedprintable.NewReader(part))
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		// QUOTED-PRINTABLE TEXT HAS CRLF LINE BREAKS
+		bodies[contentType] = strings.ReplaceAll(string(body), "\r\n", "\n")
+	}
+
+	if bodies["text/plain"] != email.Text {
+		t.Errorf("text part = %q, want %q", bodies["text/plain"], email.Text)
+	}
+	if bodies["text/html"] != email.HTML {
+		t.Errorf("HTML part = %q, want %q", bodies["text/html"], email.HTML)
+	}
+	if !strings.Contains(bodies["text/html"], "<strong>Write report</strong>") {
+		t.Errorf("HTML part does not list the overdue todo:\n%s", bodies["text/html"])
+	}
+}
+
+// smtpStandIn is a minimal SMTP server accepting one message, without TLS or auth
+type smtpStandIn struct {
+	listener net.Listener
+	messages chan smtpMessage
+}
+
+type smtpMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+func newSMTPStandIn(t *testing.T) *smtpStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	server := &smtpStandIn{listener: listener, messages: make(chan smtpMessage, 1)}
+	go server.serve()
+	return server
+}
+
+func (s *smtpStandIn) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	var message smtpMessage
+	reply("220 localhost ready")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(line)
+
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			message.from = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			message.to = append(message.to, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			message.data = data.String()
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			s.messages <- message
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func (s *smtpStandIn) wait(t *testing.T) smtpMessage {
+	select {
+	case message := <-s.messages:
+		return message
+	case <-time.After(5 * time.Second):
+		t.Fatal("the SMTP stand-in received no message")
+		return smtpMessage{}
+	}
+}
+
+// fakeMailer records the emails it is asked to send
+type fakeMailer struct {
+	mu     sync.Mutex
+	emails []notify.Email
+}
+
+func (m *fakeMailer) Send(ctx context.Context, email notify.Email) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.emails = append(m.emails, email)
+	return nil
+}
+
+func (m *fakeMailer) sentTo(address string) []notify.Email {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	emails := []notify.Email{}
+	for _, email := range m.emails {
+		if len(email.To) == 1 && email.To[0] == address {
+			emails = append(emails, email)
+		}
+	}
+	return emails
+}
+
+// TestSendDue needs a Postgres database, e.g. the postgres service of docker-compose:
+//
+//	TEST_DATABASE_DSN="host=localhost user=postgres password=... dbname=postgres sslmode=disable" go test ./digest
+//
+// Its rows are written in a transaction that is rolled back.
+func TestSendDue(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Role{}, &models.Permission{}, &models.Group{}, &models.TodoList{}, &models.Todo{},
+		&models.UserGroupRoleMapping{}, &models.Activity{}, &models.UserPreferences{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := db.Begin()
+	t.Cleanup(func() { tx.Rollback() })
+
+	suffix := time.Now().Format("150405.000000000")
+	create := func(value interface{}) {
+		t.Helper()
+		if err := tx.Omit(clause.Associations).Create(value).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// DUE AT 08:30 IN LUSAKA, WITH AN OVERDUE TODO
+	due := models.User{Name: "Due", Email: "due-" + suffix + "@example.com"}
+	create(&due)
+	list := models.TodoList{Name: "Work", OwnerID: due.ID}
+	create(&list)
+	create(&models.Todo{Task: "Write report", TodoListID: list.ID, EndDate: monday.Add(-20 * time.Hour)})
+	preferences := models.DefaultUserPreferences(due.ID)
+	preferences.Timezone = "Africa/Lusaka"
+	preferences.DigestFrequency = models.DigestDaily
+	preferences.DigestHour = 8
+	create(&preferences)
+
+	// NOT DUE BEFORE 09:00 IN LUSAKA
+	later := models.User{Name: "Later", Email: "later-" + suffix + "@example.com"}
+	create(&later)
+	laterList := models.TodoList{Name: "Home", OwnerID: later.ID}
+	create(&laterList)
+	create(&models.Todo{Task: "Call the bank", TodoListID: laterList.ID, EndDate: monday.Add(-20 * time.Hour)})
+	laterPreferences := models.DefaultUserPreferences(later.ID)
+	laterPreferences.Timezone = "Africa/Lusaka"
+	laterPreferences.DigestFrequency = models.DigestDaily
+	laterPreferences.DigestHour = 9
+	create(&laterPreferences)
+
+	// DUE, WITH NOTHING TO REPORT
+	idle := models.User{Name: "Idle", Email: "idle-" + suffix + "@example.com"}
+	create(&idle)
+	idlePreferences := models.DefaultUserPreferences(idle.ID)
+	idlePreferences.DigestFrequency = models.DigestDaily
+	idlePreferences.DigestHour = 6
+	create(&idlePreferences)
+
+	mailer := &fakeMailer{}
+	ctx := context.Background()
+
+	if _, err := SendDue(ctx, tx, mailer, monday); err != nil {
+		t.Fatal(err)
+	}
+
+	emails := mailer.sentTo(due.Email)
+	if len(emails) != 1 {
+		t.Fatalf("sent %d digests to the due user, want 1", len(emails))
+	}
+	if !strings.Contains(emails[0].Text, "Write report (Work)") || !strings.Contains(emails[0].HTML, "<strong>Write report</strong>") {
+		t.Errorf("digest does not list the overdue todo:\n%s\n%s", emails[0].Text, emails[0].HTML)
+	}
+	if n := len(mailer.sentTo(later.Email)); n != 0 {
+		t.Errorf("sent %d digests before the user's hour, want 0", n)
+	}
+	if n := len(mailer.sentTo(idle.Email)); n != 0 {
+		t.Errorf("sent %d empty digests, want 0", n)
+	}
+
+	// AN EMPTY DIGEST STILL COUNTS AS SENT FOR THE DAY
+	var idleAfter models.UserPreferences
+	tx.Where("id = ?", idlePreferences.ID).First(&idleAfter)
+	if idleAfter.LastDigestAt == nil {
+		t.Error("LastDigestAt of the user with nothing to report was not set")
+	}
+
+	// ONE DIGEST PER LOCAL DAY, THE NEXT ONE THE DAY AFTER
+	if _, err := SendDue(ctx, tx, mailer, monday.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(mailer.sentTo(due.Email)); n != 1 {
+		t.Errorf("sent %d digests to the due user on the same day, want 1", n)
+	}
+	if n := len(mailer.sentTo(later.Email)); n != 1 {
+		t.Errorf("sent %d digests to the later user after their hour, want 1", n)
+	}
+
+	if _, err := SendDue(ctx, tx, mailer, monday.Add(24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(mailer.sentTo(due.Email)); n != 2 {
+		t.Errorf("sent %d digests to the due user by the next day, want 2", n)
+	}
+}
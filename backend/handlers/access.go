@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thompsonmanda08/task-sync/models"
+	"github.com/thompsonmanda08/task-sync/utils"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTodoNotFound     = errors.New("todo not found")
+	ErrAssigneeNotFound = errors.New("assignee not found")
+	ErrAssigneeNoAccess = errors.New("assignee cannot read the todo list")
+)
+
+// findAccessibleTodo loads a todo item from a list the user can access. The list is
+// checked for read access, or write access when requireWrite is set.
+func findAccessibleTodo(db *gorm.DB, userID string, listID string, taskID string, requireWrite bool) (*models.TodoList, *models.Todo, error) {
+	todoList, err := utils.FindAccessibleTodoList(db, userID, listID, requireWrite)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var todo models.Todo
+	if err := db.Where("id = ? AND todo_list_id = ?", taskID, todoList.ID).First(&todo).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrTodoNotFound
+		}
+		return nil, nil, fmt.Errorf("failed to retrieve todo: %w", err)
+	}
+
+	return todoList, &todo, nil
+}
+
+// sendAccessError maps the errors returned by the access helpers to an error response
+func sendAccessError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, utils.ErrListNotFound):
+		return utils.SendErrorResponse(c, fiber.StatusNotFound, "Todo List not found", err)
+	case errors.Is(err, ErrTodoNotFound):
+		return utils.SendErrorResponse(c, fiber.StatusNotFound, "Task item not found", err)
+	case errors.Is(err, utils.ErrListForbidden):
+		return utils.SendErrorResponse(c, fiber.StatusForbidden, "User does not have access to this todo list", err)
+	default:
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to check todo list access", err)
+	}
+}
+
+// findAccessibleTodoByID loads a todo item by ID alone, for references that may point
+// into another list, and checks the user's access to the list it belongs to.
+func findAccessibleTodoByID(db *gorm.DB, userID string, taskID string, requireWrite bool) (*models.TodoList, *models.Todo, error) {
+	var todo models.Todo
+	if err := db.Select("id", "todo_list_id").Where("id = ?", taskID).First(&todo).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrTodoNotFound
+		}
+		return nil, nil, fmt.Errorf("failed to retrieve todo: %w", err)
+	}
+
+	return findAccessibleTodo(db, userID, todo.TodoListID, todo.ID, requireWrite)
+}
+
+// checkAssignee checks that a user exists and can read a todo list, so todos of the list
+// can be assigned to them
+func checkAssignee(db *gorm.DB, list *models.TodoList, assigneeID string) error {
+	var assignee models.User
+	if err := db.Select("id").Where("id = ?", assigneeID).First(&assignee).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrAssigneeNotFound
+		}
+		return fmt.Errorf("failed to retrieve assignee: %w", err)
+	}
+
+	canRead, _, err := utils.TodoListAccess(db, assignee.ID, list)
+	if err != nil {
+		return err
+	}
+
+	if !canRead {
+		return ErrAssigneeNoAccess
+	}
+	return nil
+}
+
+func sendAssigneeError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, ErrAssigneeNotFound):
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Assignee not found", err)
+	case errors.Is(err, ErrAssigneeNoAccess):
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Assignee does not have access to this todo list", err)
+	default:
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to check assignee", err)
+	}
+}
+
+// sendNewIDError maps the errors of utils.CheckNewID to an error response
+func sendNewIDError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, utils.ErrInvalidID):
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid ID", err)
+	case errors.Is(err, utils.ErrIDInUse):
+		return utils.SendErrorResponse(c, fiber.StatusConflict, "A record with this ID already exists", err)
+	default:
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to check the ID", err)
+	}
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thompsonmanda08/task-sync/database"
+	"github.com/thompsonmanda08/task-sync/models"
+	"github.com/thompsonmanda08/task-sync/utils"
+	"gorm.io/gorm"
+)
+
+// GetGroupActivity returns the activity feed of a group, newest first and paginated. The
+// feed can be filtered by the user who made the changes with "actor_id", by a comma
+// separated set of activity types with "type" and by time with "since" and "until".
+func GetGroupActivity(c *fiber.Ctx) error {
+	db := database.DBConn
+	pagination := utils.GetPagination(c)
+
+	query := db.Model(&models.Activity{}).Where("group_id = ?", c.Params("group_id"))
+
+	if actorID := c.Query("actor_id"); actorID != "" {
+		query = query.Where("actor_id = ?", actorID)
+	}
+
+	if raw := c.Query("type"); raw != "" {
+		types := []string{}
+		for _, value := range strings.Split(raw, ",") {
+			value = strings.TrimSpace(value)
+			if !slices.Contains(models.ActivityTypes, value) {
+				return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid activity type", fmt.Errorf("%w: unknown type %q", utils.ErrInvalidFilter, value))
+			}
+			types = append(types, value)
+		}
+		query = query.Where("type IN ?", types)
+	}
+
+	since, err := utils.ParseTimeQuery(c, "since")
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid filter", err)
+	}
+	if since != nil {
+		query = query.Where("created_at >= ?", *since)
+	}
+
+	until, err := utils.ParseTimeQuery(c, "until")
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid filter", err)
+	}
+	if until != nil {
+		query = query.Where("created_at < ?", *until)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve activity", err)
+	}
+
+	var activities []models.Activity
+	if err := query.
+		Preload("Actor", func(db *gorm.DB) *gorm.DB {
+			return db.Select("id, name, email")
+		}).
+		Order("created_at DESC, id DESC").
+		Limit(pagination.Limit).
+		Offset(pagination.Offset).
+		Find(&activities).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve activity", err)
+	}
+
+	response := make([]models.ActivityResponse, 0, len(activities))
+	for _, activity := range activities {
+		response = append(response, toActivityResponse(activity))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Activity retrieved successfully",
+		"data": fiber.Map{
+			"activity": response,
+			"count":    len(response),
+			"total":    total,
+			"page":     pagination.Page,
+			"limit":    pagination.Limit,
+		},
+		"status": fiber.StatusOK,
+	})
+}
+
+func toActivityResponse(activity models.Activity) models.ActivityResponse {
+	response := models.ActivityResponse{
+		ID:           activity.ID,
+		GroupID:      activity.GroupID,
+		Type:         activity.Type,
+		ResourceType: activity.ResourceType,
+		ResourceID:   activity.ResourceID,
+		CreatedAt:    activity.CreatedAt,
+	}
+
+	if activity.Data != nil {
+		response.Data = json.RawMessage(*activity.Data)
+	}
+
+	if activity.Actor != nil {
+		response.Actor = &models.UserMinimal{
+			ID:    activity.Actor.ID,
+			Name:  activity.Actor.Name,
+			Email: activity.Actor.Email,
+		}
+	} else if activity.ActorID != nil {
+		response.Actor = &models.UserMinimal{ID: *activity.ActorID}
+	}
+
+	return response
+}
@@ -0,0 +1,365 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/thompsonmanda08/task-sync/database"
+	"github.com/thompsonmanda08/task-sync/models"
+	"github.com/thompsonmanda08/task-sync/storage"
+	"github.com/thompsonmanda08/task-sync/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultAttachmentMaxSizeMB = 10
+	downloadURLTTL             = 15 * time.Minute
+)
+
+// Content types accepted for attachments, detected from the file contents rather than
+// trusted from the client
+var allowedAttachmentTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+	"text/plain":      true,
+}
+
+// UploadTodoAttachment uploads a file to a todo item from the "file" field of a multipart
+// form. The user needs write access to the todo's list. Files are deduplicated by their
+// SHA-256 checksum, so uploading the same file twice only stores it once.
+func UploadTodoAttachment(c *fiber.Ctx) error {
+	db := database.DBConn
+	userID := c.Locals("userID").(string)
+
+	_, todo, err := findAccessibleTodo(db, userID, c.Params("list_id"), c.Params("task_id"), true)
+	if err != nil {
+		return sendAccessError(c, err)
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "A file is required in the \"file\" form field", err)
+	}
+
+	maxSize := attachmentMaxSize()
+	if fileHeader.Size > maxSize {
+		return utils.SendErrorResponse(c, fiber.StatusRequestEntityTooLarge, "File is too large", fmt.Errorf("files must be at most %d bytes", maxSize))
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Failed to read uploaded file", err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Failed to read uploaded file", err)
+	}
+
+	if int64(len(data)) > maxSize {
+		return utils.SendErrorResponse(c, fiber.StatusRequestEntityTooLarge, "File is too large", fmt.Errorf("files must be at most %d bytes", maxSize))
+	}
+
+	contentType := detectContentType(data)
+	if !allowedAttachmentTypes[contentType] {
+		return utils.SendErrorResponse(c, fiber.StatusUnsupportedMediaType, "File type is not allowed", fmt.Errorf("unsupported content type %s", contentType))
+	}
+
+	attachment := models.Attachment{
+		FileName:     sanitizeFileName(fileHeader.Filename),
+		TodoID:       todo.ID,
+		UploadedByID: userID,
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		blob, err := saveBlob(c.UserContext(), tx, data, contentType)
+		if err != nil {
+			return err
+		}
+
+		attachment.BlobID = blob.ID
+		attachment.Blob = *blob
+
+		return tx.Omit("Blob", "Todo", "UploadedBy").Create(&attachment).Error
+	})
+
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to save attachment", err)
+	}
+
+	response, err := toAttachmentResponse(attachment)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to sign download url", err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"message": "Attachment uploaded successfully",
+		"data":    response,
+		"status":  fiber.StatusCreated,
+	})
+}
+
+// GetTodoAttachments lists the attachments of a todo item, each with a short-lived signed download URL
+func GetTodoAttachments(c *fiber.Ctx) error {
+	db := database.DBConn
+	userID := c.Locals("userID").(string)
+
+	_, todo, err := findAccessibleTodo(db, userID, c.Params("list_id"), c.Params("task_id"), false)
+	if err != nil {
+		return sendAccessError(c, err)
+	}
+
+	var attachments []models.Attachment
+	if err := db.Preload("Blob").Where("todo_id = ?", todo.ID).Order("created_at ASC").Find(&attachments).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve attachments", err)
+	}
+
+	response := make([]models.AttachmentResponse, 0, len(attachments))
+	for _, attachment := range attachments {
+		item, err := toAttachmentResponse(attachment)
+		if err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to sign download url", err)
+		}
+		response = append(response, item)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Attachments retrieved successfully",
+		"data":    fiber.Map{"attachments": response, "count": len(response)},
+		"status":  fiber.StatusOK,
+	})
+}
+
+// DeleteTodoAttachment removes an attachment from a todo item. The stored file is
+// garbage-collected once no other attachment refers to it.
+func DeleteTodoAttachment(c *fiber.Ctx) error {
+	db := database.DBConn
+	userID := c.Locals("userID").(string)
+
+	_, todo, err := findAccessibleTodo(db, userID, c.Params("list_id"), c.Params("task_id"), true)
+	if err != nil {
+		return sendAccessError(c, err)
+	}
+
+	var attachment models.Attachment
+	if err := db.Where("id = ? AND todo_id = ?", c.Params("attachment_id"), todo.ID).First(&attachment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.SendErrorResponse(c, fiber.StatusNotFound, "Attachment not found", err)
+		}
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve attachment", err)
+	}
+
+	if err := deleteAttachments(c.UserContext(), db, "id = ?", attachment.ID); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to delete attachment", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Attachment deleted successfully",
+		"data":    fiber.Map{"id": attachment.ID},
+		"status":  fiber.StatusOK,
+	})
+}
+
+// DownloadAttachment streams an attachment. It is a public route: access is granted by
+// the signature of the URL handed out by GetTodoAttachments.
+func DownloadAttachment(c *fiber.Ctx) error {
+	db := database.DBConn
+	attachmentID := c.Params("attachment_id")
+
+	if err := utils.VerifySignedURL(attachmentDownloadPath(attachmentID), c.Query("expires"), c.Query("signature")); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusForbidden, "Invalid or expired download link", err)
+	}
+
+	var attachment models.Attachment
+	if err := db.Preload("Blob").Where("id = ?", attachmentID).First(&attachment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.SendErrorResponse(c, fiber.StatusNotFound, "Attachment not found", err)
+		}
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve attachment", err)
+	}
+
+	reader, err := storage.Store.Get(c.UserContext(), attachment.Blob.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			return utils.SendErrorResponse(c, fiber.StatusNotFound, "Attachment file is missing", err)
+		}
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to read attachment", err)
+	}
+
+	c.Set(fiber.HeaderContentType, attachment.Blob.ContentType)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", attachment.FileName))
+	c.Set("X-Content-Type-Options", "nosniff")
+
+	// Fiber closes the reader once the body has been sent
+	return c.Status(fiber.StatusOK).SendStream(reader, int(attachment.Blob.Size))
+}
+
+// saveBlob stores data as a blob, reusing an existing blob with the same checksum.
+// It must run inside a transaction: the blob row is locked so a concurrent garbage
+// collection cannot delete it before the caller references it, and uploads of the same
+// contents are serialised on the checksum so they cannot both create the blob.
+func saveBlob(ctx context.Context, tx *gorm.DB, data []byte, contentType string) (*models.Blob, error) {
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+
+	// A ROW LOCK ONLY COVERS BLOBS THAT EXIST, THE ADVISORY LOCK ALSO COVERS NEW ONES.
+	// IT IS HELD UNTIL THE TRANSACTION ENDS, SO THE NEXT UPLOAD FINDS THE COMMITTED BLOB.
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", checksum).Error; err != nil {
+		return nil, err
+	}
+
+	var blob models.Blob
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("checksum = ?", checksum).First(&blob).Error
+	if err == nil {
+		return &blob, nil
+	}
+
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	blob = models.Blob{
+		ID:          utils.GenerateCUID(),
+		Checksum:    checksum,
+		Size:        int64(len(data)),
+		ContentType: contentType,
+	}
+
+	// Keys are per blob rather than per checksum, so deleting a collected blob can never
+	// remove the file of a new blob with the same contents
+	blob.StorageKey = "blobs/" + blob.ID
+
+	if err := storage.Store.Put(ctx, blob.StorageKey, bytes.NewReader(data), blob.Size, contentType); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Create(&blob).Error; err != nil {
+		if deleteErr := storage.Store.Delete(ctx, blob.StorageKey); deleteErr != nil {
+			log.Errorf("Failed to remove orphaned blob %s: %v", blob.StorageKey, deleteErr)
+		}
+		return nil, err
+	}
+
+	return &blob, nil
+}
+
+// deleteAttachments deletes the attachments matching the condition and garbage-collects
+// the blobs that are no longer referenced by any attachment.
+func deleteAttachments(ctx context.Context, db *gorm.DB, condition string, args ...interface{}) error {
+	var collected []models.Blob
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var attachments []models.Attachment
+		if err := tx.Where(condition, args...).Find(&attachments).Error; err != nil {
+			return err
+		}
+
+		if len(attachments) == 0 {
+			return nil
+		}
+
+		attachmentIDs := make([]string, 0, len(attachments))
+		blobIDs := make([]string, 0, len(attachments))
+		for _, attachment := range attachments {
+			attachmentIDs = append(attachmentIDs, attachment.ID)
+			blobIDs = append(blobIDs, attachment.BlobID)
+		}
+
+		if err := tx.Where("id IN ?", attachmentIDs).Delete(&models.Attachment{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Clauses(clause.Returning{}).
+			Where("id IN ? AND NOT EXISTS (SELECT 1 FROM attachments WHERE attachments.blob_id = blobs.id)", blobIDs).
+			Delete(&collected).Error
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// Files are removed after the commit; a failure only leaves an unreferenced file behind
+	for _, blob := range collected {
+		if err := storage.Store.Delete(ctx, blob.StorageKey); err != nil {
+			log.Errorf("Failed to delete blob %s from storage: %v", blob.StorageKey, err)
+		}
+	}
+
+	return nil
+}
+
+func toAttachmentResponse(attachment models.Attachment) (models.AttachmentResponse, error) {
+	downloadURL, err := utils.SignURL(attachmentDownloadPath(attachment.ID), downloadURLTTL)
+	if err != nil {
+		return models.AttachmentResponse{}, err
+	}
+
+	return models.AttachmentResponse{
+		ID:           attachment.ID,
+		FileName:     attachment.FileName,
+		ContentType:  attachment.Blob.ContentType,
+		Size:         attachment.Blob.Size,
+		Checksum:     attachment.Blob.Checksum,
+		TodoID:       attachment.TodoID,
+		UploadedByID: attachment.UploadedByID,
+		DownloadURL:  downloadURL,
+		CreatedAt:    attachment.CreatedAt,
+	}, nil
+}
+
+func attachmentDownloadPath(attachmentID string) string {
+	return "/api/v1/attachments/" + attachmentID + "/download"
+}
+
+func attachmentMaxSize() int64 {
+	sizeMB, err := strconv.ParseInt(os.Getenv("ATTACHMENT_MAX_SIZE_MB"), 10, 64)
+	if err != nil || sizeMB <= 0 {
+		sizeMB = defaultAttachmentMaxSizeMB
+	}
+	return sizeMB << 20
+}
+
+// detectContentType sniffs the content type of a file, dropping parameters such as charset
+func detectContentType(data []byte) string {
+	contentType := http.DetectContentType(data)
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return strings.TrimSpace(contentType)
+}
+
+func sanitizeFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 32 || r == '"' || r == 127 {
+			return -1
+		}
+		return r
+	}, name)
+
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	return name
+}
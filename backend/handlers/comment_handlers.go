@@ -0,0 +1,370 @@
+package handlers
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/thompsonmanda08/task-sync/database"
+	"github.com/thompsonmanda08/task-sync/models"
+	"github.com/thompsonmanda08/task-sync/notify"
+	"github.com/thompsonmanda08/task-sync/utils"
+	"gorm.io/gorm"
+)
+
+const maxCommentLength = 10000
+
+// GetTodoComments retrieves a page of comments on a todo item. Top-level comments are
+// returned unless a "parent_id" query parameter is given, in which case the replies to
+// that comment are returned instead. Comments follow the access rules of the parent list.
+func GetTodoComments(c *fiber.Ctx) error {
+	db := database.DBConn
+	userID := c.Locals("userID").(string)
+
+	_, todo, err := findAccessibleTodo(db, userID, c.Params("list_id"), c.Params("task_id"), false)
+	if err != nil {
+		return sendAccessError(c, err)
+	}
+
+	pagination := utils.GetPagination(c)
+	query := db.Model(&models.Comment{}).Where("todo_id = ?", todo.ID)
+
+	if parentID := c.Query("parent_id"); parentID != "" {
+		query = query.Where("parent_id = ?", parentID)
+	} else {
+		query = query.Where("parent_id IS NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to count comments", err)
+	}
+
+	var comments []models.Comment
+	if err := query.
+		Preload("Author", func(db *gorm.DB) *gorm.DB {
+			return db.Select("id, name, email")
+		}).
+		Order("created_at ASC").
+		Limit(pagination.Limit).
+		Offset(pagination.Offset).
+		Find(&comments).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve comments", err)
+	}
+
+	// COUNT REPLIES FOR THE COMMENTS ON THIS PAGE IN ONE QUERY
+	commentIDs := make([]string, 0, len(comments))
+	for _, comment := range comments {
+		commentIDs = append(commentIDs, comment.ID)
+	}
+
+	replyCounts := make(map[string]int, len(comments))
+	if len(commentIDs) > 0 {
+		var counts []struct {
+			ParentID string
+			Count    int
+		}
+
+		if err := db.Model(&models.Comment{}).
+			Select("parent_id, COUNT(*) AS count").
+			Where("parent_id IN ?", commentIDs).
+			Group("parent_id").
+			Scan(&counts).Error; err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to count comment replies", err)
+		}
+
+		for _, count := range counts {
+			replyCounts[count.ParentID] = count.Count
+		}
+	}
+
+	response := make([]models.CommentResponse, 0, len(comments))
+	for _, comment := range comments {
+		item := toCommentResponse(comment)
+		item.ReplyCount = replyCounts[comment.ID]
+		response = append(response, item)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Comments retrieved successfully",
+		"data": fiber.Map{
+			"comments": response,
+			"count":    len(response),
+			"total":    total,
+			"page":     pagination.Page,
+			"limit":    pagination.Limit,
+		},
+		"status": fiber.StatusOK,
+	})
+}
+
+// CreateTodoComment adds a comment to a todo item. The body is required and is stored as
+// markdown. When "parent_id" is provided the comment is created as a reply to another
+// comment on the same todo.
+func CreateTodoComment(c *fiber.Ctx) error {
+	db := database.DBConn
+	userID := c.Locals("userID").(string)
+
+	todoList, todo, err := findAccessibleTodo(db, userID, c.Params("list_id"), c.Params("task_id"), false)
+	if err != nil {
+		return sendAccessError(c, err)
+	}
+
+	var request struct {
+		Body     string  `json:"body" validate:"required"`
+		ParentID *string `json:"parent_id,omitempty"`
+	}
+
+	if err := c.BodyParser(&request); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid request body", err)
+	}
+
+	if err := validateCommentBody(request.Body); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid comment body", err)
+	}
+
+	comment := models.Comment{
+		Body:     request.Body,
+		TodoID:   todo.ID,
+		AuthorID: userID,
+	}
+
+	if request.ParentID != nil && *request.ParentID != "" {
+		var parent models.Comment
+		if err := db.Where("id = ? AND todo_id = ?", *request.ParentID, todo.ID).First(&parent).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Parent comment not found on this todo", err)
+			}
+			return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve parent comment", err)
+		}
+		comment.ParentID = &parent.ID
+	}
+
+	if err := db.Create(&comment).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to create comment", err)
+	}
+
+	notifyMentions(db, userID, todoList, todo, comment, "")
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"message": "Comment created successfully",
+		"data":    toCommentResponse(comment),
+		"status":  fiber.StatusCreated,
+	})
+}
+
+// UpdateTodoComment edits the body of a comment. Only the author of a comment can edit it.
+func UpdateTodoComment(c *fiber.Ctx) error {
+	db := database.DBConn
+	userID := c.Locals("userID").(string)
+
+	todoList, todo, err := findAccessibleTodo(db, userID, c.Params("list_id"), c.Params("task_id"), false)
+	if err != nil {
+		return sendAccessError(c, err)
+	}
+
+	var request struct {
+		Body string `json:"body" validate:"required"`
+	}
+
+	if err := c.BodyParser(&request); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid request body", err)
+	}
+
+	if err := validateCommentBody(request.Body); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid comment body", err)
+	}
+
+	comment, err := findAuthoredComment(db, c.Params("comment_id"), todo.ID, userID)
+	if err != nil {
+		return sendCommentError(c, err)
+	}
+
+	previousBody := comment.Body
+
+	editedAt := time.Now()
+	if err := db.Model(comment).Updates(models.Comment{Body: request.Body, EditedAt: &editedAt}).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to update comment", err)
+	}
+
+	// ONLY USERS NEWLY MENTIONED BY THE EDIT ARE NOTIFIED
+	notifyMentions(db, userID, todoList, todo, *comment, previousBody)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Comment updated successfully",
+		"data":    toCommentResponse(*comment),
+		"status":  fiber.StatusOK,
+	})
+}
+
+// DeleteTodoComment deletes a comment. Only the author of a comment can delete it.
+// Replies to a deleted comment are kept so the rest of the thread is not lost: they move
+// up to the comment it answered, or become top-level comments, so listings still reach
+// them.
+func DeleteTodoComment(c *fiber.Ctx) error {
+	db := database.DBConn
+	userID := c.Locals("userID").(string)
+
+	_, todo, err := findAccessibleTodo(db, userID, c.Params("list_id"), c.Params("task_id"), false)
+	if err != nil {
+		return sendAccessError(c, err)
+	}
+
+	comment, err := findAuthoredComment(db, c.Params("comment_id"), todo.ID, userID)
+	if err != nil {
+		return sendCommentError(c, err)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Comment{}).Where("parent_id = ?", comment.ID).Update("parent_id", comment.ParentID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(comment).Error
+	})
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to delete comment", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Comment deleted successfully",
+		"data":    fiber.Map{"id": comment.ID},
+		"status":  fiber.StatusOK,
+	})
+}
+
+var (
+	ErrCommentNotFound  = errors.New("comment not found")
+	ErrCommentForbidden = errors.New("only the author can change this comment")
+)
+
+func findAuthoredComment(db *gorm.DB, commentID string, todoID string, userID string) (*models.Comment, error) {
+	var comment models.Comment
+
+	if err := db.Where("id = ? AND todo_id = ?", commentID, todoID).First(&comment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCommentNotFound
+		}
+		return nil, err
+	}
+
+	if comment.AuthorID != userID {
+		return nil, ErrCommentForbidden
+	}
+
+	return &comment, nil
+}
+
+func sendCommentError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, ErrCommentNotFound):
+		return utils.SendErrorResponse(c, fiber.StatusNotFound, "Comment not found", err)
+	case errors.Is(err, ErrCommentForbidden):
+		return utils.SendErrorResponse(c, fiber.StatusForbidden, "Permission denied", err)
+	default:
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve comment", err)
+	}
+}
+
+func validateCommentBody(body string) error {
+	if strings.TrimSpace(body) == "" {
+		return errors.New("comment body cannot be empty")
+	}
+
+	if len(body) > maxCommentLength {
+		return errors.New("comment body is too long")
+	}
+
+	return nil
+}
+
+func toCommentResponse(comment models.Comment) models.CommentResponse {
+	response := models.CommentResponse{
+		ID:        comment.ID,
+		Body:      comment.Body,
+		TodoID:    comment.TodoID,
+		ParentID:  comment.ParentID,
+		EditedAt:  comment.EditedAt,
+		CreatedAt: comment.CreatedAt,
+	}
+
+	if comment.Author != nil && comment.Author.ID != "" {
+		response.Author = &models.UserMinimal{
+			ID:    comment.Author.ID,
+			Name:  comment.Author.Name,
+			Email: comment.Author.Email,
+		}
+	} else {
+		response.Author = &models.UserMinimal{ID: comment.AuthorID}
+	}
+
+	return response
+}
+
+// mentionPattern matches mentions of users by email address in comments, e.g.
+// "@jane@example.com"
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@.])@([\w.+-]+@[\w-]+(?:\.[\w-]+)+)`)
+
+// commentMentions returns the lowercased email addresses mentioned in a comment body
+func commentMentions(body string) []string {
+	emails := []string{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		email := strings.ToLower(strings.TrimRight(match[1], "."))
+		if !slices.Contains(emails, email) {
+			emails = append(emails, email)
+		}
+	}
+	return emails
+}
+
+// notifyMentions notifies the users mentioned in a comment who were not mentioned in its
+// previous body. Users who cannot read the todo are not notified.
+func notifyMentions(db *gorm.DB, actorID string, todoList *models.TodoList, todo *models.Todo, comment models.Comment, previousBody string) {
+	previous := commentMentions(previousBody)
+
+	emails := []string{}
+	for _, email := range commentMentions(comment.Body) {
+		if !slices.Contains(previous, email) {
+			emails = append(emails, email)
+		}
+	}
+
+	if len(emails) == 0 {
+		return
+	}
+
+	var users []models.User
+	if err := db.Select("id").Where("LOWER(email) IN ?", emails).Find(&users).Error; err != nil {
+		log.Errorf("Failed to load users mentioned in comment %s: %v", comment.ID, err)
+		return
+	}
+
+	mentioned := []string{}
+	for _, user := range users {
+		canRead, _, err := utils.TodoListAccess(db, user.ID, todoList)
+		if err != nil {
+			log.Errorf("Failed to check access of user mentioned in comment %s: %v", comment.ID, err)
+			continue
+		}
+		if canRead {
+			mentioned = append(mentioned, user.ID)
+		}
+	}
+
+	notifyUsers(models.NotificationMention, actorID, mentioned, notify.Message{
+		Title: "You were mentioned on " + todo.Task,
+		Body:  comment.Body,
+		Data: map[string]interface{}{
+			"comment_id":   comment.ID,
+			"todo_id":      todo.ID,
+			"todo_list_id": todo.TodoListID,
+		},
+	})
+}
@@ -84,7 +84,7 @@ func GetRoleDetails(c *fiber.Ctx) error {
 }
 
 func CreateUserRoleMapping(c *fiber.Ctx) error {
-	db := database.DBConn
+	db := database.WithActor(database.DBConn, c.Locals("userID").(string))
 
 	var request struct {
 		RoleID  string `json:"role_id" validate:"required"`
@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thompsonmanda08/task-sync/database"
+	"github.com/thompsonmanda08/task-sync/models"
+	"github.com/thompsonmanda08/task-sync/utils"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrDependencyCycle  = errors.New("dependency would create a cycle")
+	ErrDependencyExists = errors.New("dependency already exists")
+)
+
+// GetTodoDependencies lists the todos a todo is blocked by ("blocked_by") and the todos
+// it blocks ("blocking"). Todos in lists the user cannot access are left out.
+func GetTodoDependencies(c *fiber.Ctx) error {
+	db := database.DBConn
+	userID := c.Locals("userID").(string)
+
+	_, todo, err := findAccessibleTodo(db, userID, c.Params("list_id"), c.Params("task_id"), false)
+	if err != nil {
+		return sendAccessError(c, err)
+	}
+
+	blockedBy, err := dependencyNodes(db, userID, "todo_dependencies.todo_id = ?", "todo_dependencies.depends_on_id", todo.ID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve dependencies", err)
+	}
+
+	blocking, err := dependencyNodes(db, userID, "todo_dependencies.depends_on_id = ?", "todo_dependencies.todo_id", todo.ID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve dependencies", err)
+	}
+
+	blocked := false
+	for _, node := range blockedBy {
+		if !node.IsCompleted {
+			blocked = true
+			break
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Dependencies retrieved successfully",
+		"data": fiber.Map{
+			"id":         todo.ID,
+			"blocked":    blocked,
+			"blocked_by": blockedBy,
+			"blocking":   blocking,
+		},
+		"status": fiber.StatusOK,
+	})
+}
+
+// CreateTodoDependency marks a todo as blocked by another todo ("depends_on_id"), which
+// may be in any list the user can access. The user needs write access to the blocked
+// todo's list. Dependencies that would create a cycle are refused with 409 Conflict.
+func CreateTodoDependency(c *fiber.Ctx) error {
+	db := database.DBConn
+	userID := c.Locals("userID").(string)
+
+	_, todo, err := findAccessibleTodo(db, userID, c.Params("list_id"), c.Params("task_id"), true)
+	if err != nil {
+		return sendAccessError(c, err)
+	}
+
+	var request struct {
+		ID          string `json:"id,omitempty"` // Client-generated ID, see utils.IsClientID; generated by the server when empty
+		DependsOnID string `json:"depends_on_id" validate:"required"`
+	}
+
+	if err := c.BodyParser(&request); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid request body", err)
+	}
+
+	if request.DependsOnID == "" {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "The todo this task depends on is required", errors.New("depends_on_id cannot be empty"))
+	}
+
+	_, dependsOn, err := findAccessibleTodoByID(db, userID, request.DependsOnID, false)
+	if err != nil {
+		return sendAccessError(c, err)
+	}
+
+	if request.ID != "" {
+		if err := utils.CheckNewID(db, &models.TodoDependency{}, request.ID); err != nil {
+			return sendNewIDError(c, err)
+		}
+	}
+
+	dependency := models.TodoDependency{
+		ID:          request.ID,
+		TodoID:      todo.ID,
+		DependsOnID: dependsOn.ID,
+		CreatedByID: userID,
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return addTodoDependency(tx, &dependency)
+	})
+
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrDependencyCycle):
+			return utils.SendErrorResponse(c, fiber.StatusConflict, "Dependency would create a cycle", err)
+		case errors.Is(err, ErrDependencyExists):
+			return utils.SendErrorResponse(c, fiber.StatusConflict, "Dependency already exists", err)
+		default:
+			return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to create dependency", err)
+		}
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"message": "Dependency created successfully",
+		"data":    dependency,
+		"status":  fiber.StatusCreated,
+	})
+}
+
+// DeleteTodoDependency removes the dependency of a todo on another todo
+func DeleteTodoDependency(c *fiber.Ctx) error {
+	db := database.DBConn
+	userID := c.Locals("userID").(string)
+
+	_, todo, err := findAccessibleTodo(db, userID, c.Params("list_id"), c.Params("task_id"), true)
+	if err != nil {
+		return sendAccessError(c, err)
+	}
+
+	result := db.Where("todo_id = ? AND depends_on_id = ?", todo.ID, c.Params("depends_on_id")).Delete(&models.TodoDependency{})
+	if result.Error != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to delete dependency", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return utils.SendErrorResponse(c, fiber.StatusNotFound, "Dependency not found", errors.New("dependency not found"))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Dependency deleted successfully",
+		"data":    fiber.Map{"todo_id": todo.ID, "depends_on_id": c.Params("depends_on_id")},
+		"status":  fiber.StatusOK,
+	})
+}
+
+// GetListDependencyGraph returns the dependency graph of a list for visualisation: every
+// todo of the list, the todos in other accessible lists they are linked to, and the
+// edges between them. An edge points from the blocked todo to the todo it depends on.
+func GetListDependencyGraph(c *fiber.Ctx) error {
+	db := database.DBConn
+	userID := c.Locals("userID").(string)
+
+	todoList, err := utils.FindAccessibleTodoList(db, userID, c.Params("list_id"), false)
+	if err != nil {
+		return sendAccessError(c, err)
+	}
+
+	listTodos := db.Model(&models.Todo{}).Select("id").Where("todo_list_id = ?", todoList.ID)
+
+	edges := []models.DependencyEdge{}
+	if err := db.Model(&models.TodoDependency{}).
+		Select("todo_dependencies.todo_id, todo_dependencies.depends_on_id").
+		Joins("JOIN todos AS blocked ON blocked.id = todo_dependencies.todo_id AND blocked.deleted_at IS NULL").
+		Joins("JOIN todos AS blocker ON blocker.id = todo_dependencies.depends_on_id AND blocker.deleted_at IS NULL").
+		Where("todo_dependencies.todo_id IN (?) OR todo_dependencies.depends_on_id IN (?)", listTodos, listTodos).
+		Where("blocked.todo_list_id IN (?) AND blocker.todo_list_id IN (?)", utils.AccessibleListIDs(db, userID), utils.AccessibleListIDs(db, userID)).
+		Scan(&edges).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve dependencies", err)
+	}
+
+	nodeIDs := make([]string, 0, len(edges)*2)
+	for _, edge := range edges {
+		nodeIDs = append(nodeIDs, edge.TodoID, edge.DependsOnID)
+	}
+
+	var todos []models.Todo
+	if err := db.Select("id, task, is_completed, todo_list_id").
+		Where("todo_list_id = ? OR id IN ?", todoList.ID, nodeIDs).
+		Order("position ASC, id ASC").
+		Find(&todos).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve todos", err)
+	}
+
+	completed := make(map[string]bool, len(todos))
+	for _, todo := range todos {
+		completed[todo.ID] = todo.IsCompleted
+	}
+
+	blocked := make(map[string]bool)
+	for _, edge := range edges {
+		if !completed[edge.DependsOnID] {
+			blocked[edge.TodoID] = true
+		}
+	}
+
+	nodes := make([]models.DependencyNode, 0, len(todos))
+	for _, todo := range todos {
+		nodes = append(nodes, models.DependencyNode{
+			ID:          todo.ID,
+			Task:        todo.Task,
+			IsCompleted: todo.IsCompleted,
+			TodoListID:  todo.TodoListID,
+			Blocked:     blocked[todo.ID],
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Dependency graph retrieved successfully",
+		"data": fiber.Map{
+			"nodes": nodes,
+			"edges": edges,
+		},
+		"status": fiber.StatusOK,
+	})
+}
+
+// addTodoDependency creates a dependency after checking it does not close a cycle. It
+// must run inside a transaction: a transaction-level advisory lock serialises dependency
+// changes so two concurrent inserts cannot create a cycle together.
+func addTodoDependency(tx *gorm.DB, dependency *models.TodoDependency) error {
+	if dependency.TodoID == dependency.DependsOnID {
+		return ErrDependencyCycle
+	}
+
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('todo_dependencies'))").Error; err != nil {
+		return err
+	}
+
+	var existing int64
+	if err := tx.Model(&models.TodoDependency{}).
+		Where("todo_id = ? AND depends_on_id = ?", dependency.TodoID, dependency.DependsOnID).
+		Count(&existing).Error; err != nil {
+		return err
+	}
+
+	if existing > 0 {
+		return ErrDependencyExists
+	}
+
+	// A cycle exists if the blocked todo is reachable from the todo it would depend on
+	var reachable int64
+	if err := tx.Raw(`
+		WITH RECURSIVE reachable AS (
+			SELECT depends_on_id AS id FROM todo_dependencies WHERE todo_id = ?
+			UNION
+			SELECT todo_dependencies.depends_on_id FROM todo_dependencies
+			JOIN reachable ON todo_dependencies.todo_id = reachable.id
+		)
+		SELECT COUNT(*) FROM reachable WHERE id = ?`, dependency.DependsOnID, dependency.TodoID).
+		Scan(&reachable).Error; err != nil {
+		return err
+	}
+
+	if reachable > 0 {
+		return ErrDependencyCycle
+	}
+
+	return tx.Omit("Todo", "DependsOn").Create(dependency).Error
+}
+
+// dependencyNodes loads the todos on the other side of a todo's dependencies. condition
+// selects the dependencies and column names the todo to load, restricted to lists the
+// user can access.
+func dependencyNodes(db *gorm.DB, userID string, condition string, column string, todoID string) ([]models.DependencyNode, error) {
+	nodes := []models.DependencyNode{}
+
+	err := db.Model(&models.TodoDependency{}).
+		Select("todos.id, todos.task, todos.is_completed, todos.todo_list_id").
+		Joins("JOIN todos ON todos.id = "+column+" AND todos.deleted_at IS NULL").
+		Where(condition, todoID).
+		Where("todos.todo_list_id IN (?)", utils.AccessibleListIDs(db, userID)).
+		Scan(&nodes).Error
+
+	return nodes, err
+}
+
+// blockedTodoIDs reports which of the given todos depend on at least one todo that is
+// not completed yet
+func blockedTodoIDs(db *gorm.DB, todoIDs []string) (map[string]bool, error) {
+	blocked := make(map[string]bool)
+	if len(todoIDs) == 0 {
+		return blocked, nil
+	}
+
+	var ids []string
+	if err := db.Model(&models.TodoDependency{}).
+		Distinct("todo_dependencies.todo_id").
+		Joins("JOIN todos AS blocker ON blocker.id = todo_dependencies.depends_on_id AND blocker.deleted_at IS NULL").
+		Where("todo_dependencies.todo_id IN ? AND blocker.is_completed = ?", todoIDs, false).
+		Pluck("todo_dependencies.todo_id", &ids).Error; err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		blocked[id] = true
+	}
+
+	return blocked, nil
+}
+
+// openBlockers returns the todos a todo depends on that are not completed yet
+func openBlockers(db *gorm.DB, todoID string) ([]models.DependencyNode, error) {
+	blockers := []models.DependencyNode{}
+
+	err := db.Model(&models.TodoDependency{}).
+		Select("todos.id, todos.task, todos.is_completed, todos.todo_list_id").
+		Joins("JOIN todos ON todos.id = todo_dependencies.depends_on_id AND todos.deleted_at IS NULL").
+		Where("todo_dependencies.todo_id = ? AND todos.is_completed = ?", todoID, false).
+		Scan(&blockers).Error
+
+	return blockers, err
+}
+
+// refuseBlockedCompletion sends a 409 listing the open todos a todo depends on, unless
+// the client confirms the completion with ?force=true. It reports whether a response
+// was sent, which the handler returns.
+func refuseBlockedCompletion(c *fiber.Ctx, db *gorm.DB, todoID string) (bool, error) {
+	if c.QueryBool("force") {
+		return false, nil
+	}
+
+	blockers, err := openBlockers(db, todoID)
+	if err != nil {
+		return true, utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve todo dependencies", err)
+	}
+
+	if len(blockers) == 0 {
+		return false, nil
+	}
+
+	return true, c.Status(fiber.StatusConflict).JSON(fiber.Map{
+		"success": false,
+		"message": "Todo is blocked by incomplete todos, retry with ?force=true to complete it anyway",
+		"data":    fiber.Map{"blocked_by": blockers},
+		"status":  fiber.StatusConflict,
+	})
+}
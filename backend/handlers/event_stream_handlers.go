@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/thompsonmanda08/task-sync/database"
+	"github.com/thompsonmanda08/task-sync/models"
+	"github.com/thompsonmanda08/task-sync/realtime"
+	"github.com/thompsonmanda08/task-sync/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	// Proxies commonly close connections idle for 60 seconds
+	eventStreamHeartbeat = 20 * time.Second
+	eventStreamRetry     = 3 * time.Second
+)
+
+// StreamEvents streams the change events of every list and group the user can access as
+// Server-Sent Events, for clients that cannot hold a WebSocket. Clients reconnecting with
+// a Last-Event-ID header receive the events they missed, or a reset event telling them to
+// sync when those are no longer available.
+func StreamEvents(c *fiber.Ctx) error {
+	db := database.DBConn
+	userID := c.Locals("userID").(string)
+
+	topics, err := accessibleTopics(db, userID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to load accessible lists and groups", err)
+	}
+
+	sub, missed, resumed := realtime.Default.Resume(userID, topics, c.Get("Last-Event-ID"))
+	position := realtime.Default.LastEventID()
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no") // Keep nginx from buffering the stream
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer sub.Close()
+
+		fmt.Fprintf(w, "retry: %d\n\n", eventStreamRetry.Milliseconds())
+
+		if !resumed {
+			writeStreamEvent(w, position, "reset", fiber.Map{"message": "Missed events are no longer available, sync to catch up"})
+		}
+		for _, event := range missed {
+			writeStreamEvent(w, realtime.Default.EventID(event), event.Type, event)
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(eventStreamHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case event, ok := <-sub.Events:
+				if !ok {
+					// THE CLIENT FELL BEHIND, IT RECONNECTS AND RESUMES
+					return
+				}
+				if event.Type == realtime.TypePresence {
+					// PRESENCE IS NOT REPLAYED, SO IT HAS NO ID TO RESUME FROM
+					writeStreamEvent(w, "", event.Type, event)
+					break
+				}
+				followAccess(db, sub, event)
+				writeStreamEvent(w, realtime.Default.EventID(event), event.Type, event)
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+			}
+
+			// WRITES FAIL ONCE THE CLIENT HAS GONE
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+
+	return nil
+}
+
+// writeStreamEvent writes one Server-Sent Event with a JSON payload, and an ID unless
+// id is empty
+func writeStreamEvent(w *bufio.Writer, id string, name string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Errorf("Failed to encode stream event: %v", err)
+		return
+	}
+
+	if id != "" {
+		fmt.Fprintf(w, "id: %s\n", id)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, payload)
+}
+
+// accessibleTopics returns the topics of every list and group a user can access, and
+// of the lists they own and memberships they hold so new ones are followed
+func accessibleTopics(db *gorm.DB, userID string) ([]string, error) {
+	var listIDs, groupIDs []string
+	if err := utils.AccessibleListIDs(db, userID).Pluck("todo_lists.id", &listIDs).Error; err != nil {
+		return nil, err
+	}
+	if err := utils.AccessibleGroupIDs(db, userID).Pluck("groups.id", &groupIDs).Error; err != nil {
+		return nil, err
+	}
+
+	topics := []string{realtime.Topic(realtime.TopicUser, userID)}
+	for _, id := range listIDs {
+		topics = append(topics, realtime.Topic(realtime.TopicList, id))
+	}
+	for _, id := range groupIDs {
+		topics = append(topics, realtime.Topic(realtime.TopicGroup, id))
+	}
+	return topics, nil
+}
+
+// followAccess keeps a stream subscribed to everything the user can access as lists are
+// created or moved and their memberships change
+func followAccess(db *gorm.DB, sub *realtime.Subscriber, event realtime.Event) {
+	switch {
+	case event.Type == "todo_list" && (event.Action == models.ChangeCreate || event.Action == models.ChangeRestore):
+		// THE EVENT CAME THROUGH THE OWNER OR GROUP OF THE LIST, SO THE USER CAN ACCESS IT
+		sub.Subscribe(realtime.Topic(realtime.TopicList, event.ID))
+	case event.Type == "todo_list" && slices.Contains(event.Fields, "group_id"),
+		event.Type == "group_member" && event.UserID == sub.UserID:
+		topics, err := accessibleTopics(db, sub.UserID)
+		if err != nil {
+			log.Errorf("Failed to refresh the event stream of user %s: %v", sub.UserID, err)
+			return
+		}
+		sub.SetTopics(topics)
+	}
+}
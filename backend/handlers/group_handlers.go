@@ -2,10 +2,12 @@ package handlers
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/thompsonmanda08/task-sync/database"
 	"github.com/thompsonmanda08/task-sync/models"
+	"github.com/thompsonmanda08/task-sync/notify"
 	"github.com/thompsonmanda08/task-sync/utils"
 	"gorm.io/gorm"
 )
@@ -18,11 +20,12 @@ import (
 // If there is an error while creating the group, the handler returns a JSON response
 // with a status code of 500 and the error message in the response body.
 func CreateNewGroup(c *fiber.Ctx) error {
-	db := database.DBConn
 	userID := c.Locals("userID").(string)
+	db := database.WithActor(database.DBConn, userID)
 
 	group := new(models.Group)
 	var request struct {
+		ID          string `json:"id,omitempty"` // Client-generated ID, see utils.IsClientID; generated by the server when empty
 		Name        string `json:"name" validate:"required"`
 		Description string `json:"description,omitempty"`
 	}
@@ -45,6 +48,14 @@ func CreateNewGroup(c *fiber.Ctx) error {
 		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve owner role", err)
 	}
 
+	// CLIENTS CREATING THE GROUP OFFLINE SUPPLY ITS ID
+	if request.ID != "" {
+		if err := utils.CheckNewID(db, &models.Group{}, request.ID); err != nil {
+			return sendNewIDError(c, err)
+		}
+		group.ID = request.ID
+	}
+
 	group.OwnerID = userID
 	group.Name = request.Name
 	group.Description = request.Description
@@ -133,6 +144,7 @@ func GetUserGroups(c *fiber.Ctx) error {
 				Name:  group.Name,
 				Email: group.Owner.Email,
 			},
+			Version: group.Version,
 			// OwnerID:       group.OwnerID,
 		}
 	}
@@ -216,6 +228,12 @@ func GetUserGroupDetails(c *fiber.Ctx) error {
 			Name:  group.Owner.Name,
 			Email: group.Owner.Email,
 		},
+		Version: group.Version,
+	}
+
+	// THE TAG COVERS THE MEMBERS AND LISTS TOO
+	if utils.NotModified(c, utils.RepresentationETag(group.Version, response)) {
+		return c.SendStatus(fiber.StatusNotModified)
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
@@ -235,8 +253,8 @@ func GetUserGroupDetails(c *fiber.Ctx) error {
 // returns the updated group details in the response.
 
 func UpdateUserGroup(c *fiber.Ctx) error {
-	db := database.DBConn
 	userID := c.Locals("userID").(string)
+	db := database.WithActor(database.DBConn, userID)
 	groupID := c.Params("group_id")
 
 	if groupID == "" {
@@ -277,7 +295,16 @@ func UpdateUserGroup(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := db.Model(&group).Updates(request).Error; err != nil {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// THE GROUP MUST STILL BE AT THE VERSION THE CLIENT EDITED
+		if err := checkIfMatch(c, tx, &models.Group{}, group.ID); err != nil {
+			return err
+		}
+
+		return tx.Model(&group).Updates(request).Error
+	})
+
+	if err != nil && !errors.Is(err, ErrVersionMismatch) {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
 			"message": "Failed to update group details",
@@ -286,6 +313,18 @@ func UpdateUserGroup(c *fiber.Ctx) error {
 		})
 	}
 
+	// RELOAD THE GROUP FOR THE VERSION SET BY THE DATABASE, OR THE CURRENT STATE ON A MISMATCH
+	mismatch := err != nil
+	if err := db.Preload("UserGroupRoleMappings.User", func(db *gorm.DB) *gorm.DB {
+		return db.Select("id, name, email")
+	}).Preload("UserGroupRoleMappings.Role", func(db *gorm.DB) *gorm.DB {
+		return db.Select("id, name")
+	}).Preload("TodoLists", func(db *gorm.DB) *gorm.DB {
+		return db.Select("id", "group_id")
+	}).Where("id = ?", group.ID).First(&group).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to get group details", err)
+	}
+
 	var groupMembers []models.UserMinimal
 	for _, mapping := range group.UserGroupRoleMappings {
 		// Ensure that the User and Role objects were successfully preloaded
@@ -304,10 +343,17 @@ func UpdateUserGroup(c *fiber.Ctx) error {
 		Name:          group.Name,
 		Description:   group.Description,
 		GroupMembers:  groupMembers,
-		MembersCount:  len(group.GroupMembers),
+		MembersCount:  len(groupMembers),
 		TodoListCount: len(*group.TodoLists),
+		Version:       group.Version,
 	}
 
+	if mismatch {
+		return sendPreconditionFailed(c, group.Version, response)
+	}
+
+	c.Set(fiber.HeaderETag, utils.ETag(group.Version))
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"success": true,
 		"message": "Group updated successfully",
@@ -323,8 +369,8 @@ func UpdateUserGroup(c *fiber.Ctx) error {
 // appropriate error message and status code. On successful deletion, it returns
 // the deleted group ID in the response.
 func DeleteGroup(c *fiber.Ctx) error {
-	db := database.DBConn
 	userID := c.Locals("userID").(string) // Get userID from JWT middleware
+	db := database.WithActor(database.DBConn, userID)
 	groupID := c.Params("group_id")
 
 	if groupID == "" {
@@ -388,8 +434,8 @@ func DeleteGroup(c *fiber.Ctx) error {
 // with a 400 Bad Request status. On successful invitation, the handler returns the invitee user ID and the group ID
 // in the response.
 func InviteUser(c *fiber.Ctx) error {
-	db := database.DBConn
 	userID := c.Locals("userID").(string) // Get userID from JWT middleware
+	db := database.WithActor(database.DBConn, userID)
 	groupID := c.Params("group_id")
 
 	if groupID == "" {
@@ -465,6 +511,12 @@ func InviteUser(c *fiber.Ctx) error {
 			"status": fiber.StatusInternalServerError,
 		})
 	}
+
+	notifyUsers(models.NotificationGroupInvite, userID, []string{invitee.ID}, notify.Message{
+		Title: "You were added to " + group.Name,
+		Body:  fmt.Sprintf("You are now a member of the group %s", group.Name),
+		Data:  map[string]interface{}{"group_id": group.ID},
+	})
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"success": true,
 		"message": "User invited to group successfully",
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thompsonmanda08/task-sync/database"
+	"github.com/thompsonmanda08/task-sync/models"
+	"github.com/thompsonmanda08/task-sync/utils"
+	"gorm.io/gorm"
+)
+
+// Fields that can be reverted to a previous value from the history
+var (
+	revertibleTodoFields     = []string{"task", "description", "is_completed", "start_date", "end_date", "all_day", "priority"}
+	revertibleTodoListFields = []string{"name", "description", "color"}
+)
+
+var (
+	ErrChangeNotFound      = errors.New("change not found")
+	ErrChangeNotRevertible = errors.New("change cannot be reverted")
+)
+
+// GetTodoHistory returns the change history of a todo, newest first and paginated
+func GetTodoHistory(c *fiber.Ctx) error {
+	db := database.DBConn
+	userID := c.Locals("userID").(string)
+
+	_, todo, err := findAccessibleTodo(db, userID, c.Params("list_id"), c.Params("task_id"), false)
+	if err != nil {
+		return sendAccessError(c, err)
+	}
+
+	return sendHistory(c, db, "todo", todo.ID)
+}
+
+// GetTodoListHistory returns the change history of a todo list, newest first and paginated
+func GetTodoListHistory(c *fiber.Ctx) error {
+	db := database.DBConn
+	userID := c.Locals("userID").(string)
+
+	todoList, err := utils.FindAccessibleTodoList(db, userID, c.Params("list_id"), false)
+	if err != nil {
+		return sendAccessError(c, err)
+	}
+
+	return sendHistory(c, db, "todo_list", todoList.ID)
+}
+
+// GetGroupHistory returns the change history of a group, newest first and paginated
+func GetGroupHistory(c *fiber.Ctx) error {
+	return sendHistory(c, database.DBConn, "group", c.Params("group_id"))
+}
+
+// RevertTodoChange sets a field of a todo back to the value it had before the given
+// change. The revert is itself recorded in the history. The user needs write access.
+// Reverting to completed is refused for a blocked todo unless ?force=true is set.
+func RevertTodoChange(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	db := database.WithActor(database.DBConn, userID)
+
+	_, todo, err := findAccessibleTodo(db, userID, c.Params("list_id"), c.Params("task_id"), true)
+	if err != nil {
+		return sendAccessError(c, err)
+	}
+
+	field, value, err := findRevert(db, "todo", todo.ID, c.Params("change_id"), revertibleTodoFields)
+	if err != nil {
+		return sendRevertError(c, err)
+	}
+
+	if field == "is_completed" && value == true && !todo.IsCompleted {
+		if refused, err := refuseBlockedCompletion(c, db, todo.ID); refused {
+			return err
+		}
+	}
+
+	if err := db.Model(&models.Todo{}).Where("id = ?", todo.ID).Update(field, value).Error; err != nil {
+		return sendRevertError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Change reverted successfully",
+		"data":    fiber.Map{"id": todo.ID, "field": field, "value": value},
+		"status":  fiber.StatusOK,
+	})
+}
+
+// RevertTodoListChange sets a field of a todo list back to the value it had before the
+// given change. Like other list updates, it is reserved to the owner.
+func RevertTodoListChange(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	db := database.WithActor(database.DBConn, userID)
+
+	var todoList models.TodoList
+	if err := db.Where("id = ? AND owner_id = ?", c.Params("list_id"), userID).First(&todoList).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.SendErrorResponse(c, fiber.StatusNotFound, "Todo List not found or not owned by user", errors.New("todo list not found"))
+		}
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve Todo List", err)
+	}
+
+	field, value, err := revertChange(db, &models.TodoList{}, "todo_list", todoList.ID, c.Params("change_id"), revertibleTodoListFields)
+	if err != nil {
+		return sendRevertError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Change reverted successfully",
+		"data":    fiber.Map{"id": todoList.ID, "field": field, "value": value},
+		"status":  fiber.StatusOK,
+	})
+}
+
+// sendHistory sends a page of the change history of a resource
+func sendHistory(c *fiber.Ctx, db *gorm.DB, resourceType string, resourceID string) error {
+	pagination := utils.GetPagination(c)
+
+	query := db.Model(&models.ChangeRecord{}).Where("resource_type = ? AND resource_id = ?", resourceType, resourceID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve history", err)
+	}
+
+	var records []models.ChangeRecord
+	if err := query.
+		Preload("Actor", func(db *gorm.DB) *gorm.DB {
+			return db.Select("id, name, email")
+		}).
+		Order("created_at DESC, id DESC").
+		Limit(pagination.Limit).
+		Offset(pagination.Offset).
+		Find(&records).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve history", err)
+	}
+
+	response := make([]models.ChangeRecordResponse, 0, len(records))
+	for _, record := range records {
+		response = append(response, toChangeRecordResponse(record))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "History retrieved successfully",
+		"data": fiber.Map{
+			"history": response,
+			"count":   len(response),
+			"total":   total,
+			"page":    pagination.Page,
+			"limit":   pagination.Limit,
+		},
+		"status": fiber.StatusOK,
+	})
+}
+
+// revertChange writes the old value of a field change back to the resource. It returns
+// the reverted field and the value it was set to.
+func revertChange(db *gorm.DB, model interface{}, resourceType string, resourceID string, changeID string, revertible []string) (string, interface{}, error) {
+	field, value, err := findRevert(db, resourceType, resourceID, changeID, revertible)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err := db.Model(model).Where("id = ?", resourceID).Update(field, value).Error; err != nil {
+		return "", nil, err
+	}
+
+	return field, value, nil
+}
+
+// findRevert returns the field of a change and the value it had before, checking that
+// the change can be reverted
+func findRevert(db *gorm.DB, resourceType string, resourceID string, changeID string, revertible []string) (string, interface{}, error) {
+	var record models.ChangeRecord
+	if err := db.Where("id = ? AND resource_type = ? AND resource_id = ?", changeID, resourceType, resourceID).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil, ErrChangeNotFound
+		}
+		return "", nil, err
+	}
+
+	if record.Action != models.ChangeUpdate || record.OldValue == nil || !slices.Contains(revertible, record.Field) {
+		return "", nil, fmt.Errorf("%w: only changes to %v can be reverted", ErrChangeNotRevertible, revertible)
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(*record.OldValue), &value); err != nil {
+		return "", nil, err
+	}
+
+	return record.Field, value, nil
+}
+
+func sendRevertError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, ErrChangeNotFound):
+		return utils.SendErrorResponse(c, fiber.StatusNotFound, "Change not found", err)
+	case errors.Is(err, ErrChangeNotRevertible):
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Change cannot be reverted", err)
+	default:
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to revert change", err)
+	}
+}
+
+func toChangeRecordResponse(record models.ChangeRecord) models.ChangeRecordResponse {
+	response := models.ChangeRecordResponse{
+		ID:           record.ID,
+		ResourceType: record.ResourceType,
+		ResourceID:   record.ResourceID,
+		Action:       record.Action,
+		Field:        record.Field,
+		CreatedAt:    record.CreatedAt,
+	}
+
+	if record.OldValue != nil {
+		response.OldValue = json.RawMessage(*record.OldValue)
+	}
+
+	if record.NewValue != nil {
+		response.NewValue = json.RawMessage(*record.NewValue)
+	}
+
+	if record.Actor != nil {
+		response.Actor = &models.UserMinimal{
+			ID:    record.Actor.ID,
+			Name:  record.Actor.Name,
+			Email: record.Actor.Email,
+		}
+	} else if record.ActorID != nil {
+		response.Actor = &models.UserMinimal{ID: *record.ActorID}
+	}
+
+	return response
+}
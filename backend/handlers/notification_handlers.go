@@ -0,0 +1,434 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/thompsonmanda08/task-sync/database"
+	"github.com/thompsonmanda08/task-sync/models"
+	"github.com/thompsonmanda08/task-sync/notify"
+	"github.com/thompsonmanda08/task-sync/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrUnknownNotificationEvent = errors.New("unknown notification event")
+
+// GetNotifications returns the user's notifications, newest first and paginated. With
+// "unread=true" only unread notifications are returned.
+func GetNotifications(c *fiber.Ctx) error {
+	db := database.DBConn
+	userID := c.Locals("userID").(string)
+	pagination := utils.GetPagination(c)
+
+	unreadOnly, err := utils.ParseBoolQuery(c, "unread")
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid filter", err)
+	}
+
+	query := db.Model(&models.Notification{}).Where("user_id = ?", userID)
+	if unreadOnly != nil && *unreadOnly {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve notifications", err)
+	}
+
+	var notifications []models.Notification
+	if err := query.
+		Order("created_at DESC, id DESC").
+		Limit(pagination.Limit).
+		Offset(pagination.Offset).
+		Find(&notifications).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve notifications", err)
+	}
+
+	unread, err := unreadNotificationCount(db, userID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to count unread notifications", err)
+	}
+
+	response := make([]models.NotificationResponse, 0, len(notifications))
+	for _, notification := range notifications {
+		response = append(response, toNotificationResponse(notification))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Notifications retrieved successfully",
+		"data": fiber.Map{
+			"notifications": response,
+			"count":         len(response),
+			"total":         total,
+			"unread":        unread,
+			"page":          pagination.Page,
+			"limit":         pagination.Limit,
+		},
+		"status": fiber.StatusOK,
+	})
+}
+
+// GetUnreadNotificationCount returns the number of unread notifications of the user
+func GetUnreadNotificationCount(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	unread, err := unreadNotificationCount(database.DBConn, userID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to count unread notifications", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Unread notifications counted successfully",
+		"data":    fiber.Map{"unread": unread},
+		"status":  fiber.StatusOK,
+	})
+}
+
+// MarkNotificationRead marks one of the user's notifications as read
+func MarkNotificationRead(c *fiber.Ctx) error {
+	db := database.DBConn
+	userID := c.Locals("userID").(string)
+
+	var notification models.Notification
+	if err := db.Where("id = ? AND user_id = ?", c.Params("notification_id"), userID).First(&notification).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.SendErrorResponse(c, fiber.StatusNotFound, "Notification not found", err)
+		}
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve notification", err)
+	}
+
+	if notification.ReadAt == nil {
+		now := time.Now()
+		if err := db.Model(&notification).Update("read_at", now).Error; err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to mark notification as read", err)
+		}
+		notification.ReadAt = &now
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Notification marked as read",
+		"data":    toNotificationResponse(notification),
+		"status":  fiber.StatusOK,
+	})
+}
+
+// MarkAllNotificationsRead marks all of the user's notifications as read
+func MarkAllNotificationsRead(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	result := database.DBConn.Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Update("read_at", time.Now())
+	if result.Error != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to mark notifications as read", result.Error)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Notifications marked as read",
+		"data":    fiber.Map{"marked": result.RowsAffected},
+		"status":  fiber.StatusOK,
+	})
+}
+
+// GetNotificationPreferences returns the channels the user is notified on for every
+// event, including the defaults of events without a preference
+func GetNotificationPreferences(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	channels, err := notificationChannels(database.DBConn, []string{userID}, models.NotificationEvents...)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve notification preferences", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Notification preferences retrieved successfully",
+		"data":    toNotificationPreferencesResponse(channels[userID]),
+		"status":  fiber.StatusOK,
+	})
+}
+
+// UpdateNotificationPreferences sets the channels the user is notified on for some
+// events. The body maps events to channels, e.g. {"mention": ["in_app", "email"]}; an
+// empty list turns the event off.
+func UpdateNotificationPreferences(c *fiber.Ctx) error {
+	db := database.DBConn
+	userID := c.Locals("userID").(string)
+
+	var request map[string][]string
+	if err := c.BodyParser(&request); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid request body", err)
+	}
+
+	preferences, err := parseNotificationPreferences(userID, request)
+	if err != nil {
+		return sendNotificationPreferenceError(c, err)
+	}
+
+	if err := saveNotificationPreferences(db, preferences); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to update notification preferences", err)
+	}
+
+	channels, err := notificationChannels(db, []string{userID}, models.NotificationEvents...)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve notification preferences", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Notification preferences updated successfully",
+		"data":    toNotificationPreferencesResponse(channels[userID]),
+		"status":  fiber.StatusOK,
+	})
+}
+
+// parseNotificationPreferences validates a map of events to channels, as accepted by
+// UpdateNotificationPreferences
+func parseNotificationPreferences(userID string, request map[string][]string) ([]models.NotificationPreference, error) {
+	preferences := make([]models.NotificationPreference, 0, len(request))
+	for event, channels := range request {
+		if !slices.Contains(models.NotificationEvents, event) {
+			return nil, fmt.Errorf("%w %q, expected one of %s", ErrUnknownNotificationEvent, event, strings.Join(models.NotificationEvents, ", "))
+		}
+
+		selected := []string{}
+		for _, channel := range channels {
+			if err := notify.Default.Check(channel); err != nil {
+				return nil, err
+			}
+			if !slices.Contains(selected, channel) {
+				selected = append(selected, channel)
+			}
+		}
+
+		preferences = append(preferences, models.NotificationPreference{
+			UserID:   userID,
+			Event:    event,
+			Channels: strings.Join(selected, ","),
+		})
+	}
+	return preferences, nil
+}
+
+func saveNotificationPreferences(db *gorm.DB, preferences []models.NotificationPreference) error {
+	if len(preferences) == 0 {
+		return nil
+	}
+
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "event"}},
+		DoUpdates: clause.AssignmentColumns([]string{"channels", "updated_at"}),
+	}).Create(&preferences).Error
+}
+
+func sendNotificationPreferenceError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, ErrUnknownNotificationEvent) {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid notification event", err)
+	}
+	return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid notification channel", err)
+}
+
+func unreadNotificationCount(db *gorm.DB, userID string) (int64, error) {
+	var unread int64
+	err := db.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&unread).Error
+	return unread, err
+}
+
+// notificationChannels returns, for each user and event, the channels the user is
+// notified on. Events without a preference use the default channels.
+func notificationChannels(db *gorm.DB, userIDs []string, events ...string) (map[string]map[string][]string, error) {
+	var preferences []models.NotificationPreference
+	if err := db.Where("user_id IN ? AND event IN ?", userIDs, events).Find(&preferences).Error; err != nil {
+		return nil, err
+	}
+
+	channels := make(map[string]map[string][]string, len(userIDs))
+	for _, userID := range userIDs {
+		channels[userID] = make(map[string][]string, len(events))
+		for _, event := range events {
+			channels[userID][event] = models.DefaultNotificationChannels
+		}
+	}
+
+	for _, preference := range preferences {
+		channels[preference.UserID][preference.Event] = preference.ChannelList()
+	}
+
+	return channels, nil
+}
+
+// notifyUsers notifies users of an event, on the channels each of them chose for it. The
+// actor is never notified of their own changes. In-app notifications are stored before
+// returning; the other channels are delivered in the background so requests do not wait
+// on mail servers or webhooks. Failures are logged, they never fail the request.
+func notifyUsers(event string, actorID string, userIDs []string, message notify.Message) {
+	db := database.DBConn
+
+	recipients := []string{}
+	for _, userID := range userIDs {
+		if userID != "" && userID != actorID && !slices.Contains(recipients, userID) {
+			recipients = append(recipients, userID)
+		}
+	}
+
+	if len(recipients) == 0 {
+		return
+	}
+
+	message.Type = event
+	if message.Data == nil {
+		message.Data = map[string]interface{}{}
+	}
+	if actorID != "" {
+		message.Data["actor_id"] = actorID
+	}
+
+	var users []models.User
+	if err := db.Select("id, name, email").Where("id IN ?", recipients).Find(&users).Error; err != nil {
+		log.Errorf("Failed to load users to notify of %s: %v", event, err)
+		return
+	}
+
+	channels, err := notificationChannels(db, recipients, event)
+	if err != nil {
+		log.Errorf("Failed to load notification preferences for %s: %v", event, err)
+		return
+	}
+
+	for _, user := range users {
+		background := []string{}
+		for _, channel := range channels[user.ID][event] {
+			if channel == notify.ChannelInApp {
+				if _, err := notify.Default.Send(context.Background(), user, []string{channel}, message); err != nil {
+					log.Errorf("Failed to notify user %s of %s: %v", user.ID, event, err)
+				}
+				continue
+			}
+			background = append(background, channel)
+		}
+
+		if len(background) > 0 {
+			go func(user models.User, channels []string) {
+				ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+				defer cancel()
+
+				if _, err := notify.Default.Send(ctx, user, channels, message); err != nil {
+					log.Errorf("Failed to notify user %s of %s: %v", user.ID, event, err)
+				}
+			}(user, background)
+		}
+	}
+}
+
+// notifyListChanged notifies the owner of a list, the users it is shared with and the
+// members of its group who can view it that someone else changed it. Users who have not
+// read the last notification about the list are not notified again, so a burst of
+// changes produces a single notification.
+func notifyListChanged(actorID string, listID string, summary string) {
+	db := database.DBConn
+
+	// DELETED LISTS ARE INCLUDED, TO REPORT THEIR DELETION
+	var list models.TodoList
+	if err := db.Unscoped().Select("id", "name", "owner_id", "group_id").Where("id = ?", listID).First(&list).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Errorf("Failed to load list %s to notify of changes: %v", listID, err)
+		}
+		return
+	}
+
+	var sharedWith []string
+	if err := db.Table("shared_with").Where("todo_list_id = ?", list.ID).Pluck("user_id", &sharedWith).Error; err != nil {
+		log.Errorf("Failed to load users list %s is shared with: %v", listID, err)
+		return
+	}
+
+	var members []string
+	if list.GroupID != nil {
+		if err := db.Model(&models.UserGroupRoleMapping{}).
+			Joins("JOIN role_permissions ON role_permissions.role_id = user_group_role_mappings.role_id").
+			Joins("JOIN permissions ON permissions.id = role_permissions.permission_id AND permissions.name = ?", "view").
+			Where("user_group_role_mappings.group_id = ?", *list.GroupID).
+			Distinct().
+			Pluck("user_group_role_mappings.user_id", &members).Error; err != nil {
+			log.Errorf("Failed to load members of the group of list %s: %v", listID, err)
+			return
+		}
+	}
+
+	// ONLY LISTS SHARED WITH OTHERS, DIRECTLY OR THROUGH A GROUP
+	audience := append(sharedWith, members...)
+	if len(audience) == 0 {
+		return
+	}
+
+	var pending []string
+	if err := db.Model(&models.Notification{}).
+		Where("type = ? AND read_at IS NULL AND data->>'todo_list_id' = ?", models.NotificationListChanged, list.ID).
+		Pluck("user_id", &pending).Error; err != nil {
+		log.Errorf("Failed to load pending notifications of list %s: %v", listID, err)
+		return
+	}
+
+	recipients := []string{}
+	for _, userID := range append(audience, list.OwnerID) {
+		if !slices.Contains(pending, userID) {
+			recipients = append(recipients, userID)
+		}
+	}
+
+	notifyUsers(models.NotificationListChanged, actorID, recipients, notify.Message{
+		Title: fmt.Sprintf("%s was changed", list.Name),
+		Body:  summary,
+		Data:  map[string]interface{}{"todo_list_id": list.ID},
+	})
+}
+
+func toNotificationResponse(notification models.Notification) models.NotificationResponse {
+	response := models.NotificationResponse{
+		ID:        notification.ID,
+		Type:      notification.Type,
+		Title:     notification.Title,
+		Body:      notification.Body,
+		ReadAt:    notification.ReadAt,
+		CreatedAt: notification.CreatedAt,
+	}
+
+	if notification.Data != nil {
+		response.Data = json.RawMessage(*notification.Data)
+	}
+
+	return response
+}
+
+func toNotificationPreferencesResponse(channels map[string][]string) []models.NotificationPreferenceResponse {
+	response := make([]models.NotificationPreferenceResponse, 0, len(models.NotificationEvents))
+	for _, event := range models.NotificationEvents {
+		response = append(response, models.NotificationPreferenceResponse{Event: event, Channels: channels[event]})
+	}
+	return response
+}
+
+// notifyAssigned notifies the assignee of a todo that it was assigned to them
+func notifyAssigned(actorID string, todo models.Todo) {
+	if todo.AssigneeID == nil {
+		return
+	}
+
+	notifyUsers(models.NotificationAssigned, actorID, []string{*todo.AssigneeID}, notify.Message{
+		Title: "Assigned to you: " + todo.Task,
+		Body:  fmt.Sprintf("%s was assigned to you", todo.Task),
+		Data:  map[string]interface{}{"todo_id": todo.ID, "todo_list_id": todo.TodoListID},
+	})
+}
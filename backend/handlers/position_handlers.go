@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thompsonmanda08/task-sync/database"
+	"github.com/thompsonmanda08/task-sync/models"
+	"github.com/thompsonmanda08/task-sync/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrNeighbourNotFound = errors.New("neighbour not found")
+
+type moveRequest struct {
+	BeforeID string `json:"before_id,omitempty"` // Item that should come directly before the moved one
+	AfterID  string `json:"after_id,omitempty"`  // Item that should come directly after the moved one
+}
+
+// MoveTodoItem moves a todo to a new place in its list. The request names the todo that
+// should come directly before it ("before_id"), directly after it ("after_id") or both;
+// with neither the todo is moved to the end of the list. Only the moved todo is
+// rewritten. Moves within a list are serialised with a row lock on the list, so
+// concurrent moves never produce the same position.
+func MoveTodoItem(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	db := database.WithActor(database.DBConn, userID)
+
+	_, todo, err := findAccessibleTodo(db, userID, c.Params("list_id"), c.Params("task_id"), true)
+	if err != nil {
+		return sendAccessError(c, err)
+	}
+
+	var request moveRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid request body", err)
+	}
+
+	if request.BeforeID == todo.ID || request.AfterID == todo.ID {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "A todo cannot be moved next to itself", errors.New("invalid neighbour"))
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := lockTodoList(tx, todo.TodoListID); err != nil {
+			return err
+		}
+
+		siblings := func() *gorm.DB {
+			return tx.Model(&models.Todo{}).Where("todo_list_id = ?", todo.TodoListID)
+		}
+
+		position, err := positionBetweenNeighbours(siblings, todo.ID, request.BeforeID, request.AfterID)
+		if err != nil {
+			return err
+		}
+
+		todo.Position = position
+		return tx.Model(todo).Update("position", position).Error
+	})
+
+	if err != nil {
+		return sendMoveError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Todo moved successfully",
+		"data":    fiber.Map{"id": todo.ID, "position": todo.Position},
+		"status":  fiber.StatusOK,
+	})
+}
+
+// MoveTodoList moves a todo list to a new place among the lists of its owner. It takes
+// the same "before_id"/"after_id" neighbours as MoveTodoItem. Only the owner of a list
+// can reorder it.
+func MoveTodoList(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	db := database.WithActor(database.DBConn, userID)
+	listID := c.Params("list_id")
+
+	var request moveRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid request body", err)
+	}
+
+	if request.BeforeID == listID || request.AfterID == listID {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "A todo list cannot be moved next to itself", errors.New("invalid neighbour"))
+	}
+
+	var todoList models.TodoList
+	if err := db.Where("id = ? AND owner_id = ?", listID, userID).First(&todoList).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.SendErrorResponse(c, fiber.StatusNotFound, "Todo List not found or not owned by user", err)
+		}
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve Todo List", err)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := lockOwnerLists(tx, userID); err != nil {
+			return err
+		}
+
+		siblings := func() *gorm.DB {
+			return tx.Model(&models.TodoList{}).Where("owner_id = ?", userID)
+		}
+
+		position, err := positionBetweenNeighbours(siblings, todoList.ID, request.BeforeID, request.AfterID)
+		if err != nil {
+			return err
+		}
+
+		todoList.Position = position
+		return tx.Model(&todoList).Update("position", position).Error
+	})
+
+	if err != nil {
+		return sendMoveError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Todo List moved successfully",
+		"data":    fiber.Map{"id": todoList.ID, "position": todoList.Position},
+		"status":  fiber.StatusOK,
+	})
+}
+
+// lockTodoList locks a todo list row until the end of the transaction, serialising
+// position changes of the todos in that list
+func lockTodoList(tx *gorm.DB, listID string) error {
+	var list models.TodoList
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", listID).First(&list).Error
+}
+
+// lockOwnerLists locks the owner's user row until the end of the transaction,
+// serialising position changes among the lists they own
+func lockOwnerLists(tx *gorm.DB, ownerID string) error {
+	var owner models.User
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", ownerID).First(&owner).Error
+}
+
+// nextTodoPosition returns a position after the last todo of a list. Callers must hold
+// the list lock.
+func nextTodoPosition(tx *gorm.DB, listID string) (string, error) {
+	var last string
+	if err := tx.Model(&models.Todo{}).
+		Where("todo_list_id = ?", listID).
+		Select("COALESCE(MAX(position), '')").
+		Scan(&last).Error; err != nil {
+		return "", err
+	}
+
+	return utils.PositionBetween(last, "")
+}
+
+// firstListPosition returns a position before the first list of an owner, so new lists
+// show up first. Callers must hold the owner lock.
+func firstListPosition(tx *gorm.DB, ownerID string) (string, error) {
+	var first string
+	if err := tx.Model(&models.TodoList{}).
+		Where("owner_id = ? AND position <> ''", ownerID).
+		Select("COALESCE(MIN(position), '')").
+		Scan(&first).Error; err != nil {
+		return "", err
+	}
+
+	return utils.PositionBetween("", first)
+}
+
+// positionBetweenNeighbours computes the new position of a moved item. siblings returns
+// a fresh query over the items sharing the moved item's ordering. When "before" is given
+// it is the anchor and the item lands directly after it, even if another item was placed
+// there since the client last synced.
+func positionBetweenNeighbours(siblings func() *gorm.DB, movedID string, beforeID string, afterID string) (string, error) {
+	var lower, upper string
+
+	switch {
+	case beforeID != "":
+		position, err := siblingPosition(siblings, beforeID)
+		if err != nil {
+			return "", err
+		}
+		lower = position
+
+		if err := siblings().
+			Where("id <> ? AND position > ?", movedID, lower).
+			Select("COALESCE(MIN(position), '')").
+			Scan(&upper).Error; err != nil {
+			return "", err
+		}
+
+	case afterID != "":
+		position, err := siblingPosition(siblings, afterID)
+		if err != nil {
+			return "", err
+		}
+		upper = position
+
+		if err := siblings().
+			Where("id <> ? AND position < ? AND position <> ''", movedID, upper).
+			Select("COALESCE(MAX(position), '')").
+			Scan(&lower).Error; err != nil {
+			return "", err
+		}
+
+	default:
+		// No neighbours, move to the end
+		if err := siblings().
+			Where("id <> ?", movedID).
+			Select("COALESCE(MAX(position), '')").
+			Scan(&lower).Error; err != nil {
+			return "", err
+		}
+	}
+
+	return utils.PositionBetween(lower, upper)
+}
+
+func siblingPosition(siblings func() *gorm.DB, id string) (string, error) {
+	var positions []string
+	if err := siblings().Where("id = ?", id).Pluck("position", &positions).Error; err != nil {
+		return "", err
+	}
+
+	if len(positions) == 0 {
+		return "", ErrNeighbourNotFound
+	}
+
+	return positions[0], nil
+}
+
+func sendMoveError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, ErrNeighbourNotFound):
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Neighbour not found in the same list", err)
+	case errors.Is(err, utils.ErrInvalidPosition):
+		return utils.SendErrorResponse(c, fiber.StatusConflict, "Neighbours are out of order, refresh and try again", err)
+	default:
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to move item", err)
+	}
+}
@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thompsonmanda08/task-sync/database"
+	"github.com/thompsonmanda08/task-sync/models"
+	"github.com/thompsonmanda08/task-sync/notify"
+	"github.com/thompsonmanda08/task-sync/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidPreference = errors.New("invalid preference")
+
+	digestFrequencies = []string{models.DigestOff, models.DigestDaily, models.DigestWeekly}
+)
+
+// digestSettingsRequest is the body of UpdateDigestSettings, and the "digest" field of
+// UpdateUserPreferences
+type digestSettingsRequest struct {
+	Frequency *string `json:"frequency"`
+	Hour      *int    `json:"hour"`
+	Weekday   *int    `json:"weekday"`
+	Timezone  *string `json:"timezone"`
+}
+
+// GetUserPreferences returns the user's preferences, including their notification and
+// digest settings
+func GetUserPreferences(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	response, err := userPreferencesResponse(database.DBConn, userID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve preferences", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Preferences retrieved successfully",
+		"data":    response,
+		"status":  fiber.StatusOK,
+	})
+}
+
+// UpdateUserPreferences changes some of the user's preferences: the IANA "timezone" due
+// dates are computed in, "week_start" (0 is Sunday), "date_format" (one of
+// models.DateFormats) and "default_list_id", a list the user can edit, or "" to clear
+// it. "notifications" and "digest" take the bodies of UpdateNotificationPreferences and
+// UpdateDigestSettings.
+func UpdateUserPreferences(c *fiber.Ctx) error {
+	db := database.DBConn
+	userID := c.Locals("userID").(string)
+
+	var request struct {
+		Timezone      *string               `json:"timezone"`
+		WeekStart     *int                  `json:"week_start"`
+		DateFormat    *string               `json:"date_format"`
+		DefaultListID *string               `json:"default_list_id"`
+		Notifications map[string][]string   `json:"notifications"`
+		Digest        digestSettingsRequest `json:"digest"`
+	}
+
+	if err := c.BodyParser(&request); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid request body", err)
+	}
+
+	preferences, err := findUserPreferences(db, userID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to update preferences", err)
+	}
+
+	if request.Timezone != nil {
+		if _, err := utils.LoadTimezone(*request.Timezone); err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid timezone", err)
+		}
+		preferences.Timezone = *request.Timezone
+	}
+
+	if request.WeekStart != nil {
+		if *request.WeekStart < 0 || *request.WeekStart > 6 {
+			return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid week start", errors.New("week_start must be between 0 (Sunday) and 6 (Saturday)"))
+		}
+		preferences.WeekStart = *request.WeekStart
+	}
+
+	if request.DateFormat != nil {
+		if _, ok := models.DateFormats[*request.DateFormat]; !ok {
+			return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid date format", fmt.Errorf("unknown date format %q", *request.DateFormat))
+		}
+		preferences.DateFormat = *request.DateFormat
+	}
+
+	if request.DefaultListID != nil {
+		preferences.DefaultListID = nil
+		if *request.DefaultListID != "" {
+			list, err := utils.FindAccessibleTodoList(db, userID, *request.DefaultListID, true)
+			if errors.Is(err, utils.ErrListNotFound) || errors.Is(err, utils.ErrListForbidden) {
+				return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid default list", err)
+			}
+			if err != nil {
+				return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to check todo list access", err)
+			}
+			preferences.DefaultListID = &list.ID
+		}
+	}
+
+	if err := applyDigestSettings(&preferences, request.Digest); err != nil {
+		return sendDigestSettingsError(c, err)
+	}
+
+	notifications, err := parseNotificationPreferences(userID, request.Notifications)
+	if err != nil {
+		return sendNotificationPreferenceError(c, err)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := saveUserPreferences(tx, &preferences,
+			"timezone", "week_start", "date_format", "default_list_id",
+			"digest_frequency", "digest_hour", "digest_weekday"); err != nil {
+			return err
+		}
+		return saveNotificationPreferences(tx, notifications)
+	})
+
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to update preferences", err)
+	}
+
+	response, err := userPreferencesResponse(db, userID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve preferences", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Preferences updated successfully",
+		"data":    response,
+		"status":  fiber.StatusOK,
+	})
+}
+
+// GetDigestSettings returns the user's digest email settings
+func GetDigestSettings(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+
+	preferences, err := findUserPreferences(database.DBConn, userID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve digest settings", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Digest settings retrieved successfully",
+		"data":    toDigestSettingsResponse(preferences),
+		"status":  fiber.StatusOK,
+	})
+}
+
+// UpdateDigestSettings changes the user's digest email settings: "frequency" (off, daily
+// or weekly), the local "hour" it is sent at, the "weekday" of weekly digests (0 is
+// Sunday) and the IANA "timezone" they are computed in.
+func UpdateDigestSettings(c *fiber.Ctx) error {
+	db := database.DBConn
+	userID := c.Locals("userID").(string)
+
+	var request digestSettingsRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid request body", err)
+	}
+
+	preferences, err := findUserPreferences(db, userID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to update digest settings", err)
+	}
+
+	if err := applyDigestSettings(&preferences, request); err != nil {
+		return sendDigestSettingsError(c, err)
+	}
+
+	if err := saveUserPreferences(db, &preferences, "timezone", "digest_frequency", "digest_hour", "digest_weekday"); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to update digest settings", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Digest settings updated successfully",
+		"data":    toDigestSettingsResponse(preferences),
+		"status":  fiber.StatusOK,
+	})
+}
+
+// applyDigestSettings validates digest settings and sets them on the preferences
+func applyDigestSettings(preferences *models.UserPreferences, request digestSettingsRequest) error {
+	if request.Frequency != nil {
+		if !slices.Contains(digestFrequencies, *request.Frequency) {
+			return fmt.Errorf("%w: unknown digest frequency %q, expected off, daily or weekly", ErrInvalidPreference, *request.Frequency)
+		}
+		if *request.Frequency != models.DigestOff && notify.Mail == nil {
+			return fmt.Errorf("digests: %w", notify.ErrChannelDisabled)
+		}
+		preferences.DigestFrequency = *request.Frequency
+	}
+
+	if request.Hour != nil {
+		if *request.Hour < 0 || *request.Hour > 23 {
+			return fmt.Errorf("%w: digest hour must be between 0 and 23", ErrInvalidPreference)
+		}
+		preferences.DigestHour = *request.Hour
+	}
+
+	if request.Weekday != nil {
+		if *request.Weekday < 0 || *request.Weekday > 6 {
+			return fmt.Errorf("%w: digest weekday must be between 0 (Sunday) and 6 (Saturday)", ErrInvalidPreference)
+		}
+		preferences.DigestWeekday = *request.Weekday
+	}
+
+	if request.Timezone != nil {
+		if _, err := utils.LoadTimezone(*request.Timezone); err != nil {
+			return err
+		}
+		preferences.Timezone = *request.Timezone
+	}
+
+	return nil
+}
+
+func sendDigestSettingsError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, notify.ErrChannelDisabled):
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Digests are not available on this server", err)
+	case errors.Is(err, utils.ErrInvalidTimezone):
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid timezone", err)
+	default:
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid digest settings", err)
+	}
+}
+
+// findUserPreferences loads the preferences of a user, or the defaults if they have
+// never changed any
+func findUserPreferences(db *gorm.DB, userID string) (models.UserPreferences, error) {
+	preferences := models.DefaultUserPreferences(userID)
+
+	if err := db.Where("user_id = ?", userID).Limit(1).Find(&preferences).Error; err != nil {
+		return preferences, fmt.Errorf("failed to retrieve preferences: %w", err)
+	}
+	return preferences, nil
+}
+
+// saveUserPreferences creates or updates the preferences of a user, writing the given
+// columns when they already exist
+func saveUserPreferences(db *gorm.DB, preferences *models.UserPreferences, columns ...string) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns(append(columns, "updated_at")),
+	}).Create(preferences).Error
+}
+
+// userLocation returns the timezone of a user, UTC when they have not set one or their
+// preferences cannot be loaded
+func userLocation(db *gorm.DB, userID string) *time.Location {
+	preferences, err := findUserPreferences(db, userID)
+	if err != nil {
+		return time.UTC
+	}
+
+	location, err := utils.LoadTimezone(preferences.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+func userPreferencesResponse(db *gorm.DB, userID string) (models.UserPreferencesResponse, error) {
+	preferences, err := findUserPreferences(db, userID)
+	if err != nil {
+		return models.UserPreferencesResponse{}, err
+	}
+
+	channels, err := notificationChannels(db, []string{userID}, models.NotificationEvents...)
+	if err != nil {
+		return models.UserPreferencesResponse{}, err
+	}
+
+	return models.UserPreferencesResponse{
+		Timezone:      preferences.Timezone,
+		WeekStart:     preferences.WeekStart,
+		DateFormat:    preferences.DateFormat,
+		DefaultListID: preferences.DefaultListID,
+		Notifications: toNotificationPreferencesResponse(channels[userID]),
+		Digest:        toDigestSettingsResponse(preferences),
+	}, nil
+}
+
+func toDigestSettingsResponse(preferences models.UserPreferences) models.DigestSettingsResponse {
+	return models.DigestSettingsResponse{
+		Frequency:    preferences.DigestFrequency,
+		Hour:         preferences.DigestHour,
+		Weekday:      preferences.DigestWeekday,
+		Timezone:     preferences.Timezone,
+		LastDigestAt: preferences.LastDigestAt,
+		Available:    notify.Mail != nil,
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/thompsonmanda08/task-sync/database"
+	"github.com/thompsonmanda08/task-sync/realtime"
+	"github.com/thompsonmanda08/task-sync/utils"
+)
+
+// A presenceSession is the presence of one realtime connection on the topics it views
+type presenceSession struct {
+	id     string
+	userID string
+
+	mu       sync.Mutex
+	topics   map[string]realtime.Presence
+	typingAt map[string]time.Time
+}
+
+func newPresenceSession(userID string) *presenceSession {
+	return &presenceSession{
+		id:       utils.GenerateCUID(),
+		userID:   userID,
+		topics:   map[string]realtime.Presence{},
+		typingAt: map[string]time.Time{},
+	}
+}
+
+// set announces what the session is doing on a topic, joining it if needed
+func (s *presenceSession) set(topic string, editingTodoID string, typing bool) {
+	s.mu.Lock()
+	presence, ok := s.topics[topic]
+	if !ok {
+		presence = realtime.Presence{SessionID: s.id, UserID: s.userID, Since: time.Now()}
+	}
+	presence.EditingTodoID = editingTodoID
+	presence.Typing = typing
+	s.topics[topic] = presence
+	if typing {
+		s.typingAt[topic] = time.Now()
+	}
+	s.mu.Unlock()
+
+	s.publish(realtime.PresenceUpdate, topic, presence)
+}
+
+// leave removes the session from a topic
+func (s *presenceSession) leave(topic string) {
+	s.mu.Lock()
+	presence, ok := s.topics[topic]
+	delete(s.topics, topic)
+	delete(s.typingAt, topic)
+	s.mu.Unlock()
+
+	if ok {
+		s.publish(realtime.PresenceLeave, topic, presence)
+	}
+}
+
+// leaveAll removes the session from every topic, when its connection closes
+func (s *presenceSession) leaveAll() {
+	s.mu.Lock()
+	topics := make([]string, 0, len(s.topics))
+	for topic := range s.topics {
+		topics = append(topics, topic)
+	}
+	s.mu.Unlock()
+
+	for _, topic := range topics {
+		s.leave(topic)
+	}
+}
+
+// refresh announces the session again on its topics so that its presence does not
+// expire. Typing indicators the client stopped repeating are dropped.
+func (s *presenceSession) refresh() {
+	s.mu.Lock()
+	presences := map[string]realtime.Presence{}
+	for topic, presence := range s.topics {
+		if presence.Typing && time.Since(s.typingAt[topic]) > realtime.TypingTimeout {
+			presence.Typing = false
+			s.topics[topic] = presence
+		}
+		presences[topic] = presence
+	}
+	s.mu.Unlock()
+
+	for topic, presence := range presences {
+		s.publish(realtime.PresenceUpdate, topic, presence)
+	}
+}
+
+func (s *presenceSession) publish(action string, topic string, presence realtime.Presence) {
+	if err := realtime.PublishPresence(action, topic, presence); err != nil {
+		log.Errorf("Failed to publish presence on %s: %v", topic, err)
+	}
+}
+
+// GetTodoListPresence returns who is viewing a todo list, and what they are editing, for
+// clients without a realtime connection
+func GetTodoListPresence(c *fiber.Ctx) error {
+	db := database.DBConn
+	userID := c.Locals("userID").(string)
+
+	list, err := utils.FindAccessibleTodoList(db, userID, c.Params("list_id"), false)
+	if err != nil {
+		return sendAccessError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Presence retrieved successfully",
+		"data":    realtime.Default.Presence(realtime.Topic(realtime.TopicList, list.ID)),
+		"status":  fiber.StatusOK,
+	})
+}
+
+// GetGroupPresence returns who is viewing a group
+func GetGroupPresence(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Presence retrieved successfully",
+		"data":    realtime.Default.Presence(realtime.Topic(realtime.TopicGroup, c.Params("group_id"))),
+		"status":  fiber.StatusOK,
+	})
+}
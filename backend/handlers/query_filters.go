@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thompsonmanda08/task-sync/database"
+	"github.com/thompsonmanda08/task-sync/models"
+	"github.com/thompsonmanda08/task-sync/utils"
+	"gorm.io/gorm"
+)
+
+// Sort keys accepted by the "sort" query parameter of the todo and list endpoints
+var (
+	todoSortFields = map[string]string{
+		"position":   "todos.position",
+		"priority":   models.PriorityRankSQL("todos.priority"),
+		"start_date": "todos.start_date",
+		"end_date":   "todos.end_date",
+		"task":       "todos.task",
+		"created_at": "todos.created_at",
+		"updated_at": "todos.updated_at",
+	}
+
+	todoListSortFields = map[string]string{
+		"position":   "todo_lists.position",
+		"name":       "todo_lists.name",
+		"created_at": "todo_lists.created_at",
+		"updated_at": "todo_lists.updated_at",
+	}
+)
+
+const (
+	defaultTodoSort     = "position"
+	defaultTodoListSort = "position,-created_at"
+)
+
+// filterTodos applies the todo query parameters to a query on the todos table:
+//
+//	completed=true|false          completion state
+//	priority=high,urgent          one of several priorities
+//	start_from, start_to          range of the start date (inclusive, a YYYY-MM-DD
+//	                              start_to includes the whole day)
+//	end_from, end_to              range of the end (due) date (inclusive, likewise)
+//	due=overdue|today|week        open todos past due, due today or due this week, in the
+//	                              user's timezone and week
+//	q=text                        case-insensitive match on the task and description
+//	updated_since=timestamp       todos changed after the given time
+func filterTodos(c *fiber.Ctx, query *gorm.DB) (*gorm.DB, error) {
+	completed, err := utils.ParseBoolQuery(c, "completed")
+	if err != nil {
+		return nil, err
+	}
+	if completed != nil {
+		query = query.Where("todos.is_completed = ?", *completed)
+	}
+
+	if raw := c.Query("priority"); raw != "" {
+		priorities := []string{}
+		for _, value := range strings.Split(raw, ",") {
+			priority := models.Priority(strings.ToLower(strings.TrimSpace(value)))
+			if priority.Rank() < 0 {
+				return nil, fmt.Errorf("%w: unknown priority %q", utils.ErrInvalidFilter, value)
+			}
+			priorities = append(priorities, string(priority))
+		}
+		query = query.Where("todos.priority IN ?", priorities)
+	}
+
+	ranges := []struct {
+		key    string
+		column string
+		end    bool // Closes the range, a date includes the whole day
+	}{
+		{"start_from", "todos.start_date", false},
+		{"start_to", "todos.start_date", true},
+		{"end_from", "todos.end_date", false},
+		{"end_to", "todos.end_date", true},
+	}
+
+	for _, r := range ranges {
+		if !r.end {
+			value, err := utils.ParseTimeQuery(c, r.key)
+			if err != nil {
+				return nil, err
+			}
+			if value != nil {
+				query = query.Where(r.column+" >= ?", *value)
+			}
+			continue
+		}
+
+		value, exclusive, err := utils.ParseTimeQueryEnd(c, r.key)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case value == nil:
+		case exclusive:
+			query = query.Where(r.column+" < ?", *value)
+		default:
+			query = query.Where(r.column+" <= ?", *value)
+		}
+	}
+
+	updatedSince, err := utils.ParseTimeQuery(c, "updated_since")
+	if err != nil {
+		return nil, err
+	}
+	if updatedSince != nil {
+		query = query.Where("todos.updated_at > ?", *updatedSince)
+	}
+
+	if due := c.Query("due"); due != "" {
+		preferences, _ := findUserPreferences(database.DBConn, c.Locals("userID").(string))
+		location, err := utils.LoadTimezone(preferences.Timezone)
+		if err != nil {
+			location = time.UTC
+		}
+		now := time.Now()
+
+		var condition string
+		var args []interface{}
+
+		switch due {
+		case "overdue":
+			condition, args = models.OverdueSQL(now, location)
+		case "today":
+			condition, args = models.DueOnSQL(now, location, 0, 1)
+		case "week":
+			// FROM THE FIRST DAY OF THE USER'S WEEK
+			start := -((int(now.In(location).Weekday()) - preferences.WeekStart + 7) % 7)
+			condition, args = models.DueOnSQL(now, location, start, start+7)
+		default:
+			return nil, fmt.Errorf("%w: due must be overdue, today or week", utils.ErrInvalidFilter)
+		}
+
+		query = query.Where("todos.is_completed = false").Where(condition, args...)
+	}
+
+	if text := strings.TrimSpace(c.Query("q")); text != "" {
+		pattern := utils.LikePattern(text)
+		query = query.Where("todos.task ILIKE ? OR todos.description ILIKE ?", pattern, pattern)
+	}
+
+	return query, nil
+}
+
+// filterTodoLists applies the list query parameters to a query on the todo_lists table:
+//
+//	completed=true|false          lists whose todos are all completed, or that have open todos
+//	q=text                        case-insensitive match on the name and description
+//	updated_since=timestamp       lists changed after the given time
+func filterTodoLists(c *fiber.Ctx, query *gorm.DB) (*gorm.DB, error) {
+	completed, err := utils.ParseBoolQuery(c, "completed")
+	if err != nil {
+		return nil, err
+	}
+	if completed != nil {
+		openTodos := "EXISTS (SELECT 1 FROM todos WHERE todos.todo_list_id = todo_lists.id AND todos.is_completed = false AND todos.deleted_at IS NULL)"
+		if *completed {
+			query = query.Where("NOT " + openTodos)
+		} else {
+			query = query.Where(openTodos)
+		}
+	}
+
+	updatedSince, err := utils.ParseTimeQuery(c, "updated_since")
+	if err != nil {
+		return nil, err
+	}
+	if updatedSince != nil {
+		query = query.Where("todo_lists.updated_at > ?", *updatedSince)
+	}
+
+	if text := strings.TrimSpace(c.Query("q")); text != "" {
+		pattern := utils.LikePattern(text)
+		query = query.Where("todo_lists.name ILIKE ? OR todo_lists.description ILIKE ?", pattern, pattern)
+	}
+
+	return query, nil
+}
+
+// todoSortValues returns the values of the sort fields for a todo, for its cursor
+func todoSortValues(todo models.Todo, fields []utils.SortField) []interface{} {
+	values := make([]interface{}, 0, len(fields))
+	for _, field := range fields {
+		switch field.Name {
+		case "position":
+			values = append(values, todo.Position)
+		case "priority":
+			values = append(values, todo.Priority.Rank())
+		case "start_date":
+			values = append(values, todo.StartDate)
+		case "end_date":
+			values = append(values, todo.EndDate)
+		case "task":
+			values = append(values, todo.Task)
+		case "created_at":
+			values = append(values, todo.CreatedAt)
+		case "updated_at":
+			values = append(values, todo.UpdatedAt)
+		}
+	}
+	return values
+}
+
+// todoListSortValues returns the values of the sort fields for a todo list, for its cursor
+func todoListSortValues(list models.TodoList, fields []utils.SortField) []interface{} {
+	values := make([]interface{}, 0, len(fields))
+	for _, field := range fields {
+		switch field.Name {
+		case "position":
+			values = append(values, list.Position)
+		case "name":
+			values = append(values, list.Name)
+		case "created_at":
+			values = append(values, list.CreatedAt)
+		case "updated_at":
+			values = append(values, list.UpdatedAt)
+		}
+	}
+	return values
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/thompsonmanda08/task-sync/database"
+	"github.com/thompsonmanda08/task-sync/models"
+	"github.com/thompsonmanda08/task-sync/realtime"
+	"github.com/thompsonmanda08/task-sync/utils"
+)
+
+const (
+	realtimePingInterval = realtime.PresenceRefresh // Presence is refreshed with every ping
+	realtimeReadTimeout  = 60 * time.Second         // Clients must answer pings within this time
+	realtimeWriteTimeout = 10 * time.Second
+	realtimeOutbox       = 16
+)
+
+// A realtimeRequest is a message from a client: {"type": "subscribe", "topic": "list:<id>"}
+type realtimeRequest struct {
+	Type  string `json:"type"` // subscribe, unsubscribe, presence or leave
+	Topic string `json:"topic"`
+
+	// What the user is doing on the topic, for presence messages
+	Editing string `json:"editing,omitempty"` // The ID of the todo open for editing
+	Typing  bool   `json:"typing,omitempty"`
+}
+
+// A realtimeMessage is a message to a client: the answer to a request, an event or the
+// presence of a topic
+type realtimeMessage struct {
+	Type      string              `json:"type"` // connected, subscribed, unsubscribed, error, event or presence
+	SessionID string              `json:"session_id,omitempty"`
+	Topic     string              `json:"topic,omitempty"`
+	Message   string              `json:"message,omitempty"`
+	Event     *realtime.Event     `json:"event,omitempty"`
+	Presence  []realtime.Presence `json:"presence,omitempty"`
+}
+
+// RequireWebSocket rejects requests that are not WebSocket upgrades
+func RequireWebSocket(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return utils.SendErrorResponse(c, fiber.StatusUpgradeRequired, "This endpoint only accepts WebSocket connections", fiber.ErrUpgradeRequired)
+	}
+	return c.Next()
+}
+
+// ServeRealtime streams the events of the lists and groups a client subscribes to. The
+// user is checked for access on every subscription, and again whenever their group
+// memberships change.
+//
+// Clients also announce their presence on the topics they subscribed to, with what they
+// are editing and whether they are typing, and receive the presence of the topic
+// whenever it changes. Presence ends when the client leaves the topic or disconnects.
+func ServeRealtime(conn *websocket.Conn) {
+	userID := conn.Locals("userID").(string)
+
+	sub := realtime.Default.Add(userID)
+	defer sub.Close()
+
+	session := newPresenceSession(userID)
+	defer session.leaveAll()
+
+	outbox := make(chan realtimeMessage, realtimeOutbox)
+	done := make(chan struct{})
+	written := make(chan struct{})
+
+	// THE CONNECTION IS RELEASED WHEN THIS RETURNS, SO WAIT FOR THE WRITER TO STOP
+	defer func() {
+		close(done)
+		<-written
+	}()
+
+	// CLIENTS TELL THEIR OWN SESSION APART IN PRESENCE BY ITS ID
+	outbox <- realtimeMessage{Type: "connected", SessionID: session.id}
+
+	// ONE WRITER, WEBSOCKET CONNECTIONS DO NOT SUPPORT CONCURRENT WRITES
+	go func() {
+		defer close(written)
+
+		ticker := time.NewTicker(realtimePingInterval)
+		defer ticker.Stop()
+		defer conn.Close()
+
+		for {
+			var err error
+			conn.SetWriteDeadline(time.Now().Add(realtimeWriteTimeout))
+
+			select {
+			case <-done:
+				return
+			case message := <-outbox:
+				err = conn.WriteJSON(message)
+			case event, ok := <-sub.Events:
+				if !ok {
+					// THE CLIENT FELL BEHIND, IT RECONNECTS AND SYNCS
+					conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too many pending events"))
+					return
+				}
+				if event.Type == realtime.TypePresence {
+					err = conn.WriteJSON(realtimeMessage{Type: "presence", Topic: event.Topic, Presence: event.Presence})
+					break
+				}
+				if event.Type == "group_member" && event.UserID == userID && event.Action != models.ChangeCreate {
+					recheckSubscriptions(sub, session, outbox)
+				}
+				err = conn.WriteJSON(realtimeMessage{Type: "event", Event: &event})
+			case <-ticker.C:
+				session.refresh()
+				err = conn.WriteMessage(websocket.PingMessage, nil)
+			}
+
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	conn.SetReadDeadline(time.Now().Add(realtimeReadTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(realtimeReadTimeout))
+	})
+
+	send := func(message realtimeMessage) bool {
+		select {
+		case outbox <- message:
+			return true
+		case <-done:
+			return false
+		}
+	}
+
+	for {
+		var request realtimeRequest
+		if err := conn.ReadJSON(&request); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Debugf("Realtime connection of user %s ended: %v", userID, err)
+			}
+			return
+		}
+
+		if _, _, err := realtime.ParseTopic(request.Topic); err != nil {
+			send(realtimeMessage{Type: "error", Topic: request.Topic, Message: err.Error()})
+			continue
+		}
+
+		replies := []realtimeMessage{}
+		switch request.Type {
+		case "subscribe":
+			allowed, err := canAccessTopic(userID, request.Topic)
+			switch {
+			case err != nil:
+				replies = append(replies, realtimeMessage{Type: "error", Topic: request.Topic, Message: "Failed to check access to the topic"})
+			case !allowed:
+				replies = append(replies, realtimeMessage{Type: "error", Topic: request.Topic, Message: "Topic not found"})
+			default:
+				sub.Subscribe(request.Topic)
+				replies = append(replies,
+					realtimeMessage{Type: "subscribed", Topic: request.Topic},
+					realtimeMessage{Type: "presence", Topic: request.Topic, Presence: realtime.Default.Presence(request.Topic)},
+				)
+			}
+		case "unsubscribe":
+			session.leave(request.Topic)
+			sub.Unsubscribe(request.Topic)
+			replies = append(replies, realtimeMessage{Type: "unsubscribed", Topic: request.Topic})
+		case "presence":
+			switch {
+			case !slices.Contains(sub.Topics(), request.Topic):
+				replies = append(replies, realtimeMessage{Type: "error", Topic: request.Topic, Message: "Subscribe to the topic before announcing presence on it"})
+			case request.Editing != "" && !utils.IsClientID(request.Editing):
+				replies = append(replies, realtimeMessage{Type: "error", Topic: request.Topic, Message: "Invalid todo ID in editing"})
+			default:
+				session.set(request.Topic, request.Editing, request.Typing)
+			}
+		case "leave":
+			session.leave(request.Topic)
+		default:
+			replies = append(replies, realtimeMessage{Type: "error", Topic: request.Topic, Message: "Invalid message type, must be subscribe, unsubscribe, presence or leave"})
+		}
+
+		for _, reply := range replies {
+			if !send(reply) {
+				return
+			}
+		}
+	}
+}
+
+// canAccessTopic checks that a user can read the list or group of a topic
+func canAccessTopic(userID string, topic string) (bool, error) {
+	db := database.DBConn
+
+	prefix, id, err := realtime.ParseTopic(topic)
+	if err != nil {
+		return false, err
+	}
+
+	if prefix == realtime.TopicList {
+		_, err := utils.FindAccessibleTodoList(db, userID, id, false)
+		if errors.Is(err, utils.ErrListNotFound) || errors.Is(err, utils.ErrListForbidden) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	var count int64
+	err = db.Model(&models.Group{}).
+		Where("id = ? AND id IN (?)", id, utils.AccessibleGroupIDs(db, userID)).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// recheckSubscriptions drops the topics a user lost access to, after one of their group
+// memberships changed, along with their presence there. Clients are told with an
+// unsubscribed message.
+func recheckSubscriptions(sub *realtime.Subscriber, session *presenceSession, outbox chan realtimeMessage) {
+	for _, topic := range sub.Topics() {
+		allowed, err := canAccessTopic(sub.UserID, topic)
+		if err != nil || allowed {
+			continue
+		}
+
+		session.leave(topic)
+		sub.Unsubscribe(topic)
+		select {
+		case outbox <- realtimeMessage{Type: "unsubscribed", Topic: topic, Message: "Access to the topic was revoked"}:
+		default:
+		}
+	}
+}
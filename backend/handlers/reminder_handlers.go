@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thompsonmanda08/task-sync/database"
+	"github.com/thompsonmanda08/task-sync/models"
+	"github.com/thompsonmanda08/task-sync/notify"
+	"github.com/thompsonmanda08/task-sync/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxRemindersPerTodo   = 10
+	maxReminderAttempts   = 5
+	reminderBatchSize     = 50
+	maxReminderOffsetDays = 365
+
+	// How long a claimed reminder is left to its delivery, longer than the timeouts of the
+	// mail and webhook channels
+	reminderLease = 5 * time.Minute
+)
+
+// GetTodoReminders lists the user's reminders on a todo
+func GetTodoReminders(c *fiber.Ctx) error {
+	db := database.DBConn
+	userID := c.Locals("userID").(string)
+
+	_, todo, err := findAccessibleTodo(db, userID, c.Params("list_id"), c.Params("task_id"), false)
+	if err != nil {
+		return sendAccessError(c, err)
+	}
+
+	var reminders []models.Reminder
+	if err := db.Where("todo_id = ? AND user_id = ?", todo.ID, userID).
+		Order("due_at ASC NULLS LAST, created_at ASC").
+		Find(&reminders).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve reminders", err)
+	}
+
+	response := make([]models.ReminderResponse, 0, len(reminders))
+	for _, reminder := range reminders {
+		response = append(response, toReminderResponse(reminder))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Reminders retrieved successfully",
+		"data":    response,
+		"status":  fiber.StatusOK,
+	})
+}
+
+// CreateTodoReminder sets a reminder on a todo for the user, either at a fixed time
+// ("remind_at") or a number of minutes before the todo's end date ("offset_minutes").
+// "channels" selects how the reminder is delivered, in-app by default. Any user who can
+// read the todo can set reminders on it.
+func CreateTodoReminder(c *fiber.Ctx) error {
+	db := database.DBConn
+	userID := c.Locals("userID").(string)
+
+	_, todo, err := findAccessibleTodo(db, userID, c.Params("list_id"), c.Params("task_id"), false)
+	if err != nil {
+		return sendAccessError(c, err)
+	}
+
+	var request struct {
+		RemindAt      *time.Time `json:"remind_at"`
+		OffsetMinutes *int       `json:"offset_minutes"`
+		Channels      []string   `json:"channels"`
+	}
+
+	if err := c.BodyParser(&request); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid request body", err)
+	}
+
+	// 1. EXACTLY ONE OF THE TWO KINDS OF REMINDER
+	if (request.RemindAt == nil) == (request.OffsetMinutes == nil) {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Either remind_at or offset_minutes is required", errors.New("set exactly one of remind_at and offset_minutes"))
+	}
+
+	if request.RemindAt != nil && !request.RemindAt.After(time.Now()) {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Reminder time must be in the future", errors.New("remind_at is in the past"))
+	}
+
+	if request.OffsetMinutes != nil && (*request.OffsetMinutes < 0 || *request.OffsetMinutes > maxReminderOffsetDays*24*60) {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid reminder offset", fmt.Errorf("offset_minutes must be between 0 and %d", maxReminderOffsetDays*24*60))
+	}
+
+	// 2. THE CHANNELS MUST BE AVAILABLE ON THIS SERVER
+	channels := []string{}
+	for _, channel := range request.Channels {
+		channel = strings.TrimSpace(channel)
+		if err := notify.Default.Check(channel); err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid notification channel", err)
+		}
+		if !slices.Contains(channels, channel) {
+			channels = append(channels, channel)
+		}
+	}
+	if len(channels) == 0 {
+		channels = []string{notify.ChannelInApp}
+	}
+
+	// 3. LIMIT THE REMINDERS A USER CAN SET ON A TODO
+	var count int64
+	if err := db.Model(&models.Reminder{}).Where("todo_id = ? AND user_id = ?", todo.ID, userID).Count(&count).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to create reminder", err)
+	}
+
+	if count >= maxRemindersPerTodo {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Too many reminders on this todo", fmt.Errorf("a todo can have at most %d reminders per user", maxRemindersPerTodo))
+	}
+
+	reminder := models.Reminder{
+		TodoID:        todo.ID,
+		UserID:        userID,
+		RemindAt:      request.RemindAt,
+		OffsetMinutes: request.OffsetMinutes,
+		Channels:      strings.Join(channels, ","),
+		DueAt:         models.ReminderDueAt(request.RemindAt, request.OffsetMinutes, todo.EndDate),
+	}
+
+	if err := db.Create(&reminder).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to create reminder", err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"message": "Reminder created successfully",
+		"data":    toReminderResponse(reminder),
+		"status":  fiber.StatusCreated,
+	})
+}
+
+// DeleteTodoReminder deletes one of the user's reminders on a todo
+func DeleteTodoReminder(c *fiber.Ctx) error {
+	db := database.DBConn
+	userID := c.Locals("userID").(string)
+
+	_, todo, err := findAccessibleTodo(db, userID, c.Params("list_id"), c.Params("task_id"), false)
+	if err != nil {
+		return sendAccessError(c, err)
+	}
+
+	result := db.Where("id = ? AND todo_id = ? AND user_id = ?", c.Params("reminder_id"), todo.ID, userID).Delete(&models.Reminder{})
+	if result.Error != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to delete reminder", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return utils.SendErrorResponse(c, fiber.StatusNotFound, "Reminder not found", errors.New("reminder not found"))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Reminder deleted successfully",
+		"data":    fiber.Map{"id": c.Params("reminder_id")},
+		"status":  fiber.StatusOK,
+	})
+}
+
+// DeliverDueReminders sends the reminders due at the given time and returns how many
+// were delivered. Reminders are claimed in batches with FOR UPDATE SKIP LOCKED and leased
+// for the time of their delivery, which is made after the claim commits so no locks or
+// connections are held while mail and webhook servers answer. Any number of app
+// instances can run it at once, and a reminder whose instance died is delivered once its
+// lease ends, so delivery is at least once. Reminders of completed or deleted todos are
+// not sent; failed deliveries are retried with a growing delay, up to
+// maxReminderAttempts times. Leases and retry delays are kept in next_attempt_at, so
+// due_at stays the time the reminder fires.
+func DeliverDueReminders(ctx context.Context, db *gorm.DB, notifier *notify.Notifier, now time.Time) (int, error) {
+	delivered := 0
+
+	for {
+		var reminders []models.Reminder
+		err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Table: clause.Table{Name: "reminders"}, Options: "SKIP LOCKED"}).
+				Joins("JOIN todos ON todos.id = reminders.todo_id AND todos.deleted_at IS NULL AND todos.is_completed = false").
+				Where("reminders.sent_at IS NULL AND reminders.due_at <= ? AND reminders.attempts < ?", now, maxReminderAttempts).
+				Where("reminders.next_attempt_at IS NULL OR reminders.next_attempt_at <= ?", now).
+				Preload("Todo.TodoList").
+				Preload("User").
+				Order("reminders.due_at ASC").
+				Limit(reminderBatchSize).
+				Find(&reminders).Error; err != nil {
+				return err
+			}
+
+			if len(reminders) == 0 {
+				return nil
+			}
+
+			ids := make([]string, 0, len(reminders))
+			for _, reminder := range reminders {
+				ids = append(ids, reminder.ID)
+			}
+
+			// THE LEASE OUTLASTS THE DELIVERY, WHICH IS MADE OUTSIDE OF THE TRANSACTION
+			return tx.Model(&models.Reminder{}).Where("id IN ?", ids).Update("next_attempt_at", time.Now().Add(reminderLease)).Error
+		})
+		if err != nil {
+			return delivered, err
+		}
+
+		// A SLOW MAIL OR WEBHOOK SERVER DOES NOT HOLD UP THE OTHER REMINDERS OF THE BATCH
+		var wg sync.WaitGroup
+		sent := make([]bool, len(reminders))
+		errs := make([]error, len(reminders))
+		for i := range reminders {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				sent[i], errs[i] = deliverReminder(ctx, db, notifier, reminders[i])
+			}(i)
+		}
+		wg.Wait()
+
+		for i := range reminders {
+			if sent[i] {
+				delivered++
+			}
+		}
+		if err := errors.Join(errs...); err != nil {
+			return delivered, err
+		}
+
+		if len(reminders) < reminderBatchSize || ctx.Err() != nil {
+			return delivered, nil
+		}
+	}
+}
+
+// deliverReminder sends a claimed reminder and records the outcome. It reports whether
+// the reminder reached at least one of its channels.
+func deliverReminder(ctx context.Context, db *gorm.DB, notifier *notify.Notifier, reminder models.Reminder) (bool, error) {
+	now := time.Now()
+	db = db.WithContext(ctx)
+
+	if reminder.Todo == nil || reminder.User == nil {
+		return false, db.Model(&reminder).Updates(map[string]interface{}{"sent_at": now, "last_error": "todo or user no longer exists"}).Error
+	}
+
+	// THE USER MAY HAVE LOST ACCESS TO THE TODO SINCE SETTING THE REMINDER
+	canRead, _, err := utils.TodoListAccess(db, reminder.UserID, &reminder.Todo.TodoList)
+	if err != nil {
+		return false, err
+	}
+
+	if !canRead {
+		return false, db.Model(&reminder).Updates(map[string]interface{}{"sent_at": now, "last_error": "user no longer has access to the todo"}).Error
+	}
+
+	body := fmt.Sprintf("%s in %s", reminder.Todo.Task, reminder.Todo.TodoList.Name)
+	if reminder.Todo.EndDate.Year() > 1 {
+		body = fmt.Sprintf("%s in %s is due %s", reminder.Todo.Task, reminder.Todo.TodoList.Name, reminder.Todo.EndDate.UTC().Format("Mon, 02 Jan 2006 15:04 MST"))
+	}
+
+	sent, sendErr := notifier.Send(ctx, *reminder.User, reminder.ChannelList(), notify.Message{
+		Type:  models.NotificationReminder,
+		Title: "Reminder: " + reminder.Todo.Task,
+		Body:  body,
+		Data: map[string]interface{}{
+			"reminder_id":  reminder.ID,
+			"todo_id":      reminder.TodoID,
+			"todo_list_id": reminder.Todo.TodoListID,
+		},
+	})
+
+	lastError := ""
+	if sendErr != nil {
+		lastError = sendErr.Error()
+	}
+
+	// A REMINDER THAT REACHED ANY CHANNEL IS DONE, RETRYING WOULD DUPLICATE IT ON THE OTHERS
+	if len(sent) > 0 {
+		return true, db.Model(&reminder).Updates(map[string]interface{}{"sent_at": now, "last_error": lastError}).Error
+	}
+
+	attempts := reminder.Attempts + 1
+	return false, db.Model(&reminder).Updates(map[string]interface{}{
+		"attempts":        attempts,
+		"last_error":      lastError,
+		"next_attempt_at": now.Add(time.Duration(attempts*attempts) * time.Minute),
+	}).Error
+}
+
+func toReminderResponse(reminder models.Reminder) models.ReminderResponse {
+	return models.ReminderResponse{
+		ID:            reminder.ID,
+		TodoID:        reminder.TodoID,
+		RemindAt:      reminder.RemindAt,
+		OffsetMinutes: reminder.OffsetMinutes,
+		Channels:      reminder.ChannelList(),
+		DueAt:         reminder.DueAt,
+		SentAt:        reminder.SentAt,
+		CreatedAt:     reminder.CreatedAt,
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
 	"github.com/thompsonmanda08/task-sync/database"
 	"github.com/thompsonmanda08/task-sync/middleware"
@@ -22,26 +23,82 @@ func SetupRoutes(app *fiber.App) {
 	route.Post("/login", LogUserIn)
 	route.Post("/register", RegisterNewUser)
 	route.Get("/roles", GetRoles)
+	route.Get("/attachments/:attachment_id/download", DownloadAttachment) // Authorized by a signed URL
+	route.Get("/avatars/:avatar_id/:size", GetProfileImage)
 
 	// PRIVATE HANDLERS
-	private := route.Group("/", middleware.JWTMiddleware)
+	private := route.Group("/", middleware.JWTMiddleware, middleware.Idempotency(db))
 
 	private.Get("/user", GetUserProfile)
 	private.Patch("/user", UpdateUserProfile)
 	private.Patch("/user/change-password", ChangeUserPassword)
 	private.Patch("/user/profile-picture", UpdateProfileImage)
 
+	private.Get("/search", Search)
+
+	private.Get("/ws", RequireWebSocket, websocket.New(ServeRealtime))
+	private.Get("/events", StreamEvents)
+
+	private.Get("/sync", GetSync)
+	private.Post("/sync/push", PushSyncChanges)
+
+	private.Get("/trash", GetTrash)
+	private.Post("/trash/lists/:list_id/restore", RestoreTodoList)
+	private.Delete("/trash/lists/:list_id", PurgeTodoList)
+	private.Post("/trash/todos/:task_id/restore", RestoreTodoItem)
+	private.Delete("/trash/todos/:task_id", PurgeTodoItem)
+
 	private.Get("/lists", GetTodoLists)
 	private.Post("/list", CreateNewTodoList)
 	private.Get("/list/:list_id", GetTodoList)
 	private.Patch("/list/:list_id", UpdateTodoList)
 	private.Delete("/list/:list_id", DeleteTodoList)
+	private.Post("/list/:list_id/move", MoveTodoList)
+	private.Get("/list/:list_id/dependencies", GetListDependencyGraph)
+	private.Get("/list/:list_id/history", GetTodoListHistory)
+	private.Get("/list/:list_id/presence", GetTodoListPresence)
+	private.Post("/list/:list_id/history/:change_id/revert", RevertTodoListChange)
 
 	private.Get("/list/:list_id/todos", GetTodoItems)
 	private.Post("/list/:list_id/todo", CreateNewTodoItem)
 	private.Get("/list/:list_id/todo/:task_id", GetTodoItem)
 	private.Patch("/list/:list_id/todo/:task_id", UpdateTodoItem)
 	private.Delete("/list/:list_id/todo/:task_id", DeleteTodoItem)
+	private.Post("/list/:list_id/todo/:task_id/move", MoveTodoItem)
+	private.Post("/list/:list_id/todo/:task_id/move-to", MoveTodoToList)
+	private.Post("/list/:list_id/todo/:task_id/copy", CopyTodoToList)
+
+	private.Get("/list/:list_id/todo/:task_id/comments", GetTodoComments)
+	private.Post("/list/:list_id/todo/:task_id/comments", CreateTodoComment)
+	private.Patch("/list/:list_id/todo/:task_id/comments/:comment_id", UpdateTodoComment)
+	private.Delete("/list/:list_id/todo/:task_id/comments/:comment_id", DeleteTodoComment)
+
+	private.Get("/list/:list_id/todo/:task_id/attachments", GetTodoAttachments)
+	private.Post("/list/:list_id/todo/:task_id/attachments", UploadTodoAttachment)
+	private.Delete("/list/:list_id/todo/:task_id/attachments/:attachment_id", DeleteTodoAttachment)
+
+	private.Get("/list/:list_id/todo/:task_id/dependencies", GetTodoDependencies)
+	private.Post("/list/:list_id/todo/:task_id/dependencies", CreateTodoDependency)
+	private.Delete("/list/:list_id/todo/:task_id/dependencies/:depends_on_id", DeleteTodoDependency)
+
+	private.Get("/list/:list_id/todo/:task_id/history", GetTodoHistory)
+	private.Post("/list/:list_id/todo/:task_id/history/:change_id/revert", RevertTodoChange)
+
+	private.Get("/list/:list_id/todo/:task_id/reminders", GetTodoReminders)
+	private.Post("/list/:list_id/todo/:task_id/reminders", CreateTodoReminder)
+	private.Delete("/list/:list_id/todo/:task_id/reminders/:reminder_id", DeleteTodoReminder)
+
+	private.Get("/preferences", GetUserPreferences)
+	private.Patch("/preferences", UpdateUserPreferences)
+
+	private.Get("/notifications", GetNotifications)
+	private.Get("/notifications/unread-count", GetUnreadNotificationCount)
+	private.Post("/notifications/read-all", MarkAllNotificationsRead)
+	private.Get("/notifications/preferences", GetNotificationPreferences)
+	private.Patch("/notifications/preferences", UpdateNotificationPreferences)
+	private.Get("/notifications/digest", GetDigestSettings)
+	private.Patch("/notifications/digest", UpdateDigestSettings)
+	private.Post("/notifications/:notification_id/read", MarkNotificationRead)
 
 	// GROUP HANDLERS
 	groups := private.Group("/groups")
@@ -50,10 +107,23 @@ func SetupRoutes(app *fiber.App) {
 	groups.Get("/:group_id", middleware.RequireGroupPermission(db, "view"), GetUserGroupDetails)
 	groups.Patch("/:group_id", middleware.RequireGroupPermission(db, "view", "edit"), UpdateUserGroup)
 	groups.Delete("/:group_id", middleware.RequireGroupPermission(db, "view", "edit", "delete_group"), DeleteGroup)
+	groups.Get("/:group_id/history", middleware.RequireGroupPermission(db, "view"), GetGroupHistory)
+	groups.Get("/:group_id/activity", middleware.RequireGroupPermission(db, "view"), GetGroupActivity)
+	groups.Get("/:group_id/presence", middleware.RequireGroupPermission(db, "view"), GetGroupPresence)
 
 	groups.Post("/:group_id/role/mapping", middleware.RequireGroupPermission(db, "change_role"), CreateUserRoleMapping)
 	groups.Post("/:group_id/invite", middleware.RequireGroupPermission(db, "invite"), InviteUser)
 
+	// GROUP WEBHOOK HANDLERS
+	manageWebhooks := middleware.RequireGroupPermission(db, "manage_webhooks")
+	groups.Get("/:group_id/webhooks", manageWebhooks, GetGroupWebhooks)
+	groups.Post("/:group_id/webhooks", manageWebhooks, CreateGroupWebhook)
+	groups.Patch("/:group_id/webhooks/:webhook_id", manageWebhooks, UpdateGroupWebhook)
+	groups.Delete("/:group_id/webhooks/:webhook_id", manageWebhooks, DeleteGroupWebhook)
+	groups.Post("/:group_id/webhooks/:webhook_id/rotate-secret", manageWebhooks, RotateWebhookSecret)
+	groups.Get("/:group_id/webhooks/:webhook_id/deliveries", manageWebhooks, GetWebhookDeliveries)
+	groups.Post("/:group_id/webhooks/:webhook_id/deliveries/:delivery_id/redeliver", manageWebhooks, RedeliverWebhookDelivery)
+
 	// group.Use(middleware.RequireGroupPermission(db, "edit"))
 
 }
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thompsonmanda08/task-sync/database"
+	"github.com/thompsonmanda08/task-sync/models"
+	"github.com/thompsonmanda08/task-sync/utils"
+)
+
+const maxSearchQueryLength = 256
+
+// searchSources holds, for every searchable resource type, the query selecting its
+// matches. Each query can use the parsed query as search.query, the @lists subquery of
+// the lists the user can access and the @groups subquery of the user's groups.
+var searchSources = map[string]string{
+	"todo": `
+		SELECT 'todo' AS type, todos.id, todos.task AS title, concat_ws(' ', todos.task, todos.description) AS body,
+			todos.todo_list_id AS list_id, todos.id AS todo_id, NULL AS group_id,
+			ts_rank(todos.search_vector, search.query) AS rank, todos.updated_at
+		FROM todos, search
+		WHERE todos.search_vector @@ search.query AND todos.deleted_at IS NULL AND todos.todo_list_id IN (@lists)`,
+	"list": `
+		SELECT 'list' AS type, todo_lists.id, todo_lists.name AS title, concat_ws(' ', todo_lists.name, todo_lists.description) AS body,
+			todo_lists.id AS list_id, NULL AS todo_id, todo_lists.group_id,
+			ts_rank(todo_lists.search_vector, search.query) AS rank, todo_lists.updated_at
+		FROM todo_lists, search
+		WHERE todo_lists.search_vector @@ search.query AND todo_lists.deleted_at IS NULL AND todo_lists.id IN (@lists)`,
+	"group": `
+		SELECT 'group' AS type, groups.id, groups.name AS title, concat_ws(' ', groups.name, groups.description) AS body,
+			NULL AS list_id, NULL AS todo_id, groups.id AS group_id,
+			ts_rank(groups.search_vector, search.query) AS rank, groups.updated_at
+		FROM groups, search
+		WHERE groups.search_vector @@ search.query AND groups.deleted_at IS NULL AND groups.id IN (@groups)`,
+	"comment": `
+		SELECT 'comment' AS type, comments.id, todos.task AS title, comments.body,
+			todos.todo_list_id AS list_id, todos.id AS todo_id, NULL AS group_id,
+			ts_rank(comments.search_vector, search.query) AS rank, comments.updated_at
+		FROM comments JOIN todos ON todos.id = comments.todo_id AND todos.deleted_at IS NULL, search
+		WHERE comments.search_vector @@ search.query AND comments.deleted_at IS NULL AND todos.todo_list_id IN (@lists)`,
+}
+
+// searchTypes is the order the resource types are listed in
+var searchTypes = []string{"todo", "list", "group", "comment"}
+
+// escapeHTMLSQL returns an SQL expression escaping the HTML special characters of a text
+// expression. Snippets are escaped before the matches are wrapped in <mark> tags, so
+// clients can render them as HTML without running markup written by other users.
+func escapeHTMLSQL(expression string) string {
+	return fmt.Sprintf("replace(replace(replace(%s, '&', '&amp;'), '<', '&lt;'), '>', '&gt;')", expression)
+}
+
+// Search runs a full-text search over the todos, todo lists, groups and comments the user
+// can access, through ownership, sharing or group membership. The "q" parameter accepts
+// web search syntax ("quoted phrases", OR, -excluded); "type" restricts the search to a
+// comma separated set of resource types. Results are ranked by relevance and carry an
+// HTML-escaped snippet with the matches wrapped in <mark> tags.
+func Search(c *fiber.Ctx) error {
+	db := database.DBConn
+	userID := c.Locals("userID").(string)
+
+	text := strings.TrimSpace(c.Query("q"))
+	if text == "" {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Search query is required", errors.New("q cannot be empty"))
+	}
+
+	if len(text) > maxSearchQueryLength {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Search query is too long", fmt.Errorf("q cannot be longer than %d characters", maxSearchQueryLength))
+	}
+
+	types := searchTypes
+	if raw := c.Query("type"); raw != "" {
+		types = []string{}
+		for _, value := range strings.Split(raw, ",") {
+			value = strings.TrimSpace(value)
+			if _, ok := searchSources[value]; !ok {
+				return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid search type", fmt.Errorf("unknown type %q, expected one of %s", value, strings.Join(searchTypes, ", ")))
+			}
+			if !slices.Contains(types, value) {
+				types = append(types, value)
+			}
+		}
+	}
+
+	sources := make([]string, 0, len(types))
+	for _, searchType := range types {
+		sources = append(sources, searchSources[searchType])
+	}
+
+	pagination := utils.GetPagination(c)
+
+	// RANK AND PAGINATE FIRST, SO SNIPPETS ARE ONLY BUILT FOR THE RETURNED PAGE
+	query := fmt.Sprintf(`
+		WITH search AS (SELECT websearch_to_tsquery('%[1]s', @text) AS query),
+		matches AS (%[2]s)
+		SELECT page.type, page.id, page.title, page.list_id, page.todo_id, page.group_id, page.rank, page.total,
+			ts_headline('%[1]s', %[3]s, search.query, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=20, MinWords=5') AS snippet
+		FROM (
+			SELECT matches.*, COUNT(*) OVER () AS total FROM matches
+			ORDER BY rank DESC, updated_at DESC, id ASC
+			LIMIT @limit OFFSET @offset
+		) AS page, search
+		ORDER BY page.rank DESC, page.updated_at DESC, page.id ASC`,
+		database.SearchConfig, strings.Join(sources, " UNION ALL "), escapeHTMLSQL("page.body"))
+
+	var rows []struct {
+		models.SearchResult
+		Total int64
+	}
+
+	if err := db.Raw(query,
+		sql.Named("text", text),
+		sql.Named("lists", utils.AccessibleListIDs(db, userID)),
+		sql.Named("groups", utils.AccessibleGroupIDs(db, userID)),
+		sql.Named("limit", pagination.Limit),
+		sql.Named("offset", pagination.Offset),
+	).Scan(&rows).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to search", err)
+	}
+
+	results := make([]models.SearchResult, 0, len(rows))
+	var total int64
+	for _, row := range rows {
+		results = append(results, row.SearchResult)
+		total = row.Total
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Search completed successfully",
+		"data": fiber.Map{
+			"results": results,
+			"count":   len(results),
+			"total":   total,
+			"page":    pagination.Page,
+			"limit":   pagination.Limit,
+		},
+		"status": fiber.StatusOK,
+	})
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thompsonmanda08/task-sync/database"
+	"github.com/thompsonmanda08/task-sync/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TestSearchEscapesSnippets needs a Postgres database, e.g. the postgres service of
+// docker-compose:
+//
+//	TEST_DATABASE_DSN="host=localhost user=postgres password=... dbname=postgres sslmode=disable" go test ./handlers
+//
+// Its rows are written in a transaction that is rolled back.
+func TestSearchEscapesSnippets(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Role{}, &models.Permission{}, &models.Group{}, &models.TodoList{}, &models.Todo{},
+		&models.UserGroupRoleMapping{}, &models.Comment{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.CreateSearchIndexes(db); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := db.Begin()
+	t.Cleanup(func() { tx.Rollback() })
+
+	previous := database.DBConn
+	database.DBConn = tx
+	t.Cleanup(func() { database.DBConn = previous })
+
+	create := func(value interface{}) {
+		t.Helper()
+		if err := tx.Omit(clause.Associations).Create(value).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	user := models.User{Name: "Searcher", Email: "searcher-" + time.Now().Format("150405.000000000") + "@example.com"}
+	create(&user)
+	list := models.TodoList{Name: "Work", OwnerID: user.ID}
+	create(&list)
+	todo := models.Todo{Task: `<script>alert("x")</script> quarterly report`, TodoListID: list.ID}
+	create(&todo)
+	create(&models.Comment{Body: `<img src=x onerror=alert(1)> report & summary`, TodoID: todo.ID, AuthorID: user.ID})
+
+	app := fiber.New()
+	app.Get("/search", func(c *fiber.Ctx) error {
+		c.Locals("userID", user.ID)
+		return c.Next()
+	}, Search)
+
+	response, err := app.Test(httptest.NewRequest("GET", "/search?q=report", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", response.StatusCode, fiber.StatusOK)
+	}
+
+	var body struct {
+		Data struct {
+			Results []models.SearchResult `json:"results"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	snippets := map[string]string{}
+	for _, result := range body.Data.Results {
+		snippets[result.Type] = result.Snippet
+	}
+
+	tests := []struct {
+		name     string
+		snippet  string
+		contains []string
+	}{
+		{
+			name:     "todo",
+			snippet:  snippets["todo"],
+			contains: []string{`&lt;script&gt;`, `&lt;/script&gt;`, `<mark>report</mark>`},
+		},
+		{
+			name:     "comment",
+			snippet:  snippets["comment"],
+			contains: []string{`&lt;img`, `&gt;`, `&amp;`, `<mark>report</mark>`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.snippet == "" {
+				t.Fatalf("no %s result", test.name)
+			}
+			for _, text := range test.contains {
+				if !strings.Contains(test.snippet, text) {
+					t.Errorf("snippet %q does not contain %q", test.snippet, text)
+				}
+			}
+
+			// NO MARKUP BUT THE <mark> TAGS IS LEFT
+			unmarked := strings.NewReplacer("<mark>", "", "</mark>", "").Replace(test.snippet)
+			if strings.ContainsAny(unmarked, "<>") {
+				t.Errorf("snippet %q contains unescaped markup", test.snippet)
+			}
+		})
+	}
+}
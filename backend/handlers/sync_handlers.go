@@ -0,0 +1,456 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thompsonmanda08/task-sync/database"
+	"github.com/thompsonmanda08/task-sync/models"
+	"github.com/thompsonmanda08/task-sync/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultSyncLimit = 500
+	maxSyncLimit     = 2000
+
+	// Changes committed late, by slow transactions or app instances with skewed clocks,
+	// are caught by re-reading this much of the window before a cursor. Clients receive
+	// such rows twice, which is harmless as rows are sent whole.
+	syncOverlap = 30 * time.Second
+)
+
+var ErrInvalidSyncCursor = errors.New("invalid sync cursor")
+
+// A syncCursor marks how far a client has synced: every change up to Since. While the
+// client pages through the changes up to Until, After is the last change it received.
+type syncCursor struct {
+	Since time.Time   `json:"s"`
+	Until *time.Time  `json:"u,omitempty"`
+	After *syncChange `json:"a,omitempty"`
+}
+
+// A syncChange is an entry of the change stream: a row that changed, or that the user
+// gained or lost access to, at ChangedAt
+type syncChange struct {
+	Kind      string    `json:"k"`
+	ID        string    `json:"i"`
+	ChangedAt time.Time `json:"t"`
+}
+
+// syncChangesSQL selects the change stream of a user, ordered by the time of the change.
+// Besides the rows that changed in the window it includes:
+//   - the group, memberships, lists and todos of groups the user joined, so they are
+//     sent whole, and of groups the user left, so they are removed
+//   - lists that moved between groups or owners, and todos that moved between lists,
+//     whether the user gained or lost access with the move
+//   - rows purged in the window that the user could see, from their last state kept in
+//     the change history
+//
+// Soft delete scopes do not apply to raw SQL, so deleted rows are included and sent as
+// tombstones.
+const syncChangesSQL = `
+WITH my_groups AS (
+	SELECT id FROM groups WHERE owner_id = @user
+	UNION SELECT group_id FROM user_group_role_mappings WHERE user_id = @user AND deleted_at IS NULL
+),
+my_lists AS (
+	SELECT id FROM todo_lists WHERE owner_id = @user OR group_id IN (SELECT id FROM my_groups)
+	UNION SELECT todo_list_id FROM shared_with WHERE user_id = @user
+),
+my_memberships AS (
+	SELECT group_id, GREATEST(updated_at, deleted_at) AS changed_at, deleted_at IS NOT NULL AS ended
+	FROM user_group_role_mappings
+	WHERE user_id = @user AND GREATEST(updated_at, deleted_at) > @from AND GREATEST(updated_at, deleted_at) <= @to
+),
+moves AS (
+	SELECT resource_type, resource_id, field, old_value #>> '{}' AS old_value, created_at
+	FROM change_records
+	WHERE action = 'update' AND created_at > @from AND created_at <= @to
+		AND ((resource_type = 'todo_list' AND field IN ('group_id', 'owner_id')) OR (resource_type = 'todo' AND field = 'todo_list_id'))
+),
+changes AS (
+	SELECT 'group' AS kind, id, GREATEST(updated_at, deleted_at) AS changed_at
+	FROM groups WHERE id IN (SELECT id FROM my_groups)
+	UNION ALL
+	SELECT 'group', group_id, changed_at FROM my_memberships
+
+	UNION ALL
+	SELECT 'group_member', id, GREATEST(updated_at, deleted_at)
+	FROM user_group_role_mappings WHERE user_id = @user OR group_id IN (SELECT id FROM my_groups)
+	UNION ALL
+	SELECT 'group_member', m.id, j.changed_at
+	FROM user_group_role_mappings m JOIN my_memberships j ON j.group_id = m.group_id AND NOT j.ended
+	WHERE m.deleted_at IS NULL
+
+	UNION ALL
+	SELECT 'todo_list', id, GREATEST(updated_at, deleted_at)
+	FROM todo_lists WHERE id IN (SELECT id FROM my_lists)
+	UNION ALL
+	SELECT 'todo_list', l.id, j.changed_at
+	FROM todo_lists l JOIN my_memberships j ON j.group_id = l.group_id
+	WHERE l.deleted_at IS NULL
+	UNION ALL
+	SELECT 'todo_list', resource_id, created_at
+	FROM moves
+	WHERE resource_type = 'todo_list' AND (resource_id IN (SELECT id FROM my_lists)
+		OR (field = 'group_id' AND old_value IN (SELECT id FROM my_groups))
+		OR (field = 'owner_id' AND old_value = @user))
+
+	UNION ALL
+	SELECT 'todo', id, GREATEST(updated_at, deleted_at)
+	FROM todos WHERE todo_list_id IN (SELECT id FROM my_lists)
+	UNION ALL
+	SELECT 'todo', t.id, j.changed_at
+	FROM todos t JOIN todo_lists l ON l.id = t.todo_list_id JOIN my_memberships j ON j.group_id = l.group_id AND NOT j.ended
+	WHERE t.deleted_at IS NULL AND l.deleted_at IS NULL
+	UNION ALL
+	SELECT 'todo', t.id, m.created_at
+	FROM todos t JOIN moves m ON m.resource_type = 'todo_list' AND m.resource_id = t.todo_list_id
+	WHERE t.deleted_at IS NULL AND t.todo_list_id IN (SELECT id FROM my_lists)
+	UNION ALL
+	SELECT 'todo', resource_id, created_at
+	FROM moves
+	WHERE resource_type = 'todo' AND old_value IN (SELECT id FROM my_lists)
+
+	UNION ALL
+	SELECT resource_type, resource_id, created_at
+	FROM change_records
+	WHERE action = 'purge' AND created_at > @from AND created_at <= @to AND (
+		(resource_type = 'todo' AND old_value->>'todo_list_id' IN (SELECT id FROM my_lists))
+		OR (resource_type = 'todo_list' AND (old_value->>'owner_id' = @user OR old_value->>'group_id' IN (SELECT id FROM my_groups)))
+		OR (resource_type = 'group' AND (old_value->>'owner_id' = @user OR resource_id IN (SELECT group_id FROM user_group_role_mappings WHERE user_id = @user)))
+		OR (resource_type = 'group_member' AND (old_value->>'user_id' = @user OR old_value->>'group_id' IN (SELECT id FROM my_groups)))
+	)
+),
+stream AS (
+	SELECT kind, id, MAX(changed_at) AS changed_at
+	FROM changes
+	WHERE changed_at > @from AND changed_at <= @to
+	GROUP BY kind, id
+)
+SELECT kind, id, changed_at FROM stream
+WHERE @first OR (changed_at, kind, id) > (@after_at, @after_kind, @after_id)
+ORDER BY changed_at, kind, id
+LIMIT @limit`
+
+// GetSync returns the changes to the groups, memberships, lists and todos visible to the
+// user since a cursor, for offline-first clients. Without "since" it returns everything
+// the user can see. Deleted rows, and rows the user lost access to, are returned as
+// tombstones. Responses hold at most "limit" changes; while "has_more" is set, the
+// returned cursor fetches the next page, and once it is not, the next changes.
+//
+// Rows purged from the trash are tombstoned for as long as the history is kept, but
+// cursors older than the trash retention are refused with 410 Gone: clients that were
+// away that long must start over with a full sync.
+func GetSync(c *fiber.Ctx) error {
+	db := database.DBConn
+	userID := c.Locals("userID").(string)
+
+	limit := c.QueryInt("limit", defaultSyncLimit)
+	if limit < 1 || limit > maxSyncLimit {
+		limit = defaultSyncLimit
+	}
+
+	cursor, err := decodeSyncCursor(c.Query("since"))
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid sync cursor", err)
+	}
+
+	now := time.Now()
+	if !cursor.Since.IsZero() && cursor.Since.Before(now.Add(-utils.TrashRetention())) {
+		return utils.SendErrorResponse(c, fiber.StatusGone, "Sync cursor expired, start a full sync without since", ErrInvalidSyncCursor)
+	}
+
+	until := now
+	if cursor.Until != nil {
+		until = *cursor.Until
+	}
+
+	var response models.SyncResponse
+
+	// ONE SNAPSHOT FOR THE STREAM AND THE ROWS IT POINTS AT
+	err = db.Transaction(func(tx *gorm.DB) error {
+		changes, err := syncChanges(tx, userID, cursor, until, limit+1)
+		if err != nil {
+			return err
+		}
+
+		next := syncCursor{Since: until}
+		if len(changes) > limit {
+			changes = changes[:limit]
+			last := changes[len(changes)-1]
+			next = syncCursor{Since: cursor.Since, Until: &until, After: &last}
+			response.HasMore = true
+		}
+
+		if err := loadSyncChanges(tx, userID, changes, cursor.Since.IsZero(), &response); err != nil {
+			return err
+		}
+
+		response.Cursor = encodeSyncCursor(next)
+		return nil
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve changes", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Changes retrieved successfully",
+		"data":    response,
+		"status":  fiber.StatusOK,
+	})
+}
+
+// syncChanges reads a page of the change stream of a user after the cursor
+func syncChanges(tx *gorm.DB, userID string, cursor syncCursor, until time.Time, limit int) ([]syncChange, error) {
+	from := cursor.Since
+	if !from.IsZero() {
+		from = from.Add(-syncOverlap)
+	}
+
+	params := map[string]interface{}{
+		"user":       userID,
+		"from":       from,
+		"to":         until,
+		"first":      cursor.After == nil,
+		"after_at":   time.Time{},
+		"after_kind": "",
+		"after_id":   "",
+		"limit":      limit,
+	}
+	if cursor.After != nil {
+		params["after_at"] = cursor.After.ChangedAt
+		params["after_kind"] = cursor.After.Kind
+		params["after_id"] = cursor.After.ID
+	}
+
+	var changes []syncChange
+	err := tx.Raw(syncChangesSQL, params).Scan(&changes).Error
+	return changes, err
+}
+
+// loadSyncChanges loads the rows of a page of the change stream into the response,
+// checking the user can still see each of them. On a full sync, tombstones are left out.
+func loadSyncChanges(tx *gorm.DB, userID string, changes []syncChange, fullSync bool, response *models.SyncResponse) error {
+	response.Groups = []models.SyncGroupResponse{}
+	response.Memberships = []models.SyncMembershipResponse{}
+	response.TodoLists = []models.SyncTodoListResponse{}
+	response.Todos = []models.SyncTodoResponse{}
+	response.Deleted = []models.Tombstone{}
+
+	ids := map[string][]string{}
+	changedAt := map[string]time.Time{}
+	for _, change := range changes {
+		ids[change.Kind] = append(ids[change.Kind], change.ID)
+		changedAt[change.Kind+":"+change.ID] = change.ChangedAt
+	}
+
+	found := map[string]bool{}
+	bury := func(kind string, id string, reason string, at time.Time) {
+		found[kind+":"+id] = true
+		if !fullSync {
+			response.Deleted = append(response.Deleted, models.Tombstone{Type: kind, ID: id, Reason: reason, DeletedAt: at})
+		}
+	}
+
+	// WHAT THE USER CAN SEE NOW
+	var groupIDs, listIDs []string
+	if err := utils.AccessibleGroupIDs(tx, userID).Pluck("groups.id", &groupIDs).Error; err != nil {
+		return err
+	}
+	if err := utils.AccessibleListIDs(tx, userID).Pluck("todo_lists.id", &listIDs).Error; err != nil {
+		return err
+	}
+
+	visibleGroups := make(map[string]bool, len(groupIDs))
+	for _, id := range groupIDs {
+		visibleGroups[id] = true
+	}
+	visibleLists := make(map[string]bool, len(listIDs))
+	for _, id := range listIDs {
+		visibleLists[id] = true
+	}
+
+	if len(ids[models.SyncGroup]) > 0 {
+		var groups []models.Group
+		if err := tx.Unscoped().Where("id IN ?", ids[models.SyncGroup]).Find(&groups).Error; err != nil {
+			return err
+		}
+
+		for _, group := range groups {
+			switch key := models.SyncGroup + ":" + group.ID; {
+			case group.DeletedAt.Valid:
+				bury(models.SyncGroup, group.ID, models.TombstoneDeleted, group.DeletedAt.Time)
+			case !visibleGroups[group.ID]:
+				bury(models.SyncGroup, group.ID, models.TombstoneRevoked, changedAt[key])
+			default:
+				found[key] = true
+				response.Groups = append(response.Groups, models.SyncGroupResponse{
+					ID:          group.ID,
+					Name:        group.Name,
+					Description: group.Description,
+					OwnerID:     group.OwnerID,
+					Version:     group.Version,
+					CreatedAt:   group.CreatedAt,
+					UpdatedAt:   group.UpdatedAt,
+				})
+			}
+		}
+	}
+
+	if len(ids[models.SyncMembership]) > 0 {
+		var memberships []models.UserGroupRoleMapping
+		if err := tx.Unscoped().
+			Preload("User", func(db *gorm.DB) *gorm.DB {
+				return db.Select("id, name, email")
+			}).
+			Preload("Role", func(db *gorm.DB) *gorm.DB {
+				return db.Unscoped().Select("id, name")
+			}).
+			Where("id IN ?", ids[models.SyncMembership]).
+			Find(&memberships).Error; err != nil {
+			return err
+		}
+
+		for _, membership := range memberships {
+			switch key := models.SyncMembership + ":" + membership.ID; {
+			case membership.DeletedAt.Valid:
+				bury(models.SyncMembership, membership.ID, models.TombstoneDeleted, membership.DeletedAt.Time)
+			case !visibleGroups[membership.GroupID]:
+				bury(models.SyncMembership, membership.ID, models.TombstoneRevoked, changedAt[key])
+			default:
+				found[key] = true
+				response.Memberships = append(response.Memberships, models.SyncMembershipResponse{
+					ID:      membership.ID,
+					GroupID: membership.GroupID,
+					User: &models.UserMinimal{
+						ID:    membership.User.ID,
+						Name:  membership.User.Name,
+						Email: membership.User.Email,
+					},
+					RoleID:    membership.RoleID,
+					RoleName:  membership.Role.Name,
+					CreatedAt: membership.CreatedAt,
+					UpdatedAt: membership.UpdatedAt,
+				})
+			}
+		}
+	}
+
+	if len(ids[models.SyncTodoList]) > 0 {
+		var lists []models.TodoList
+		if err := tx.Unscoped().Where("id IN ?", ids[models.SyncTodoList]).Find(&lists).Error; err != nil {
+			return err
+		}
+
+		for _, list := range lists {
+			switch key := models.SyncTodoList + ":" + list.ID; {
+			case list.DeletedAt.Valid:
+				bury(models.SyncTodoList, list.ID, models.TombstoneDeleted, list.DeletedAt.Time)
+			case !visibleLists[list.ID]:
+				bury(models.SyncTodoList, list.ID, models.TombstoneRevoked, changedAt[key])
+			default:
+				found[key] = true
+				response.TodoLists = append(response.TodoLists, toSyncTodoListResponse(list))
+			}
+		}
+	}
+
+	if len(ids[models.SyncTodo]) > 0 {
+		var todos []models.Todo
+		if err := tx.Unscoped().Where("id IN ?", ids[models.SyncTodo]).Find(&todos).Error; err != nil {
+			return err
+		}
+
+		for _, todo := range todos {
+			switch key := models.SyncTodo + ":" + todo.ID; {
+			case todo.DeletedAt.Valid:
+				bury(models.SyncTodo, todo.ID, models.TombstoneDeleted, todo.DeletedAt.Time)
+			case !visibleLists[todo.TodoListID]:
+				bury(models.SyncTodo, todo.ID, models.TombstoneRevoked, changedAt[key])
+			default:
+				found[key] = true
+				response.Todos = append(response.Todos, toSyncTodoResponse(todo))
+			}
+		}
+	}
+
+	// ROWS THAT NO LONGER EXIST WERE PURGED
+	for _, change := range changes {
+		if !found[change.Kind+":"+change.ID] {
+			bury(change.Kind, change.ID, models.TombstonePurged, change.ChangedAt)
+		}
+	}
+
+	return nil
+}
+
+func toSyncTodoListResponse(list models.TodoList) models.SyncTodoListResponse {
+	return models.SyncTodoListResponse{
+		ID:          list.ID,
+		Name:        list.Name,
+		Description: list.Description,
+		Color:       list.Color,
+		Position:    list.Position,
+		GroupID:     list.GroupID,
+		OwnerID:     list.OwnerID,
+		Version:     list.Version,
+		CreatedAt:   list.CreatedAt,
+		UpdatedAt:   list.UpdatedAt,
+	}
+}
+
+func toSyncTodoResponse(todo models.Todo) models.SyncTodoResponse {
+	return models.SyncTodoResponse{
+		ID:          todo.ID,
+		TodoListID:  todo.TodoListID,
+		ParentID:    todo.ParentID,
+		AssigneeID:  todo.AssigneeID,
+		Task:        todo.Task,
+		Description: todo.Description,
+		IsCompleted: todo.IsCompleted,
+		StartDate:   todo.StartDate,
+		EndDate:     todo.EndDate,
+		AllDay:      todo.AllDay,
+		Priority:    todo.Priority,
+		Position:    todo.Position,
+		Version:     todo.Version,
+		CreatedAt:   todo.CreatedAt,
+		UpdatedAt:   todo.UpdatedAt,
+	}
+}
+
+func encodeSyncCursor(cursor syncCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeSyncCursor decodes a cursor returned by GetSync. An empty cursor starts a full
+// sync.
+func decodeSyncCursor(raw string) (syncCursor, error) {
+	var cursor syncCursor
+	if raw == "" {
+		return cursor, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return cursor, ErrInvalidSyncCursor
+	}
+
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, ErrInvalidSyncCursor
+	}
+
+	if cursor.After != nil && cursor.Until == nil {
+		return cursor, ErrInvalidSyncCursor
+	}
+	return cursor, nil
+}
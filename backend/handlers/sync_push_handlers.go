@@ -0,0 +1,871 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/thompsonmanda08/task-sync/database"
+	"github.com/thompsonmanda08/task-sync/merge"
+	"github.com/thompsonmanda08/task-sync/models"
+	"github.com/thompsonmanda08/task-sync/utils"
+	"gorm.io/gorm"
+)
+
+const maxPushOperations = 500
+
+// errPushFailed rolls back the transaction of an operation that was not applied
+var errPushFailed = errors.New("push operation not applied")
+
+// pushEffects collects the notifications of applied operations, sent once they are
+// committed
+type pushEffects struct {
+	lists    []string            // Changed lists, in order
+	changes  map[string][]string // Summaries of the changes, per list
+	assigned []models.Todo
+}
+
+func (e *pushEffects) listChanged(listID string, summary string) {
+	if e.changes == nil {
+		e.changes = map[string][]string{}
+	}
+	if _, ok := e.changes[listID]; !ok {
+		e.lists = append(e.lists, listID)
+	}
+	e.changes[listID] = append(e.changes[listID], summary)
+}
+
+func (e *pushEffects) send(actorID string) {
+	for _, todo := range e.assigned {
+		notifyAssigned(actorID, todo)
+	}
+
+	for _, listID := range e.lists {
+		summary := e.changes[listID][0]
+		if count := len(e.changes[listID]); count > 1 {
+			summary = fmt.Sprintf("%d changes were made", count)
+		}
+		notifyListChanged(actorID, listID, summary)
+	}
+}
+
+// PushSyncChanges applies an ordered batch of create, update and delete operations on
+// lists, todos and dependencies, as queued by offline clients, and returns the result of
+// each with the server's version of the record. Creates carry the client-generated ID of
+// the record, a CUID, ULID or UUIDv7, so later operations of the batch can refer to it:
+// subtasks to their parent and dependencies to the todos they link.
+//
+// Todo updates carrying the client's hybrid logical clock timestamp are merged field by
+// field: fields not changed on the server since the client's base_version are applied,
+// and concurrent edits of the same field are resolved by the "policy" of the batch,
+// CONFLICT_POLICY by default. Under last-writer-wins the later timestamp wins and the
+// fields kept at the server's value are listed as overridden; under the conflict policy
+// the operation is a conflict listing the fields.
+//
+// Completing a todo that depends on incomplete todos is a conflict listing them as
+// blocked_by, unless the operation sets "force". Creates cannot be blocked, since
+// dependencies can only refer to todos that already exist.
+//
+// By default each operation is applied in its own transaction and a failed operation
+// does not stop the others. With "atomic" set the batch is applied in one transaction:
+// the first operation that fails rolls back the whole batch and the other operations are
+// reported as skipped.
+func PushSyncChanges(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	db := database.WithActor(database.DBConn, userID)
+
+	var request struct {
+		Atomic     bool                   `json:"atomic"`
+		Policy     string                 `json:"policy"` // lww or conflict, for concurrent edits of a todo field
+		Operations []models.PushOperation `json:"operations"`
+	}
+
+	if err := c.BodyParser(&request); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid request body", err)
+	}
+
+	policy, err := merge.ParsePolicy(request.Policy)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid conflict policy", err)
+	}
+	if policy == "" {
+		policy = merge.DefaultPolicy()
+	}
+
+	if len(request.Operations) == 0 || len(request.Operations) > maxPushOperations {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid number of operations", fmt.Errorf("a push must have between 1 and %d operations", maxPushOperations))
+	}
+
+	results := make([]models.PushResult, len(request.Operations))
+	applied := 0
+
+	if request.Atomic {
+		var effects pushEffects
+		failed := -1
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for i, operation := range request.Operations {
+				result, err := applyPushOperation(tx, userID, operation, policy, &effects)
+				if err != nil {
+					return err
+				}
+
+				results[i] = result
+				if result.Status != models.PushApplied {
+					failed = i
+					return errPushFailed
+				}
+			}
+			return nil
+		})
+
+		switch {
+		case errors.Is(err, errPushFailed):
+			for i, operation := range request.Operations {
+				if i != failed {
+					results[i] = models.PushResult{OpID: operation.OpID, Type: operation.Type, ID: operation.ID, Status: models.PushSkipped}
+				}
+			}
+		case err != nil:
+			return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to apply operations", err)
+		default:
+			applied = len(results)
+			effects.send(userID)
+		}
+	} else {
+		for i, operation := range request.Operations {
+			var effects pushEffects
+
+			err := db.Transaction(func(tx *gorm.DB) error {
+				result, err := applyPushOperation(tx, userID, operation, policy, &effects)
+				if err != nil {
+					return err
+				}
+
+				results[i] = result
+				if result.Status != models.PushApplied {
+					return errPushFailed
+				}
+				return nil
+			})
+
+			switch {
+			case errors.Is(err, errPushFailed):
+			case err != nil:
+				log.Errorf("Failed to apply push operation %s: %v", operation.OpID, err)
+				results[i] = models.PushResult{OpID: operation.OpID, Type: operation.Type, ID: operation.ID, Status: models.PushRejected, Error: "internal error"}
+			default:
+				applied++
+				effects.send(userID)
+			}
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": fmt.Sprintf("%d of %d operations applied", applied, len(results)),
+		"data":    fiber.Map{"applied": applied, "results": results},
+		"status":  fiber.StatusOK,
+	})
+}
+
+// applyPushOperation applies one operation. Invalid, forbidden and conflicting operations
+// are reported in the result; the error is only set for failures of the database.
+func applyPushOperation(tx *gorm.DB, userID string, operation models.PushOperation, policy merge.Policy, effects *pushEffects) (models.PushResult, error) {
+	result := models.PushResult{OpID: operation.OpID, Type: operation.Type, ID: operation.ID}
+
+	var err error
+	switch {
+	case operation.ID == "":
+		err = rejectPush("id is required")
+	case operation.Type == models.SyncTodo && operation.Action == models.ChangeCreate:
+		err = pushCreateTodo(tx, userID, operation, &result, effects)
+	case operation.Type == models.SyncTodo && operation.Action == models.ChangeUpdate:
+		err = pushUpdateTodo(tx, userID, operation, policy, &result, effects)
+	case operation.Type == models.SyncTodo && operation.Action == models.ChangeDelete:
+		err = pushDeleteTodo(tx, userID, operation, &result, effects)
+	case operation.Type == models.SyncTodoList && operation.Action == models.ChangeCreate:
+		err = pushCreateTodoList(tx, userID, operation, &result)
+	case operation.Type == models.SyncTodoList && operation.Action == models.ChangeUpdate:
+		err = pushUpdateTodoList(tx, userID, operation, &result, effects)
+	case operation.Type == models.SyncTodoList && operation.Action == models.ChangeDelete:
+		err = pushDeleteTodoList(tx, userID, operation, &result, effects)
+	case operation.Type == models.SyncDependency && operation.Action == models.ChangeCreate:
+		err = pushCreateDependency(tx, userID, operation, &result)
+	case operation.Type == models.SyncDependency && operation.Action == models.ChangeDelete:
+		err = pushDeleteDependency(tx, userID, operation)
+	default:
+		err = rejectPush("unknown operation %q on %q, expected create, update or delete on todo or todo_list, or create or delete on todo_dependency", operation.Action, operation.Type)
+	}
+
+	var rejected *pushRejection
+	switch {
+	case err == nil:
+		result.Status = models.PushApplied
+		return result, nil
+	case errors.Is(err, errPushFailed):
+		// THE CONFLICT IS ALREADY IN THE RESULT
+		return result, nil
+	case errors.As(err, &rejected), isPushRejection(err):
+		result.Status = models.PushRejected
+		result.Error = err.Error()
+		return result, nil
+	default:
+		return result, err
+	}
+}
+
+// A pushRejection is an operation the client got wrong, reported in its result
+type pushRejection struct {
+	message string
+}
+
+func (r *pushRejection) Error() string {
+	return r.message
+}
+
+func rejectPush(format string, args ...interface{}) error {
+	return &pushRejection{message: fmt.Sprintf(format, args...)}
+}
+
+// isPushRejection reports whether an error of the access helpers rejects an operation
+func isPushRejection(err error) bool {
+	for _, target := range []error{
+		utils.ErrListNotFound, utils.ErrListForbidden, ErrTodoNotFound,
+		ErrAssigneeNotFound, ErrAssigneeNoAccess, ErrDependencyCycle,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// pushConflict reports a conflict in the result, with the server's version of the record.
+// The returned error stops the operation.
+func pushConflict(result *models.PushResult, message string, record interface{}) error {
+	result.Status = models.PushConflict
+	result.Error = message
+	result.Record = record
+	return errPushFailed
+}
+
+// checkBlockers reports a conflict listing the open todos the todo of the operation depends
+// on, since completing a blocked todo needs the operation's force flag, like ?force=true
+// on the REST endpoints
+func checkBlockers(tx *gorm.DB, operation models.PushOperation, result *models.PushResult, record interface{}) error {
+	if operation.Force {
+		return nil
+	}
+
+	blockers, err := openBlockers(tx, operation.ID)
+	if err != nil {
+		return err
+	}
+	if len(blockers) > 0 {
+		result.BlockedBy = blockers
+		return pushConflict(result, "todo is blocked by incomplete todos", record)
+	}
+	return nil
+}
+
+func decodePushData(operation models.PushOperation, data interface{}) error {
+	if len(operation.Data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(operation.Data, data); err != nil {
+		return rejectPush("invalid data: %v", err)
+	}
+	return nil
+}
+
+// changedSince reports whether a record was changed after the client's copy, by its
+// version or else its update time
+func changedSince(version int64, updatedAt time.Time, operation models.PushOperation) bool {
+	switch {
+	case operation.BaseVersion != nil:
+		return version != *operation.BaseVersion
+	case operation.BaseUpdatedAt != nil:
+		return updatedAt.After(*operation.BaseUpdatedAt)
+	}
+	return false
+}
+
+// checkNewID checks a client-generated ID for a new record. An ID already used by a
+// record the user can see is a conflict, so replayed creates return that record.
+func checkNewID(tx *gorm.DB, model interface{}, userID string, operation models.PushOperation, result *models.PushResult) error {
+	err := utils.CheckNewID(tx, model, operation.ID)
+	if errors.Is(err, utils.ErrInvalidID) {
+		return rejectPush("%s", err.Error())
+	}
+	if !errors.Is(err, utils.ErrIDInUse) {
+		return err
+	}
+
+	var record interface{}
+	switch operation.Type {
+	case models.SyncTodo:
+		if _, todo, err := findAccessibleTodoByID(tx, userID, operation.ID, false); err == nil {
+			record = toSyncTodoResponse(*todo)
+		}
+	case models.SyncTodoList:
+		if list, err := utils.FindAccessibleTodoList(tx, userID, operation.ID, false); err == nil {
+			record = toSyncTodoListResponse(*list)
+		}
+	case models.SyncDependency:
+		var dependency models.TodoDependency
+		if err := tx.Where("id = ?", operation.ID).First(&dependency).Error; err == nil {
+			if _, _, err := findAccessibleTodoByID(tx, userID, dependency.TodoID, false); err == nil {
+				record = dependency
+			}
+		}
+	}
+
+	if record == nil {
+		return rejectPush("%s", utils.ErrIDInUse.Error())
+	}
+	return pushConflict(result, "record already exists", record)
+}
+
+// applyAllDay normalises the dates of a todo being made all-day, or edited while all-day,
+// as UpdateTodoItem does
+func applyAllDay(tx *gorm.DB, userID string, todo *models.Todo, allDay *bool, updates map[string]interface{}) {
+	if allDay != nil && *allDay && !todo.AllDay {
+		location := userLocation(tx, userID)
+		if _, ok := updates["start_date"]; !ok && todo.StartDate.Year() > 1 {
+			updates["start_date"] = todo.StartDate.In(location)
+		}
+		if _, ok := updates["end_date"]; !ok && todo.EndDate.Year() > 1 {
+			updates["end_date"] = todo.EndDate.In(location)
+		}
+	}
+
+	if (allDay != nil && *allDay) || (allDay == nil && todo.AllDay) {
+		for _, field := range []string{"start_date", "end_date"} {
+			if date, ok := updates[field].(time.Time); ok {
+				updates[field] = models.AllDayDate(date)
+			}
+		}
+	}
+
+	if allDay != nil {
+		updates["all_day"] = *allDay
+	}
+}
+
+func pushCreateTodo(tx *gorm.DB, userID string, operation models.PushOperation, result *models.PushResult, effects *pushEffects) error {
+	var data struct {
+		TodoListID  string          `json:"todo_list_id"`
+		Task        string          `json:"task"`
+		Description string          `json:"description"`
+		IsCompleted bool            `json:"is_completed"`
+		StartDate   time.Time       `json:"start_date"`
+		EndDate     time.Time       `json:"end_date"`
+		AllDay      bool            `json:"all_day"`
+		Priority    models.Priority `json:"priority"`
+		ParentID    *string         `json:"parent_id"`
+		AssigneeID  *string         `json:"assignee_id"`
+	}
+
+	if err := decodePushData(operation, &data); err != nil {
+		return err
+	}
+
+	if err := checkNewID(tx, &models.Todo{}, userID, operation, result); err != nil {
+		return err
+	}
+
+	if data.Task == "" {
+		return rejectPush("task is required")
+	}
+
+	if data.Priority == "" {
+		data.Priority = models.Normal
+	}
+	if data.Priority.Rank() < 0 {
+		return rejectPush("unknown priority %q", data.Priority)
+	}
+
+	todoList, err := utils.FindAccessibleTodoList(tx, userID, data.TodoListID, true)
+	if err != nil {
+		return err
+	}
+
+	todo := models.Todo{
+		ID:          operation.ID,
+		Task:        data.Task,
+		Description: data.Description,
+		IsCompleted: data.IsCompleted,
+		StartDate:   data.StartDate,
+		EndDate:     data.EndDate,
+		AllDay:      data.AllDay,
+		Priority:    data.Priority,
+		TodoListID:  todoList.ID,
+	}
+
+	if todo.AllDay {
+		todo.StartDate = models.AllDayDate(todo.StartDate)
+		todo.EndDate = models.AllDayDate(todo.EndDate)
+	}
+
+	if data.AssigneeID != nil && *data.AssigneeID != "" {
+		if err := checkAssignee(tx, todoList, *data.AssigneeID); err != nil {
+			return err
+		}
+		todo.AssigneeID = data.AssigneeID
+	}
+
+	// SUBTASKS MUST LIVE IN THE SAME LIST AS THEIR PARENT
+	if data.ParentID != nil && *data.ParentID != "" {
+		var parent models.Todo
+		if err := tx.Select("id").Where("id = ? AND todo_list_id = ?", *data.ParentID, todoList.ID).Limit(1).Find(&parent).Error; err != nil {
+			return err
+		}
+		if parent.ID == "" {
+			return rejectPush("parent todo not found in this list")
+		}
+		todo.ParentID = &parent.ID
+	}
+
+	if err := lockTodoList(tx, todoList.ID); err != nil {
+		return err
+	}
+
+	position, err := nextTodoPosition(tx, todoList.ID)
+	if err != nil {
+		return err
+	}
+	todo.Position = position
+
+	if err := tx.Create(&todo).Error; err != nil {
+		return err
+	}
+
+	if todo.AssigneeID != nil {
+		effects.assigned = append(effects.assigned, todo)
+	}
+	effects.listChanged(todoList.ID, fmt.Sprintf("%s was added", todo.Task))
+
+	result.Record = toSyncTodoResponse(todo)
+	return nil
+}
+
+func pushUpdateTodo(tx *gorm.DB, userID string, operation models.PushOperation, policy merge.Policy, result *models.PushResult, effects *pushEffects) error {
+	var data struct {
+		Task        *string          `json:"task"`
+		Description *string          `json:"description"`
+		IsCompleted *bool            `json:"is_completed"`
+		StartDate   *time.Time       `json:"start_date"`
+		EndDate     *time.Time       `json:"end_date"`
+		AllDay      *bool            `json:"all_day"`
+		Priority    *models.Priority `json:"priority"`
+		AssigneeID  *string          `json:"assignee_id"` // An empty ID unassigns the todo
+	}
+
+	if err := decodePushData(operation, &data); err != nil {
+		return err
+	}
+
+	todoList, todo, err := findAccessibleTodoByID(tx, userID, operation.ID, true)
+	if errors.Is(err, ErrTodoNotFound) && recordDeleted(tx, &models.Todo{}, operation.ID) {
+		return pushConflict(result, "todo was deleted", nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	// EDITS WITH A CLOCK ARE MERGED FIELD BY FIELD, OTHERS NEED AN UNCHANGED TODO
+	if operation.Clock != "" {
+		clock, err := merge.ParseTimestamp(operation.Clock)
+		if err != nil {
+			return rejectPush("invalid clock %q", operation.Clock)
+		}
+		if err := merge.Server.Observe(clock); err != nil {
+			return rejectPush("%v", err)
+		}
+
+		fields := []string{}
+		for field, set := range map[string]bool{
+			"task": data.Task != nil, "description": data.Description != nil, "is_completed": data.IsCompleted != nil,
+			"start_date": data.StartDate != nil, "end_date": data.EndDate != nil, "all_day": data.AllDay != nil,
+			"priority": data.Priority != nil, "assignee_id": data.AssigneeID != nil,
+		} {
+			if set {
+				fields = append(fields, field)
+			}
+		}
+
+		merged := merge.Fields(policy, todoFieldClocks(*todo), merge.Edit{Fields: fields, Clock: clock, BaseVersion: operation.BaseVersion})
+		if len(merged.Conflicts) > 0 {
+			result.Conflicts = merged.Conflicts
+			return pushConflict(result, "fields were changed on the server", toSyncTodoResponse(*todo))
+		}
+
+		// FIELDS WITH A LATER CHANGE ON THE SERVER KEEP IT
+		for _, field := range merged.Overridden {
+			switch field {
+			case "task":
+				data.Task = nil
+			case "description":
+				data.Description = nil
+			case "is_completed":
+				data.IsCompleted = nil
+			case "start_date":
+				data.StartDate = nil
+			case "end_date":
+				data.EndDate = nil
+			case "all_day":
+				data.AllDay = nil
+			case "priority":
+				data.Priority = nil
+			case "assignee_id":
+				data.AssigneeID = nil
+			}
+		}
+		result.Overridden = merged.Overridden
+
+		tx = database.WithClock(tx, clock)
+	} else if changedSince(todo.Version, todo.UpdatedAt, operation) {
+		return pushConflict(result, "todo was changed on the server", toSyncTodoResponse(*todo))
+	}
+
+	if data.IsCompleted != nil && *data.IsCompleted && !todo.IsCompleted {
+		if err := checkBlockers(tx, operation, result, toSyncTodoResponse(*todo)); err != nil {
+			return err
+		}
+	}
+
+	updates := map[string]interface{}{}
+
+	if data.Task != nil {
+		if *data.Task == "" {
+			return rejectPush("task cannot be empty")
+		}
+		updates["task"] = *data.Task
+	}
+	if data.Description != nil {
+		updates["description"] = *data.Description
+	}
+	if data.IsCompleted != nil {
+		updates["is_completed"] = *data.IsCompleted
+	}
+	if data.StartDate != nil {
+		updates["start_date"] = *data.StartDate
+	}
+	if data.EndDate != nil {
+		updates["end_date"] = *data.EndDate
+	}
+	if data.Priority != nil {
+		if data.Priority.Rank() < 0 {
+			return rejectPush("unknown priority %q", *data.Priority)
+		}
+		updates["priority"] = *data.Priority
+	}
+
+	applyAllDay(tx, userID, todo, data.AllDay, updates)
+
+	previousAssigneeID := todo.AssigneeID
+	if data.AssigneeID != nil {
+		if *data.AssigneeID == "" {
+			updates["assignee_id"] = nil
+		} else {
+			if err := checkAssignee(tx, todoList, *data.AssigneeID); err != nil {
+				return err
+			}
+			updates["assignee_id"] = *data.AssigneeID
+		}
+	}
+
+	if len(updates) > 0 {
+		if err := tx.Model(todo).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+
+	var updated models.Todo
+	if err := tx.Where("id = ?", todo.ID).First(&updated).Error; err != nil {
+		return err
+	}
+
+	if updated.AssigneeID != nil && (previousAssigneeID == nil || *previousAssigneeID != *updated.AssigneeID) {
+		effects.assigned = append(effects.assigned, updated)
+	}
+	effects.listChanged(updated.TodoListID, fmt.Sprintf("%s was updated", updated.Task))
+
+	result.Record = toSyncTodoResponse(updated)
+	return nil
+}
+
+func pushDeleteTodo(tx *gorm.DB, userID string, operation models.PushOperation, result *models.PushResult, effects *pushEffects) error {
+	_, todo, err := findAccessibleTodoByID(tx, userID, operation.ID, true)
+
+	// DELETING TWICE IS NOT AN ERROR, SO REPLAYED DELETES APPLY
+	if errors.Is(err, ErrTodoNotFound) && recordDeleted(tx, &models.Todo{}, operation.ID) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if changedSince(todo.Version, todo.UpdatedAt, operation) {
+		return pushConflict(result, "todo was changed on the server", toSyncTodoResponse(*todo))
+	}
+
+	// SUBTASKS ARE DELETED WITH THEIR PARENT
+	todoIDs, err := todoSubtreeIDs(tx, todo.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Where("id IN ?", todoIDs).Delete(&models.Todo{}).Error; err != nil {
+		return err
+	}
+
+	effects.listChanged(todo.TodoListID, fmt.Sprintf("%s was deleted", todo.Task))
+	return nil
+}
+
+func pushCreateTodoList(tx *gorm.DB, userID string, operation models.PushOperation, result *models.PushResult) error {
+	var data struct {
+		Name        string  `json:"name"`
+		Description string  `json:"description"`
+		Color       string  `json:"color"`
+		GroupID     *string `json:"group_id"`
+	}
+
+	if err := decodePushData(operation, &data); err != nil {
+		return err
+	}
+
+	if err := checkNewID(tx, &models.TodoList{}, userID, operation, result); err != nil {
+		return err
+	}
+
+	if data.Name == "" {
+		return rejectPush("name is required")
+	}
+
+	todoList := models.TodoList{
+		ID:          operation.ID,
+		Name:        data.Name,
+		Description: data.Description,
+		Color:       data.Color,
+		OwnerID:     userID,
+	}
+
+	// THE LIST CAN ONLY BE ADDED TO A GROUP THE USER BELONGS TO
+	if data.GroupID != nil && *data.GroupID != "" {
+		var count int64
+		if err := tx.Model(&models.Group{}).
+			Where("id = ? AND id IN (?)", *data.GroupID, utils.AccessibleGroupIDs(tx, userID)).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return rejectPush("group not found")
+		}
+		todoList.GroupID = data.GroupID
+	}
+
+	// PLACE THE NEW LIST BEFORE THE OWNER'S OTHER LISTS
+	if err := lockOwnerLists(tx, userID); err != nil {
+		return err
+	}
+
+	position, err := firstListPosition(tx, userID)
+	if err != nil {
+		return err
+	}
+	todoList.Position = position
+
+	if err := tx.Create(&todoList).Error; err != nil {
+		return err
+	}
+
+	result.Record = toSyncTodoListResponse(todoList)
+	return nil
+}
+
+// findOwnedTodoList loads a list for a list operation; like the list endpoints, only the
+// owner can change or delete a list
+func findOwnedTodoList(tx *gorm.DB, userID string, listID string) (*models.TodoList, error) {
+	list, err := utils.FindAccessibleTodoList(tx, userID, listID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if list.OwnerID != userID {
+		return nil, utils.ErrListForbidden
+	}
+	return list, nil
+}
+
+func pushUpdateTodoList(tx *gorm.DB, userID string, operation models.PushOperation, result *models.PushResult, effects *pushEffects) error {
+	var data struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		Color       *string `json:"color"`
+	}
+
+	if err := decodePushData(operation, &data); err != nil {
+		return err
+	}
+
+	todoList, err := findOwnedTodoList(tx, userID, operation.ID)
+	if errors.Is(err, utils.ErrListNotFound) && recordDeleted(tx, &models.TodoList{}, operation.ID) {
+		return pushConflict(result, "todo list was deleted", nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	if changedSince(todoList.Version, todoList.UpdatedAt, operation) {
+		return pushConflict(result, "todo list was changed on the server", toSyncTodoListResponse(*todoList))
+	}
+
+	updates := map[string]interface{}{}
+	if data.Name != nil {
+		if *data.Name == "" {
+			return rejectPush("name cannot be empty")
+		}
+		updates["name"] = *data.Name
+	}
+	if data.Description != nil {
+		updates["description"] = *data.Description
+	}
+	if data.Color != nil {
+		updates["color"] = *data.Color
+	}
+
+	if len(updates) > 0 {
+		if err := tx.Model(todoList).Updates(updates).Error; err != nil {
+			return err
+		}
+		effects.listChanged(todoList.ID, "The list was updated")
+	}
+
+	var updated models.TodoList
+	if err := tx.Where("id = ?", todoList.ID).First(&updated).Error; err != nil {
+		return err
+	}
+
+	result.Record = toSyncTodoListResponse(updated)
+	return nil
+}
+
+func pushDeleteTodoList(tx *gorm.DB, userID string, operation models.PushOperation, result *models.PushResult, effects *pushEffects) error {
+	todoList, err := findOwnedTodoList(tx, userID, operation.ID)
+
+	// DELETING TWICE IS NOT AN ERROR, SO REPLAYED DELETES APPLY
+	if errors.Is(err, utils.ErrListNotFound) && recordDeleted(tx, &models.TodoList{}, operation.ID) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if changedSince(todoList.Version, todoList.UpdatedAt, operation) {
+		return pushConflict(result, "todo list was changed on the server", toSyncTodoListResponse(*todoList))
+	}
+
+	// THE LIST GOES TO THE TRASH WITH ITS TODOS, AS IN DeleteTodoList
+	deletedAt := time.Now()
+	if err := tx.Model(todoList).Update("deleted_at", deletedAt).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Model(&models.Todo{}).Where("todo_list_id = ?", todoList.ID).Update("deleted_at", deletedAt).Error; err != nil {
+		return err
+	}
+
+	effects.listChanged(todoList.ID, "The list was moved to the trash")
+	return nil
+}
+
+// pushCreateDependency creates a dependency between todos, which may have been created
+// earlier in the same push
+func pushCreateDependency(tx *gorm.DB, userID string, operation models.PushOperation, result *models.PushResult) error {
+	var data struct {
+		TodoID      string `json:"todo_id"`
+		DependsOnID string `json:"depends_on_id"`
+	}
+
+	if err := decodePushData(operation, &data); err != nil {
+		return err
+	}
+
+	if err := checkNewID(tx, &models.TodoDependency{}, userID, operation, result); err != nil {
+		return err
+	}
+
+	_, todo, err := findAccessibleTodoByID(tx, userID, data.TodoID, true)
+	if err != nil {
+		return err
+	}
+
+	_, dependsOn, err := findAccessibleTodoByID(tx, userID, data.DependsOnID, false)
+	if err != nil {
+		return err
+	}
+
+	dependency := models.TodoDependency{
+		ID:          operation.ID,
+		TodoID:      todo.ID,
+		DependsOnID: dependsOn.ID,
+		CreatedByID: userID,
+	}
+
+	err = addTodoDependency(tx, &dependency)
+	if errors.Is(err, ErrDependencyExists) {
+		var existing models.TodoDependency
+		if err := tx.Where("todo_id = ? AND depends_on_id = ?", todo.ID, dependsOn.ID).First(&existing).Error; err != nil {
+			return err
+		}
+		return pushConflict(result, "dependency already exists", existing)
+	}
+	if err != nil {
+		return err
+	}
+
+	result.Record = dependency
+	return nil
+}
+
+func pushDeleteDependency(tx *gorm.DB, userID string, operation models.PushOperation) error {
+	var dependency models.TodoDependency
+	if err := tx.Where("id = ?", operation.ID).Limit(1).Find(&dependency).Error; err != nil {
+		return err
+	}
+
+	// DELETING TWICE IS NOT AN ERROR, SO REPLAYED DELETES APPLY
+	if dependency.ID == "" {
+		return nil
+	}
+
+	if _, _, err := findAccessibleTodoByID(tx, userID, dependency.TodoID, true); err != nil {
+		return err
+	}
+
+	return tx.Delete(&dependency).Error
+}
+
+// todoFieldClocks returns the last change of each field of a todo
+func todoFieldClocks(todo models.Todo) map[string]merge.FieldClock {
+	clocks := map[string]merge.FieldClock{}
+	if todo.FieldClocks != nil {
+		if err := json.Unmarshal([]byte(*todo.FieldClocks), &clocks); err != nil {
+			log.Errorf("Invalid field clocks on todo %s: %v", todo.ID, err)
+		}
+	}
+	return clocks
+}
+
+// recordDeleted reports whether a record is in the trash
+func recordDeleted(tx *gorm.DB, model interface{}, id string) bool {
+	var count int64
+	tx.Unscoped().Model(model).Where("id = ? AND deleted_at IS NOT NULL", id).Count(&count)
+	return count > 0
+}
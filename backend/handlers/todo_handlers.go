@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -27,10 +28,11 @@ import (
 // a 201 Created status with the new Todo List.
 
 func CreateNewTodoList(c *fiber.Ctx) error {
-	db := database.DBConn
 	userID := c.Locals("userID").(string)
+	db := database.WithActor(database.DBConn, userID)
 
 	var request struct {
+		ID          string `json:"id,omitempty"` // Client-generated ID, see utils.IsClientID; generated by the server when empty
 		Name        string `json:"name" validate:"required"`
 		GroupID     string `json:"group_id,omitempty"`
 		Description string `json:"description,omitempty"`
@@ -61,12 +63,35 @@ func CreateNewTodoList(c *fiber.Ctx) error {
 		})
 	}
 
+	// CLIENTS CREATING THE LIST OFFLINE SUPPLY ITS ID
+	if request.ID != "" {
+		if err := utils.CheckNewID(db, &models.TodoList{}, request.ID); err != nil {
+			return sendNewIDError(c, err)
+		}
+		todoList.ID = request.ID
+	}
+
 	todoList.OwnerID = userID // Set the OwnerID to the authenticated user's ID
 	todoList.Name = request.Name
 	todoList.Description = request.Description
 	todoList.Color = request.Color
 	todoList.GroupID = &request.GroupID
 
+	// PLACE THE NEW LIST BEFORE THE OWNER'S OTHER LISTS
+	createList := func(tx *gorm.DB) error {
+		if err := lockOwnerLists(tx, userID); err != nil {
+			return err
+		}
+
+		position, err := firstListPosition(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		todoList.Position = position
+		return tx.Create(&todoList).Error
+	}
+
 	// If a group ID is provided, set it; otherwise, leave it empty
 	if request.GroupID != "" {
 
@@ -75,7 +100,7 @@ func CreateNewTodoList(c *fiber.Ctx) error {
 		err := db.Transaction(func(tx *gorm.DB) error {
 
 			// First Create the Todo List
-			if err := tx.Create(&todoList).Error; err != nil {
+			if err := createList(tx); err != nil {
 				return err
 			}
 
@@ -102,7 +127,7 @@ func CreateNewTodoList(c *fiber.Ctx) error {
 		}
 
 		// IF THERE IS NOT GROUP ID PROVIDED THEN JUST CREATE THE TODO LIST
-	} else if err := db.Create(&todoList).Error; err != nil {
+	} else if err := db.Transaction(createList); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
 			"message": "Failed to create Todo List",
@@ -129,15 +154,38 @@ func CreateNewTodoList(c *fiber.Ctx) error {
 
 // GetTodoLists retrieves all TodoLists for a given user.
 // Todo items for each list are fetched in a separate query after the main list query.
+// The lists can be filtered and sorted with the query parameters described in
+// filterTodoLists and "sort"; passing "limit" or "cursor" pages through them, with the
+// cursor of the next page returned as "next_cursor".
 func GetTodoLists(c *fiber.Ctx) error {
 	db := database.DBConn
 	userID := c.Locals("userID").(string)
 
+	sort, err := utils.ParseSort(c.Query("sort"), todoListSortFields, defaultTodoListSort)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid sort parameter", err)
+	}
+
+	page, err := utils.GetCursorPage(c, sort)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid cursor", err)
+	}
+
+	query, err := filterTodoLists(c, db.Where("todo_lists.owner_id = ?", userID))
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid filter parameter", err)
+	}
+
+	query = utils.ApplySort(query, "todo_lists", sort)
+	if page.Enabled {
+		query = utils.ApplyCursor(query, "todo_lists", sort, page.Cursor).Limit(page.Limit + 1)
+	}
+
 	var todoLists []models.TodoList
 
 	// 1. Initial Fetch of TodoList details and its direct associations (excluding TodoItems)
 	// We only preload shared users, owner, and group here.
-	if err := db.
+	if err := query.
 		Preload("TodoItems", func(db *gorm.DB) *gorm.DB {
 			return db.Select("id, is_completed") // Select all needed fields for UserMinimal
 		}).
@@ -150,13 +198,19 @@ func GetTodoLists(c *fiber.Ctx) error {
 		Preload("Group", func(db *gorm.DB) *gorm.DB {
 			return db.Select("id, name")
 		}).
-		Where("owner_id = ?", userID).
-		Order("created_at DESC"). // Add sorting
 		Find(&todoLists).Error; err != nil {
 
 		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve Todo Lists", err)
 	}
 
+	var nextCursor *string
+	if page.Enabled && len(todoLists) > page.Limit {
+		todoLists = todoLists[:page.Limit]
+		last := todoLists[len(todoLists)-1]
+		cursor := utils.EncodeCursor(sort, todoListSortValues(last, sort), last.ID)
+		nextCursor = &cursor
+	}
+
 	// 2. Fetch TodoItems for each TodoList in separate queries
 	// This loop will execute N additional queries (N = number of todoLists)
 	// for i := range todoLists {
@@ -230,18 +284,21 @@ func GetTodoLists(c *fiber.Ctx) error {
 			Color:           list.Color,          // Populate the TodoItems field
 			TodoItemsCount:  len(list.TodoItems), // Count of actual loaded items
 			CompletedCount:  completedCount,
+			Position:        list.Position,
 			Group:           groupInfo,
 			SharedWith:      sharedWithMinimal, // Now populated from Preload("SharedWithUsers")
 			SharedWithCount: len(sharedWithMinimal),
 			Owner:           ownerMinimal, // Now populated from Preload("Owner")
+			Version:         list.Version,
 		})
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"success": true,
-		"message": "Todo Lists retrieved successfully",
-		"data":    fiber.Map{"todo_lists": response, "count": len(response)},
-		"status":  fiber.StatusOK,
+		"success":     true,
+		"message":     "Todo Lists retrieved successfully",
+		"data":        fiber.Map{"todo_lists": response, "count": len(response)},
+		"next_cursor": nextCursor,
+		"status":      fiber.StatusOK,
 	})
 }
 
@@ -313,8 +370,9 @@ func GetTodoList(c *fiber.Ctx) error {
 
 	var todoItems []models.Todo
 
-	if err := db.Select("id, task, description, is_completed, start_date, end_date, priority").
+	if err := db.Select("id, task, description, is_completed, start_date, end_date, all_day, priority, position, parent_id, assignee_id, version").
 		Where("todo_list_id = ?", todoList.ID).
+		Order("position ASC, id ASC").
 		Find(&todoItems).Error; err != nil {
 		// If no items found, it's not an error (GORM returns nil error for empty results)
 		// Only return error if there's a genuine database issue
@@ -342,12 +400,25 @@ func GetTodoList(c *fiber.Ctx) error {
 		})
 	}
 
+	itemIDs := make([]string, 0, len(todoList.TodoItems))
+	for _, item := range todoList.TodoItems {
+		itemIDs = append(itemIDs, item.ID)
+	}
+
+	blocked, err := blockedTodoIDs(db, itemIDs)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve todo dependencies", err)
+	}
+
+	now, location := time.Now(), userLocation(db, userID)
+
 	todoItemsResponse := make([]models.TodoItemResponse, 0, len(todoList.TodoItems))
 	completedCount := 0
 	for _, item := range todoList.TodoItems {
 		if item.IsCompleted {
 			completedCount++
 		}
+		overdue, dueToday := item.DueState(now, location)
 		todoItemsResponse = append(todoItemsResponse, models.TodoItemResponse{
 			ID:          item.ID,
 			Task:        item.Task,
@@ -355,7 +426,15 @@ func GetTodoList(c *fiber.Ctx) error {
 			IsCompleted: item.IsCompleted,
 			StartDate:   item.StartDate,
 			EndDate:     item.EndDate,
+			AllDay:      item.AllDay,
+			Overdue:     overdue,
+			DueToday:    dueToday,
 			Priority:    item.Priority,
+			Position:    item.Position,
+			ParentID:    item.ParentID,
+			AssigneeID:  item.AssigneeID,
+			Blocked:     blocked[item.ID],
+			Version:     item.Version,
 		})
 	}
 
@@ -379,10 +458,17 @@ func GetTodoList(c *fiber.Ctx) error {
 		TodoItems:       todoItemsResponse,
 		TodoItemsCount:  len(todoItemsResponse),
 		CompletedCount:  completedCount,
+		Position:        todoList.Position,
 		Group:           groupMinimal,
 		SharedWith:      sharedWithMinimal,
 		SharedWithCount: len(sharedWithMinimal),
 		Owner:           ownerMinimal,
+		Version:         todoList.Version,
+	}
+
+	// THE TAG COVERS THE LIST'S TODOS TOO
+	if utils.NotModified(c, utils.RepresentationETag(todoList.Version, response)) {
+		return c.SendStatus(fiber.StatusNotModified)
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
@@ -400,8 +486,8 @@ func GetTodoList(c *fiber.Ctx) error {
 // any error during the database query, it responds with an appropriate error message
 // and status code.
 func UpdateTodoList(c *fiber.Ctx) error {
-	db := database.DBConn
 	userID := c.Locals("userID").(string)
+	db := database.WithActor(database.DBConn, userID)
 	id := c.Params("list_id")
 
 	if id == "" {
@@ -430,19 +516,44 @@ func UpdateTodoList(c *fiber.Ctx) error {
 		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve Todo List", err)
 	}
 
-	if err := db.Model(&todoList).Updates(request).Error; err != nil {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// THE LIST MUST STILL BE AT THE VERSION THE CLIENT EDITED
+		if err := checkIfMatch(c, tx, &models.TodoList{}, todoList.ID); err != nil {
+			return err
+		}
+
+		return tx.Model(&todoList).Updates(request).Error
+	})
+
+	if err != nil && !errors.Is(err, ErrVersionMismatch) {
 		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to update Todo List", err)
 	}
 
+	// RELOAD THE LIST FOR THE VERSION SET BY THE DATABASE, OR THE CURRENT STATE ON A MISMATCH
+	if err := db.Where("id = ?", todoList.ID).First(&todoList).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve Todo List", err)
+	}
+
+	data := fiber.Map{
+		"id":       todoList.ID,
+		"name":     todoList.Name,
+		"owner_id": todoList.OwnerID,
+		"version":  todoList.Version,
+	}
+
+	if err != nil {
+		return sendPreconditionFailed(c, todoList.Version, data)
+	}
+
+	notifyListChanged(userID, todoList.ID, "The list was updated")
+
+	c.Set(fiber.HeaderETag, utils.ETag(todoList.Version))
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"success": true,
 		"message": "Todo List updated successfully",
-		"data": fiber.Map{
-			"id":       todoList.ID,
-			"name":     todoList.Name,
-			"owner_id": todoList.OwnerID,
-		},
-		"status": fiber.StatusOK,
+		"data":    data,
+		"status":  fiber.StatusOK,
 	})
 }
 
@@ -451,9 +562,10 @@ func UpdateTodoList(c *fiber.Ctx) error {
 // and deletes the Todo List if found. If the Todo List is not found or not owned by the
 // user, it responds with a 404 Not Found status code. In case of any error during the
 // database query, it responds with an appropriate error message and status code.
+// The list moves to the trash together with its todos, from where it can be restored.
 func DeleteTodoList(c *fiber.Ctx) error {
-	db := database.DBConn
 	userID := c.Locals("userID").(string)
+	db := database.WithActor(database.DBConn, userID)
 
 	id := c.Params("list_id")
 
@@ -467,10 +579,23 @@ func DeleteTodoList(c *fiber.Ctx) error {
 		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve Todo List", err)
 	}
 
-	if err := db.Delete(&todoList).Error; err != nil {
+	// MOVE THE LIST AND ITS TODOS TO THE TRASH WITH THE SAME DELETION TIME, SO THEY ARE RESTORED TOGETHER.
+	// THE LIST GOES FIRST, SO GROUP ACTIVITY FEEDS REPORT THE LIST RATHER THAN EACH OF ITS TODOS
+	deletedAt := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&todoList).Update("deleted_at", deletedAt).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Todo{}).Where("todo_list_id = ?", todoList.ID).Update("deleted_at", deletedAt).Error
+	})
+
+	if err != nil {
 		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to delete Todo List", err)
 	}
 
+	notifyListChanged(userID, todoList.ID, "The list was moved to the trash")
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"success": true,
 		"message": "Todo List deleted successfully",
@@ -490,14 +615,19 @@ func DeleteTodoList(c *fiber.Ctx) error {
 // If there is an error during the database query, it returns a 500 Internal Server Error status code with an appropriate error message.
 // If the Todo item is created successfully, it returns a 201 Created status code with the created Todo item in the response.
 func CreateNewTodoItem(c *fiber.Ctx) error {
-	db := database.DBConn
-
 	userID := c.Locals("userID").(string)
+	db := database.WithActor(database.DBConn, userID)
 	listID := c.Params("list_id")
 
 	var request struct {
-		Task        string `json:"task" validate:"required"`
-		Description string `json:"description,omitempty"`
+		ID          string    `json:"id,omitempty"` // Client-generated ID, see utils.IsClientID; generated by the server when empty
+		Task        string    `json:"task" validate:"required"`
+		Description string    `json:"description,omitempty"`
+		StartDate   time.Time `json:"start_date,omitempty"`
+		EndDate     time.Time `json:"end_date,omitempty"`
+		AllDay      bool      `json:"all_day,omitempty"`   // The dates are calendar dates, their time of day is ignored
+		ParentID    *string   `json:"parent_id,omitempty"` // Creates the todo as a subtask
+		AssigneeID  *string   `json:"assignee_id,omitempty"`
 	}
 
 	if err := c.BodyParser(&request); err != nil {
@@ -508,6 +638,13 @@ func CreateNewTodoItem(c *fiber.Ctx) error {
 		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Todo Task is required", errors.New("todo task cannot be empty"))
 	}
 
+	// CLIENTS CREATING THE TODO OFFLINE SUPPLY ITS ID
+	if request.ID != "" {
+		if err := utils.CheckNewID(db, &models.Todo{}, request.ID); err != nil {
+			return sendNewIDError(c, err)
+		}
+	}
+
 	var todoList models.TodoList
 	if err := db.
 		Preload("Group.UserGroupRoleMappings", "user_id = ?", userID). // Conditionally preload group mappings for this user
@@ -546,12 +683,56 @@ func CreateNewTodoItem(c *fiber.Ctx) error {
 	}
 
 	todoItem := models.Todo{
+		ID:          request.ID,
 		Task:        request.Task,
 		Description: request.Description,
+		StartDate:   request.StartDate,
+		EndDate:     request.EndDate,
+		AllDay:      request.AllDay,
 		TodoListID:  todoList.ID,
 	}
 
-	if err := db.Create(&todoItem).Error; err != nil {
+	// ALL-DAY DATES KEEP THE DATE THE CLIENT SENT, IN THE OFFSET IT WAS SENT IN
+	if todoItem.AllDay {
+		todoItem.StartDate = models.AllDayDate(todoItem.StartDate)
+		todoItem.EndDate = models.AllDayDate(todoItem.EndDate)
+	}
+
+	if request.AssigneeID != nil && *request.AssigneeID != "" {
+		if err := checkAssignee(db, &todoList, *request.AssigneeID); err != nil {
+			return sendAssigneeError(c, err)
+		}
+		todoItem.AssigneeID = request.AssigneeID
+	}
+
+	// SUBTASKS MUST LIVE IN THE SAME LIST AS THEIR PARENT
+	if request.ParentID != nil && *request.ParentID != "" {
+		var parent models.Todo
+		if err := db.Select("id").Where("id = ? AND todo_list_id = ?", *request.ParentID, todoList.ID).First(&parent).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Parent todo not found in this list", err)
+			}
+			return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve parent todo", err)
+		}
+		todoItem.ParentID = &parent.ID
+	}
+
+	// APPEND THE TODO TO THE END OF THE LIST
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := lockTodoList(tx, todoList.ID); err != nil {
+			return err
+		}
+
+		position, err := nextTodoPosition(tx, todoList.ID)
+		if err != nil {
+			return err
+		}
+
+		todoItem.Position = position
+		return tx.Create(&todoItem).Error
+	})
+
+	if err != nil {
 		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to create todo item", err)
 	}
 
@@ -560,10 +741,21 @@ func CreateNewTodoItem(c *fiber.Ctx) error {
 		"task":         todoItem.Task,
 		"description":  todoItem.Description,
 		"is_completed": todoItem.IsCompleted,
+		"start_date":   todoItem.StartDate,
+		"end_date":     todoItem.EndDate,
+		"all_day":      todoItem.AllDay,
+		"position":     todoItem.Position,
+		"parent_id":    todoItem.ParentID,
+		"assignee_id":  todoItem.AssigneeID,
 		"createdAt":    todoItem.CreatedAt,
 		"todo_list_id": todoItem.TodoListID,
 	}
 
+	if todoItem.AssigneeID != nil {
+		notifyAssigned(userID, todoItem)
+	}
+	notifyListChanged(userID, todoList.ID, fmt.Sprintf("%s was added", todoItem.Task))
+
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"success": true,
 		"message": "Todo Created Successfully",
@@ -576,29 +768,76 @@ func CreateNewTodoItem(c *fiber.Ctx) error {
 // It fetches the userID from the context, queries the database for todos
 // linked to that user, and returns the list of todos in the response.
 // In case of any error during the database query, it responds with an
-// appropriate error message and status code.
-
+// appropriate error message and status code. The user needs read access to the list.
+//
+// The todos can be filtered with the query parameters described in filterTodos and
+// sorted on several fields with "sort", e.g. "sort=-priority,end_date". Passing "limit"
+// or "cursor" pages through them, with the cursor of the next page in "next_cursor".
 func GetTodoItems(c *fiber.Ctx) error {
 
 	db := database.DBConn
+	userID := c.Locals("userID").(string)
 	listID := c.Params("list_id")
 
 	if listID == "" {
 		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Todo List ID is required in the URL path", nil)
 	}
 
-	var todos []models.Todo
+	todoList, err := utils.FindAccessibleTodoList(db, userID, listID, false)
+	if err != nil {
+		return sendAccessError(c, err)
+	}
 
-	if err := db.Where("todo_list_id = ?", listID).Find(&todos).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return utils.SendErrorResponse(c, fiber.StatusNotFound, "Todo List not found", err)
-		}
+	sort, err := utils.ParseSort(c.Query("sort"), todoSortFields, defaultTodoSort)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid sort parameter", err)
+	}
+
+	page, err := utils.GetCursorPage(c, sort)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid cursor", err)
+	}
+
+	query, err := filterTodos(c, db.Where("todos.todo_list_id = ?", todoList.ID))
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid filter parameter", err)
+	}
+
+	query = utils.ApplySort(query, "todos", sort)
+	if page.Enabled {
+		query = utils.ApplyCursor(query, "todos", sort, page.Cursor).Limit(page.Limit + 1)
+	}
+
+	var todos []models.Todo
 
+	if err := query.Find(&todos).Error; err != nil {
 		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve todos", err)
 	}
 
+	// A FULL PAGE WITH ONE EXTRA ROW MEANS THERE IS A NEXT PAGE
+	var nextCursor *string
+	if page.Enabled && len(todos) > page.Limit {
+		todos = todos[:page.Limit]
+		last := todos[len(todos)-1]
+		cursor := utils.EncodeCursor(sort, todoSortValues(last, sort), last.ID)
+		nextCursor = &cursor
+	}
+
+	todoIDs := make([]string, 0, len(todos))
+	for _, todo := range todos {
+		todoIDs = append(todoIDs, todo.ID)
+	}
+
+	blocked, err := blockedTodoIDs(db, todoIDs)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve todo dependencies", err)
+	}
+
+	now, location := time.Now(), userLocation(db, userID)
+
 	var response []models.TodoItemResponse
 	for _, todo := range todos {
+		overdue, dueToday := todo.DueState(now, location)
 
 		response = append(response, models.TodoItemResponse{
 			ID:          todo.ID,
@@ -606,28 +845,38 @@ func GetTodoItems(c *fiber.Ctx) error {
 			IsCompleted: todo.IsCompleted,
 			StartDate:   todo.StartDate,
 			EndDate:     todo.EndDate,
+			AllDay:      todo.AllDay,
+			Overdue:     overdue,
+			DueToday:    dueToday,
 			Priority:    todo.Priority,
+			Position:    todo.Position,
+			ParentID:    todo.ParentID,
+			AssigneeID:  todo.AssigneeID,
+			Blocked:     blocked[todo.ID],
+			Version:     todo.Version,
 		})
 
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"success": true,
-		"message": "Todos retrieved successfully",
-		"data":    response,
-		"status":  fiber.StatusOK,
+		"success":     true,
+		"message":     "Todos retrieved successfully",
+		"data":        response,
+		"next_cursor": nextCursor,
+		"status":      fiber.StatusOK,
 	})
 }
 
 // GetTodoItem retrieves a single todo item by ID. It fetches the userID from the
 // context, queries the database for a todo associated with that user and the
-// provided ID, and returns the todo in the response. If the todo is not found or
-// not owned by the user, it responds with a 404 Not Found status code. In case of
-// any error during the database query, it responds with an appropriate error
-// message and status code.
+// provided ID, and returns the todo in the response. If the todo is not found it
+// responds with a 404 Not Found status code, and with 403 Forbidden when the user
+// cannot read the list. In case of any error during the database query, it responds
+// with an appropriate error message and status code.
 func GetTodoItem(c *fiber.Ctx) error {
 
 	db := database.DBConn
+	userID := c.Locals("userID").(string)
 	id := c.Params("task_id")
 	listID := c.Params("list_id")
 
@@ -635,23 +884,37 @@ func GetTodoItem(c *fiber.Ctx) error {
 		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Todo List ID is required in the URL path", nil)
 	}
 
-	var todo models.Todo
-
-	if err := db.Where("id = ? AND todo_list_id = ?", id, listID).First(&todo).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return utils.SendErrorResponse(c, fiber.StatusNotFound, "Task item not found", err)
-		}
+	_, todo, err := findAccessibleTodo(db, userID, listID, id, false)
+	if err != nil {
+		return sendAccessError(c, err)
+	}
 
-		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve todo", err)
+	blocked, err := blockedTodoIDs(db, []string{todo.ID})
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve todo dependencies", err)
 	}
 
+	overdue, dueToday := todo.DueState(time.Now(), userLocation(db, userID))
+
 	response := models.TodoItemResponse{
 		ID:          todo.ID,
 		Task:        todo.Task,
 		IsCompleted: todo.IsCompleted,
 		StartDate:   todo.StartDate,
 		EndDate:     todo.EndDate,
+		AllDay:      todo.AllDay,
+		Overdue:     overdue,
+		DueToday:    dueToday,
 		Priority:    todo.Priority,
+		Position:    todo.Position,
+		ParentID:    todo.ParentID,
+		AssigneeID:  todo.AssigneeID,
+		Blocked:     blocked[todo.ID],
+		Version:     todo.Version,
+	}
+
+	if utils.NotModified(c, utils.RepresentationETag(todo.Version, response)) {
+		return c.SendStatus(fiber.StatusNotModified)
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
@@ -665,19 +928,17 @@ func GetTodoItem(c *fiber.Ctx) error {
 // UpdateTodoItem updates a single todo item by ID. It fetches the userID from the
 // context, queries the database for a todo associated with that user and the
 // provided ID, and updates the todo with the provided fields. If the todo is not
-// found or not owned by the user, it responds with a 404 Not Found status code. In
-// case of any error during the database query, it responds with an appropriate error
-// message and status code.
+// found it responds with a 404 Not Found status code, and with 403 Forbidden when the
+// user cannot edit the list. In case of any error during the database query, it
+// responds with an appropriate error message and status code.
 func UpdateTodoItem(c *fiber.Ctx) error {
-	db := database.DBConn
-
-	// userID := c.Locals("userID").(string)
+	userID := c.Locals("userID").(string)
+	db := database.WithActor(database.DBConn, userID)
 	id := c.Params("task_id")
 	listId := c.Params("list_id")
 
 	if id == "" {
-		utils.SendErrorResponse(c, fiber.StatusBadRequest, "Task ID is required in the URL path", errors.New("missing required parameter: task_id"))
-
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Task ID is required in the URL path", errors.New("missing required parameter: task_id"))
 	}
 
 	var request struct {
@@ -695,22 +956,117 @@ func UpdateTodoItem(c *fiber.Ctx) error {
 
 	}
 
-	var todo models.Todo
+	// THE ASSIGNEE AND ALL-DAY FLAG ARE UPDATED SEPARATELY, AN EMPTY ID UNASSIGNS THE TODO
+	var assignment struct {
+		AssigneeID *string `json:"assignee_id"`
+		AllDay     *bool   `json:"all_day"`
+	}
 
-	// Find the todo and ensure it belongs to the authenticated user
-	if err := db.Where("id = ? AND todo_list_id = ?", id, listId).First(&todo).Error; err != nil {
+	if err := c.BodyParser(&assignment); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid request body", err)
+	}
 
-		if err == gorm.ErrRecordNotFound {
-			return utils.SendErrorResponse(c, fiber.StatusNotFound, "Todo not found or not owned by user", err)
+	todoList, todo, err := findAccessibleTodo(db, userID, listId, id, true)
+	if err != nil {
+		return sendAccessError(c, err)
+	}
+
+	if request.IsCompleted && !todo.IsCompleted {
+		if refused, err := refuseBlockedCompletion(c, db, todo.ID); refused {
+			return err
 		}
+	}
 
-		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve todo", err)
+	var assigneeID *string
+	if assignment.AssigneeID != nil && *assignment.AssigneeID != "" {
+		if err := checkAssignee(db, todoList, *assignment.AssigneeID); err != nil {
+			return sendAssigneeError(c, err)
+		}
+		assigneeID = assignment.AssigneeID
+	}
+
+	// ALL-DAY DATES KEEP THE DATE THE CLIENT SENT, A TIMED TODO MADE ALL-DAY KEEPS ITS DATE
+	// IN THE USER'S TIMEZONE
+	if assignment.AllDay != nil && *assignment.AllDay && !todo.AllDay {
+		location := userLocation(db, userID)
+		if request.StartDate.IsZero() && todo.StartDate.Year() > 1 {
+			request.StartDate = todo.StartDate.In(location)
+		}
+		if request.EndDate.IsZero() && todo.EndDate.Year() > 1 {
+			request.EndDate = todo.EndDate.In(location)
+		}
+	}
+
+	if (assignment.AllDay != nil && *assignment.AllDay) || (assignment.AllDay == nil && todo.AllDay) {
+		request.StartDate = models.AllDayDate(request.StartDate)
+		request.EndDate = models.AllDayDate(request.EndDate)
 	}
 
-	if err := db.Model(&todo).Updates(request).Error; err != nil {
+	// ONE UPDATE STATEMENT, SO THE REQUEST PRODUCES ONE VERSION AND ONE HISTORY ENTRY.
+	// EMPTY FIELDS OF THE REQUEST ARE LEFT UNCHANGED
+	updates := map[string]interface{}{}
+	if request.Task != "" {
+		updates["task"] = request.Task
+	}
+	if request.Description != "" {
+		updates["description"] = request.Description
+	}
+	if !request.StartDate.IsZero() {
+		updates["start_date"] = request.StartDate
+	}
+	if !request.EndDate.IsZero() {
+		updates["end_date"] = request.EndDate
+	}
+	if request.IsCompleted {
+		updates["is_completed"] = true
+	}
+	if request.Priority != "" {
+		updates["priority"] = request.Priority
+	}
+	if assignment.AllDay != nil && *assignment.AllDay != todo.AllDay {
+		updates["all_day"] = *assignment.AllDay
+	}
+	if assignment.AssigneeID != nil {
+		updates["assignee_id"] = assigneeID
+	}
+
+	previousAssigneeID := todo.AssigneeID
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// THE TODO MUST STILL BE AT THE VERSION THE CLIENT EDITED
+		if err := checkIfMatch(c, tx, &models.Todo{}, todo.ID); err != nil {
+			return err
+		}
+
+		if len(updates) == 0 {
+			return nil
+		}
+		return tx.Model(todo).Updates(updates).Error
+	})
+
+	if errors.Is(err, ErrVersionMismatch) {
+		var current models.Todo
+		if err := db.Where("id = ?", todo.ID).First(&current).Error; err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve todo", err)
+		}
+		return sendPreconditionFailed(c, current.Version, current)
+	}
+
+	if err != nil {
 		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to update todo", err)
 	}
 
+	// RELOAD THE TODO FOR THE VERSION SET BY THE DATABASE
+	if err := db.Where("id = ?", todo.ID).First(todo).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve todo", err)
+	}
+	c.Set(fiber.HeaderETag, utils.ETag(todo.Version))
+
+	if todo.AssigneeID != nil && (previousAssigneeID == nil || *previousAssigneeID != *todo.AssigneeID) {
+		notifyAssigned(userID, *todo)
+	}
+	notifyListChanged(userID, todo.TodoListID, fmt.Sprintf("%s was updated", todo.Task))
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"success": true,
 		"message": "Todo updated successfully",
@@ -724,10 +1080,11 @@ func UpdateTodoItem(c *fiber.Ctx) error {
 // provided ID, and deletes the todo if found. If the todo is not found or not
 // owned by the user, it responds with a 404 Not Found status code. In case of
 // any error during the database query, it responds with an appropriate error
-// message and status code.
+// message and status code. The todo moves to the trash together with its subtasks,
+// from where it can be restored.
 func DeleteTodoItem(c *fiber.Ctx) error {
-	db := database.DBConn
-	// userID := c.Locals("userID").(string)
+	userID := c.Locals("userID").(string)
+	db := database.WithActor(database.DBConn, userID)
 	id := c.Params("task_id")
 	listId := c.Params("list_id")
 
@@ -747,10 +1104,19 @@ func DeleteTodoItem(c *fiber.Ctx) error {
 		return utils.SendErrorResponse(c, fiber.StatusNotFound, "Todo not found or not owned by user", err)
 	}
 
-	if err := db.Delete(&todo).Error; err != nil {
+	// SUBTASKS ARE DELETED WITH THEIR PARENT
+	todoIDs, err := todoSubtreeIDs(db, todo.ID)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve subtasks", err)
+	}
+
+	// THE TODOS GO TO THE TRASH, THEIR ATTACHMENTS ARE ONLY REMOVED WHEN THEY ARE PURGED
+	if err := db.Where("id IN ?", todoIDs).Delete(&models.Todo{}).Error; err != nil {
 		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to delete todo", err)
 	}
 
+	notifyListChanged(userID, todo.TodoListID, fmt.Sprintf("%s was deleted", todo.Task))
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"success": true,
 		"message": "Todo deleted successfully",
@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thompsonmanda08/task-sync/database"
+	"github.com/thompsonmanda08/task-sync/models"
+	"github.com/thompsonmanda08/task-sync/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type transferRequest struct {
+	ListID string `json:"list_id" validate:"required"` // Destination todo list
+}
+
+// MoveTodoToList moves a todo, together with its subtasks, to another todo list. The
+// user needs write access to both the source and the destination list. Comments and
+// attachments belong to the todo and move with it. The moved todos are appended to
+// the end of the destination list; a moved subtask is detached from its parent, which
+// stays in the source list.
+//
+// The move is recorded in the history of each moved todo, as a change of its
+// todo_list_id (and parent_id for a detached subtask) attributed to the user, by the
+// audit callbacks of the database package.
+func MoveTodoToList(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	db := database.WithActor(database.DBConn, userID)
+
+	var request transferRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid request body", err)
+	}
+
+	if request.ListID == "" {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Destination list is required", errors.New("list_id cannot be empty"))
+	}
+
+	sourceList, todo, err := findAccessibleTodo(db, userID, c.Params("list_id"), c.Params("task_id"), true)
+	if err != nil {
+		return sendAccessError(c, err)
+	}
+
+	if request.ListID == sourceList.ID {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Todo is already in this list", errors.New("destination list is the source list"))
+	}
+
+	destinationList, err := utils.FindAccessibleTodoList(db, userID, request.ListID, true)
+	if err != nil {
+		return sendAccessError(c, err)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := lockTodoLists(tx, sourceList.ID, destinationList.ID); err != nil {
+			return err
+		}
+
+		subtree, err := loadTodoSubtree(tx, todo.ID)
+		if err != nil {
+			return err
+		}
+
+		positions, err := appendPositions(tx, destinationList.ID, len(subtree))
+		if err != nil {
+			return err
+		}
+
+		for i, item := range subtree {
+			updates := map[string]interface{}{
+				"todo_list_id": destinationList.ID,
+				"position":     positions[i],
+			}
+
+			if item.ID == todo.ID {
+				updates["parent_id"] = nil
+			}
+
+			if err := tx.Model(&models.Todo{}).Where("id = ?", item.ID).Updates(updates).Error; err != nil {
+				return err
+			}
+
+			subtree[i].TodoListID = destinationList.ID
+			subtree[i].Position = positions[i]
+		}
+
+		*todo = subtree[0]
+		return nil
+	})
+
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to move todo", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Todo moved successfully",
+		"data": fiber.Map{
+			"id":           todo.ID,
+			"todo_list_id": todo.TodoListID,
+			"position":     todo.Position,
+		},
+		"status": fiber.StatusOK,
+	})
+}
+
+// CopyTodoToList copies a todo, together with its subtasks, comments and attachments, to
+// another todo list (which may be the same list). The user needs write access to both
+// lists. Copied attachments share the stored files of the originals.
+func CopyTodoToList(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	db := database.WithActor(database.DBConn, userID)
+
+	var request transferRequest
+	if err := c.BodyParser(&request); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid request body", err)
+	}
+
+	if request.ListID == "" {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Destination list is required", errors.New("list_id cannot be empty"))
+	}
+
+	sourceList, todo, err := findAccessibleTodo(db, userID, c.Params("list_id"), c.Params("task_id"), true)
+	if err != nil {
+		return sendAccessError(c, err)
+	}
+
+	destinationList, err := utils.FindAccessibleTodoList(db, userID, request.ListID, true)
+	if err != nil {
+		return sendAccessError(c, err)
+	}
+
+	var copied models.Todo
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := lockTodoLists(tx, sourceList.ID, destinationList.ID); err != nil {
+			return err
+		}
+
+		subtree, err := loadTodoSubtree(tx, todo.ID)
+		if err != nil {
+			return err
+		}
+
+		positions, err := appendPositions(tx, destinationList.ID, len(subtree))
+		if err != nil {
+			return err
+		}
+
+		// 1. Todos, parents before subtasks so parent IDs can be remapped
+		todoIDs := make(map[string]string, len(subtree))
+		for _, item := range subtree {
+			todoIDs[item.ID] = utils.GenerateCUID()
+		}
+
+		for i, item := range subtree {
+			clone := models.Todo{
+				ID:          todoIDs[item.ID],
+				Task:        item.Task,
+				Description: item.Description,
+				IsCompleted: item.IsCompleted,
+				StartDate:   item.StartDate,
+				EndDate:     item.EndDate,
+				AllDay:      item.AllDay,
+				Priority:    item.Priority,
+				Position:    positions[i],
+				TodoListID:  destinationList.ID,
+			}
+
+			if item.ParentID != nil && item.ID != todo.ID {
+				parentID := todoIDs[*item.ParentID]
+				clone.ParentID = &parentID
+			}
+
+			if err := tx.Omit(clause.Associations).Create(&clone).Error; err != nil {
+				return err
+			}
+
+			if item.ID == todo.ID {
+				copied = clone
+			}
+		}
+
+		sourceIDs := make([]string, 0, len(subtree))
+		for _, item := range subtree {
+			sourceIDs = append(sourceIDs, item.ID)
+		}
+
+		// 2. Comments, oldest first so replies are created after the comment they answer
+		var comments []models.Comment
+		if err := tx.Where("todo_id IN ?", sourceIDs).Order("created_at ASC").Find(&comments).Error; err != nil {
+			return err
+		}
+
+		commentIDs := make(map[string]string, len(comments))
+		for _, comment := range comments {
+			commentIDs[comment.ID] = utils.GenerateCUID()
+		}
+
+		for _, comment := range comments {
+			clone := models.Comment{
+				ID:        commentIDs[comment.ID],
+				Body:      comment.Body,
+				TodoID:    todoIDs[comment.TodoID],
+				AuthorID:  comment.AuthorID,
+				EditedAt:  comment.EditedAt,
+				CreatedAt: comment.CreatedAt,
+			}
+
+			// Replies whose comment was deleted become top-level comments, as deletes move
+			// the replies of top-level comments up
+			if comment.ParentID != nil {
+				if parentID, ok := commentIDs[*comment.ParentID]; ok {
+					clone.ParentID = &parentID
+				}
+			}
+
+			if err := tx.Omit(clause.Associations).Create(&clone).Error; err != nil {
+				return err
+			}
+		}
+
+		// 3. Attachments, locking their blobs so they cannot be garbage-collected meanwhile
+		var attachments []models.Attachment
+		if err := tx.Where("todo_id IN ?", sourceIDs).Find(&attachments).Error; err != nil {
+			return err
+		}
+
+		if len(attachments) > 0 {
+			blobIDs := make([]string, 0, len(attachments))
+			for _, attachment := range attachments {
+				blobIDs = append(blobIDs, attachment.BlobID)
+			}
+
+			var blobs []models.Blob
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id IN ?", blobIDs).Find(&blobs).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, attachment := range attachments {
+			clone := models.Attachment{
+				FileName:     attachment.FileName,
+				TodoID:       todoIDs[attachment.TodoID],
+				BlobID:       attachment.BlobID,
+				UploadedByID: attachment.UploadedByID,
+			}
+
+			if err := tx.Omit(clause.Associations).Create(&clone).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to copy todo", err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"message": "Todo copied successfully",
+		"data": fiber.Map{
+			"id":           copied.ID,
+			"task":         copied.Task,
+			"todo_list_id": copied.TodoListID,
+			"position":     copied.Position,
+			"copied_from":  todo.ID,
+		},
+		"status": fiber.StatusCreated,
+	})
+}
+
+// lockTodoLists locks several todo lists in a stable order, so two transfers in opposite
+// directions cannot deadlock
+func lockTodoLists(tx *gorm.DB, listIDs ...string) error {
+	var lists []models.TodoList
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id").
+		Where("id IN ?", listIDs).
+		Order("id ASC").
+		Find(&lists).Error
+}
+
+// appendPositions returns n ordered positions after the last todo of a list. Callers
+// must hold the list lock.
+func appendPositions(tx *gorm.DB, listID string, n int) ([]string, error) {
+	var last string
+	if err := tx.Model(&models.Todo{}).
+		Where("todo_list_id = ?", listID).
+		Select("COALESCE(MAX(position), '')").
+		Scan(&last).Error; err != nil {
+		return nil, err
+	}
+
+	return utils.PositionsBetween(last, "", n)
+}
+
+// todoSubtreeIDs returns the ID of a todo followed by the IDs of all its subtasks, at any
+// depth, level by level and in list order within a level
+func todoSubtreeIDs(db *gorm.DB, todoID string) ([]string, error) {
+	var ids []string
+
+	err := db.Raw(`
+		WITH RECURSIVE subtree AS (
+			SELECT id, position, 0 AS depth FROM todos WHERE id = ? AND deleted_at IS NULL
+			UNION ALL
+			SELECT todos.id, todos.position, subtree.depth + 1 FROM todos
+			JOIN subtree ON todos.parent_id = subtree.id
+			WHERE todos.deleted_at IS NULL
+		)
+		SELECT id FROM subtree ORDER BY depth ASC, position ASC`, todoID).
+		Scan(&ids).Error
+
+	return ids, err
+}
+
+// loadTodoSubtree loads a todo and all its subtasks in the order of todoSubtreeIDs, so
+// parents always precede their subtasks
+func loadTodoSubtree(tx *gorm.DB, todoID string) ([]models.Todo, error) {
+	ids, err := todoSubtreeIDs(tx, todoID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		return nil, ErrTodoNotFound
+	}
+
+	var todos []models.Todo
+	if err := tx.Where("id IN ?", ids).Find(&todos).Error; err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int, len(ids))
+	for i, id := range ids {
+		index[id] = i
+	}
+
+	ordered := make([]models.Todo, len(todos))
+	for _, item := range todos {
+		ordered[index[item.ID]] = item
+	}
+
+	return ordered, nil
+}
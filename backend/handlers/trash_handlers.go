@@ -0,0 +1,431 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thompsonmanda08/task-sync/database"
+	"github.com/thompsonmanda08/task-sync/models"
+	"github.com/thompsonmanda08/task-sync/utils"
+	"gorm.io/gorm"
+)
+
+// Deleting a list or a todo only soft-deletes it: it moves to the trash, from where it
+// can be restored until it is purged. Todos deleted together (a todo and its subtasks,
+// or the todos of a deleted list) share the same deleted_at and are restored together.
+
+const purgeBatchSize = 500
+
+var (
+	ErrNotInTrash  = errors.New("item is not in the trash")
+	ErrListInTrash = errors.New("todo list is in the trash")
+)
+
+// GetTrash lists the deleted todo lists owned by the user and the deleted todos of the
+// lists the user can access, most recently deleted first
+func GetTrash(c *fiber.Ctx) error {
+	db := database.DBConn
+	userID := c.Locals("userID").(string)
+	retention := utils.TrashRetention()
+
+	lists := []models.TrashedTodoList{}
+	if err := db.Unscoped().Model(&models.TodoList{}).
+		Select("todo_lists.id, todo_lists.name, todo_lists.description, todo_lists.color, todo_lists.deleted_at, "+
+			"(SELECT COUNT(*) FROM todos WHERE todos.todo_list_id = todo_lists.id AND todos.deleted_at = todo_lists.deleted_at) AS todo_items_count").
+		Where("todo_lists.owner_id = ? AND todo_lists.deleted_at IS NOT NULL", userID).
+		Order("todo_lists.deleted_at DESC").
+		Scan(&lists).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve deleted Todo Lists", err)
+	}
+
+	// ONLY THE ROOT OF EACH DELETED SUBTREE IS LISTED, ITS SUBTASKS ARE COUNTED
+	todos := []models.TrashedTodo{}
+	if err := db.Unscoped().Model(&models.Todo{}).
+		Select("todos.id, todos.task, todos.todo_list_id, todo_lists.name AS todo_list_name, todos.deleted_at, "+
+			"(SELECT COUNT(*) FROM todos AS deleted WHERE deleted.todo_list_id = todos.todo_list_id AND deleted.deleted_at = todos.deleted_at) - 1 AS subtasks_count").
+		Joins("JOIN todo_lists ON todo_lists.id = todos.todo_list_id").
+		Where("todos.deleted_at IS NOT NULL AND todos.todo_list_id IN (?)", utils.AccessibleListIDs(db, userID)).
+		Where("todos.parent_id IS NULL OR NOT EXISTS (SELECT 1 FROM todos AS parent WHERE parent.id = todos.parent_id AND parent.deleted_at = todos.deleted_at)").
+		Order("todos.deleted_at DESC").
+		Scan(&todos).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve deleted todos", err)
+	}
+
+	for i := range lists {
+		lists[i].PurgeAt = lists[i].DeletedAt.Add(retention)
+	}
+
+	for i := range todos {
+		todos[i].PurgeAt = todos[i].DeletedAt.Add(retention)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Trash retrieved successfully",
+		"data": fiber.Map{
+			"todo_lists":     lists,
+			"todos":          todos,
+			"retention_days": int(retention.Hours() / 24),
+		},
+		"status": fiber.StatusOK,
+	})
+}
+
+// RestoreTodoList restores a deleted todo list together with the todos deleted with it.
+// Only the owner can restore a list. If another list took its position meanwhile, the
+// restored list is placed first.
+func RestoreTodoList(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	db := database.WithActor(database.DBConn, userID)
+
+	todoList, err := findTrashedTodoList(db, userID, c.Params("list_id"))
+	if err != nil {
+		return sendTrashError(c, err)
+	}
+
+	var restoredCount int64
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := lockOwnerLists(tx, userID); err != nil {
+			return err
+		}
+
+		// THE TODOS GO FIRST, SO GROUP ACTIVITY FEEDS REPORT THE LIST RATHER THAN EACH OF ITS TODOS
+		result := tx.Unscoped().Model(&models.Todo{}).
+			Where("todo_list_id = ? AND deleted_at = ?", todoList.ID, todoList.DeletedAt.Time).
+			Update("deleted_at", nil)
+		if result.Error != nil {
+			return result.Error
+		}
+		restoredCount = result.RowsAffected
+
+		if err := tx.Unscoped().Model(&models.TodoList{}).Where("id = ?", todoList.ID).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+
+		var conflicts int64
+		if err := tx.Model(&models.TodoList{}).
+			Where("owner_id = ? AND id <> ? AND position = ?", userID, todoList.ID, todoList.Position).
+			Count(&conflicts).Error; err != nil {
+			return err
+		}
+
+		if conflicts > 0 || todoList.Position == "" {
+			position, err := firstListPosition(tx, userID)
+			if err != nil {
+				return err
+			}
+			todoList.Position = position
+
+			return tx.Model(&models.TodoList{}).Where("id = ?", todoList.ID).Update("position", position).Error
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to restore Todo List", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Todo List restored successfully",
+		"data": fiber.Map{
+			"id":                   todoList.ID,
+			"position":             todoList.Position,
+			"restored_items_count": restoredCount,
+		},
+		"status": fiber.StatusOK,
+	})
+}
+
+// RestoreTodoItem restores a deleted todo together with the subtasks deleted with it. The
+// user needs write access to its list, which must not be in the trash itself. A todo
+// whose parent is still deleted is restored as a top-level todo, and restored todos
+// whose position was taken meanwhile are moved to the end of the list.
+func RestoreTodoItem(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	db := database.WithActor(database.DBConn, userID)
+
+	todoList, todo, err := findTrashedTodo(db, userID, c.Params("task_id"))
+	if err != nil {
+		return sendTrashError(c, err)
+	}
+
+	var todoIDs []string
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := lockTodoList(tx, todoList.ID); err != nil {
+			return err
+		}
+
+		ids, err := deletedSubtreeIDs(tx, []string{todo.ID}, &todo.DeletedAt.Time)
+		if err != nil {
+			return err
+		}
+		todoIDs = ids
+
+		if err := tx.Unscoped().Model(&models.Todo{}).Where("id IN ?", todoIDs).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+
+		// 1. DETACH FROM A PARENT THAT IS GONE OR WAS MOVED AWAY
+		if todo.ParentID != nil {
+			var parents int64
+			if err := tx.Model(&models.Todo{}).Where("id = ? AND todo_list_id = ?", *todo.ParentID, todoList.ID).Count(&parents).Error; err != nil {
+				return err
+			}
+
+			if parents == 0 {
+				if err := tx.Model(&models.Todo{}).Where("id = ?", todo.ID).Update("parent_id", nil).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		// 2. MOVE TODOS WHOSE POSITION WAS TAKEN TO THE END OF THE LIST
+		var conflicting []models.Todo
+		if err := tx.Select("id").
+			Where("id IN ? AND position IN (?)", todoIDs,
+				tx.Model(&models.Todo{}).Select("position").Where("todo_list_id = ? AND id NOT IN ?", todoList.ID, todoIDs)).
+			Order("position ASC, id ASC").
+			Find(&conflicting).Error; err != nil {
+			return err
+		}
+
+		positions, err := appendPositions(tx, todoList.ID, len(conflicting))
+		if err != nil {
+			return err
+		}
+
+		for i, item := range conflicting {
+			if err := tx.Model(&models.Todo{}).Where("id = ?", item.ID).Update("position", positions[i]).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to restore todo", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Todo restored successfully",
+		"data": fiber.Map{
+			"id":                   todo.ID,
+			"todo_list_id":         todoList.ID,
+			"restored_items_count": len(todoIDs),
+		},
+		"status": fiber.StatusOK,
+	})
+}
+
+// PurgeTodoList permanently deletes a todo list from the trash, with all its todos,
+// comments and attachments. Only the owner can purge a list.
+func PurgeTodoList(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	db := database.WithActor(database.DBConn, userID)
+
+	todoList, err := findTrashedTodoList(db, userID, c.Params("list_id"))
+	if err != nil {
+		return sendTrashError(c, err)
+	}
+
+	if err := purgeTodoList(c.UserContext(), db, todoList.ID); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to purge Todo List", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Todo List permanently deleted",
+		"data":    fiber.Map{"id": todoList.ID},
+		"status":  fiber.StatusOK,
+	})
+}
+
+// PurgeTodoItem permanently deletes a todo from the trash, with its subtasks, comments
+// and attachments. The user needs write access to its list.
+func PurgeTodoItem(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	db := database.WithActor(database.DBConn, userID)
+
+	_, todo, err := findTrashedTodo(db, userID, c.Params("task_id"))
+	if err != nil {
+		return sendTrashError(c, err)
+	}
+
+	todoIDs, err := deletedSubtreeIDs(db, []string{todo.ID}, nil)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve subtasks", err)
+	}
+
+	if err := purgeTodos(c.UserContext(), db, todoIDs); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to purge todo", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Todo permanently deleted",
+		"data":    fiber.Map{"id": todo.ID, "purged_items_count": len(todoIDs)},
+		"status":  fiber.StatusOK,
+	})
+}
+
+// PurgeExpiredTrash permanently deletes the lists and todos that were deleted before the
+// given time. It is run periodically by the trash purge job.
+func PurgeExpiredTrash(ctx context.Context, db *gorm.DB, before time.Time) (int, error) {
+	purged := 0
+
+	var listIDs []string
+	if err := db.Unscoped().Model(&models.TodoList{}).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+		Pluck("id", &listIDs).Error; err != nil {
+		return purged, err
+	}
+
+	for _, listID := range listIDs {
+		if err := purgeTodoList(ctx, db, listID); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+
+	for {
+		var rootIDs []string
+		if err := db.Unscoped().Model(&models.Todo{}).
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+			Limit(purgeBatchSize).
+			Pluck("id", &rootIDs).Error; err != nil {
+			return purged, err
+		}
+
+		if len(rootIDs) == 0 {
+			return purged, nil
+		}
+
+		todoIDs, err := deletedSubtreeIDs(db, rootIDs, nil)
+		if err != nil {
+			return purged, err
+		}
+
+		if err := purgeTodos(ctx, db, todoIDs); err != nil {
+			return purged, err
+		}
+		purged += len(rootIDs)
+	}
+}
+
+// findTrashedTodoList loads a deleted todo list owned by the user
+func findTrashedTodoList(db *gorm.DB, userID string, listID string) (*models.TodoList, error) {
+	var todoList models.TodoList
+	if err := db.Unscoped().
+		Where("id = ? AND owner_id = ? AND deleted_at IS NOT NULL", listID, userID).
+		First(&todoList).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotInTrash
+		}
+		return nil, err
+	}
+
+	return &todoList, nil
+}
+
+// findTrashedTodo loads a deleted todo and checks the user has write access to its list,
+// which must not be deleted itself
+func findTrashedTodo(db *gorm.DB, userID string, taskID string) (*models.TodoList, *models.Todo, error) {
+	var todo models.Todo
+	if err := db.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", taskID).First(&todo).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrNotInTrash
+		}
+		return nil, nil, err
+	}
+
+	todoList, err := utils.FindAccessibleTodoList(db, userID, todo.TodoListID, true)
+	if errors.Is(err, utils.ErrListNotFound) {
+		return nil, nil, ErrListInTrash
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return todoList, &todo, nil
+}
+
+// deletedSubtreeIDs returns the IDs of todos and of all their subtasks, deleted or not.
+// With deletedAt set, only the subtasks deleted at that time, i.e. together with the
+// todo, are followed.
+func deletedSubtreeIDs(db *gorm.DB, rootIDs []string, deletedAt *time.Time) ([]string, error) {
+	sameDeletion := ""
+	args := []interface{}{rootIDs}
+	if deletedAt != nil {
+		sameDeletion = "WHERE todos.deleted_at = ?"
+		args = append(args, *deletedAt)
+	}
+
+	var ids []string
+	err := db.Raw(`
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM todos WHERE id IN ?
+			UNION
+			SELECT todos.id FROM todos
+			JOIN subtree ON todos.parent_id = subtree.id
+			`+sameDeletion+`
+		)
+		SELECT id FROM subtree`, args...).
+		Scan(&ids).Error
+
+	return ids, err
+}
+
+// purgeTodos permanently deletes todos. Their attachments are removed first so unused
+// files are garbage-collected; comments and dependencies go with the todos.
+func purgeTodos(ctx context.Context, db *gorm.DB, todoIDs []string) error {
+	if len(todoIDs) == 0 {
+		return nil
+	}
+
+	if err := deleteAttachments(ctx, db, "todo_id IN ?", todoIDs); err != nil {
+		return err
+	}
+
+	return db.Unscoped().Where("id IN ?", todoIDs).Delete(&models.Todo{}).Error
+}
+
+// purgeTodoList permanently deletes a todo list; its todos are purged first so their
+// attachments are garbage-collected
+func purgeTodoList(ctx context.Context, db *gorm.DB, listID string) error {
+	var todoIDs []string
+	if err := db.Unscoped().Model(&models.Todo{}).Where("todo_list_id = ?", listID).Pluck("id", &todoIDs).Error; err != nil {
+		return err
+	}
+
+	if err := purgeTodos(ctx, db, todoIDs); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM shared_with WHERE todo_list_id = ?", listID).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Where("id = ?", listID).Delete(&models.TodoList{}).Error
+	})
+}
+
+// sendTrashError maps the errors returned by the trash helpers to an error response
+func sendTrashError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, ErrNotInTrash):
+		return utils.SendErrorResponse(c, fiber.StatusNotFound, "Item not found in the trash", err)
+	case errors.Is(err, ErrListInTrash):
+		return utils.SendErrorResponse(c, fiber.StatusConflict, "The todo list of this todo is in the trash, restore the list first", err)
+	default:
+		return sendAccessError(c, err)
+	}
+}
@@ -1,13 +1,21 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/log"
 	"github.com/thompsonmanda08/task-sync/database"
 	"github.com/thompsonmanda08/task-sync/models"
+	"github.com/thompsonmanda08/task-sync/storage"
 	"github.com/thompsonmanda08/task-sync/utils"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
@@ -147,8 +155,9 @@ func RegisterNewUser(c *fiber.Ctx) error {
 
 		// 2. Create default list with the user's ID
 		defaultList := models.TodoList{
-			Name:    "DEFAULT",
-			OwnerID: user.ID, // Using the user's UUID
+			Name:     "DEFAULT",
+			OwnerID:  user.ID, // Using the user's UUID
+			Position: utils.FirstPosition,
 			// GroupID: "",
 		}
 
@@ -460,34 +469,54 @@ func ChangeUserPassword(c *fiber.Ctx) error {
 	})
 }
 
-// UpdateProfileImage updates the user's profile picture with the provided URL.
+// UpdateProfileImage uploads a new profile picture for the user.
 //
-// The function takes a URL for the user's profile picture and updates the user's
-// profile picture in the database. If the request body is invalid, the function
-// returns a 400 Bad Request status with an appropriate error message. If the user
-// is not found, the function returns a 404 Not Found status with an appropriate
-// error message. If there is an error while updating the user's profile picture,
-// the function returns a 500 Internal Server Error status with an appropriate
-// error message. On success, the function returns a 200 OK status with the
-// updated user profile in the response.
+// The image is read from the "image" field of a multipart form and must be a JPEG, PNG,
+// GIF or WebP file of at most PROFILE_IMAGE_MAX_SIZE_MB. It is cropped to a square and
+// re-encoded into one JPEG per size in profileImageSizes, which strips EXIF metadata.
+// The variants are kept in file storage and the user's profile_picture is set to the
+// managed URL of the default size. If the upload is invalid, the function returns a 400
+// Bad Request or 415 Unsupported Media Type status. If the user is not found, it returns
+// a 404 Not Found status. On success, the function returns a 200 OK status with the URLs
+// of every variant.
 func UpdateProfileImage(c *fiber.Ctx) error {
 	db := database.DBConn
 	userID := c.Locals("userID").(string)
 
-	var request struct {
-		Image string `json:"profile_picture"`
-	}
-
-	// Parse the request body
-	if err := c.BodyParser(&request); err != nil {
+	fileHeader, err := c.FormFile("image")
+	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"success": false,
-			"message": "Invalid request body",
+			"message": "Profile picture is required",
 			"status":  fiber.StatusBadRequest,
-			"data":    fiber.Map{"error": err.Error()},
+			"data":    fiber.Map{"error": "An image file is required in the \"image\" form field"},
 		})
 	}
 
+	maxSize := profileImageMaxSize()
+	if fileHeader.Size > maxSize {
+		return utils.SendErrorResponse(c, fiber.StatusRequestEntityTooLarge, "Profile picture is too large", fmt.Errorf("images must be at most %d bytes", maxSize))
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Failed to read uploaded image", err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Failed to read uploaded image", err)
+	}
+
+	if int64(len(data)) > maxSize {
+		return utils.SendErrorResponse(c, fiber.StatusRequestEntityTooLarge, "Profile picture is too large", fmt.Errorf("images must be at most %d bytes", maxSize))
+	}
+
+	if !allowedProfileImageTypes[detectContentType(data)] {
+		return utils.SendErrorResponse(c, fiber.StatusUnsupportedMediaType, "Profile picture must be a JPEG, PNG, GIF or WebP image", utils.ErrUnsupportedImage)
+	}
+
 	var user models.User
 
 	// Find the user by ID
@@ -508,16 +537,24 @@ func UpdateProfileImage(c *fiber.Ctx) error {
 		})
 	}
 
-	if request.Image == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"success": false,
-			"message": "Profile picture URL is required",
-			"status":  fiber.StatusBadRequest,
-			"data":    fiber.Map{"error": "Profile picture URL is required"},
-		})
+	variants, err := utils.ResizeSquareImages(data, profileImageSizes)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Failed to process profile picture", err)
 	}
 
-	if err := db.Model(&user).Updates(request).Error; err != nil {
+	// EVERY UPLOAD GETS A NEW FOLDER SO CACHED URLS OF THE OLD PICTURE NEVER SERVE THE NEW ONE
+	avatarID := utils.GenerateCUID()
+	for size, variant := range variants {
+		if err := storage.Store.Put(c.UserContext(), avatarStorageKey(avatarID, size), bytes.NewReader(variant), int64(len(variant)), "image/jpeg"); err != nil {
+			deleteAvatarVariants(c.UserContext(), avatarID)
+			return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to store profile picture", err)
+		}
+	}
+
+	previousAvatarID := user.AvatarID
+
+	if err := db.Model(&user).Updates(models.User{Image: avatarURL(avatarID, defaultProfileImageSize), AvatarID: avatarID}).Error; err != nil {
+		deleteAvatarVariants(c.UserContext(), avatarID)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
 			"message": "Failed to update user profile picture",
@@ -526,10 +563,76 @@ func UpdateProfileImage(c *fiber.Ctx) error {
 		})
 	}
 
+	if previousAvatarID != "" {
+		deleteAvatarVariants(c.UserContext(), previousAvatarID)
+	}
+
+	variantURLs := make(fiber.Map, len(profileImageSizes))
+	for _, size := range profileImageSizes {
+		variantURLs[strconv.Itoa(size)] = avatarURL(avatarID, size)
+	}
+
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"success": true,
 		"status":  fiber.StatusOK,
 		"message": "User profile picture updated successfully",
-		"data":    fiber.Map{"profile_picture": user.Image},
+		"data":    fiber.Map{"profile_picture": user.Image, "variants": variantURLs},
 	})
 }
+
+// GetProfileImage serves a stored profile picture variant. It is a public route so the
+// URL saved in profile_picture can be used directly in <img> tags.
+func GetProfileImage(c *fiber.Ctx) error {
+	size, err := strconv.Atoi(c.Params("size"))
+	if err != nil || !slices.Contains(profileImageSizes, size) {
+		return utils.SendErrorResponse(c, fiber.StatusNotFound, "Profile picture not found", errors.New("unknown profile picture size"))
+	}
+
+	reader, err := storage.Store.Get(c.UserContext(), avatarStorageKey(c.Params("avatar_id"), size))
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			return utils.SendErrorResponse(c, fiber.StatusNotFound, "Profile picture not found", err)
+		}
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to read profile picture", err)
+	}
+
+	c.Set(fiber.HeaderContentType, "image/jpeg")
+	c.Set(fiber.HeaderCacheControl, "public, max-age=31536000, immutable") // Variants never change once written
+
+	return c.Status(fiber.StatusOK).SendStream(reader)
+}
+
+const defaultProfileImageSize = 256
+
+var profileImageSizes = []int{64, 256}
+
+var allowedProfileImageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+func profileImageMaxSize() int64 {
+	sizeMB, err := strconv.ParseInt(os.Getenv("PROFILE_IMAGE_MAX_SIZE_MB"), 10, 64)
+	if err != nil || sizeMB <= 0 {
+		sizeMB = 5
+	}
+	return sizeMB << 20
+}
+
+func avatarStorageKey(avatarID string, size int) string {
+	return fmt.Sprintf("avatars/%s/%d.jpg", avatarID, size)
+}
+
+func avatarURL(avatarID string, size int) string {
+	return fmt.Sprintf("/api/v1/avatars/%s/%d", avatarID, size)
+}
+
+func deleteAvatarVariants(ctx context.Context, avatarID string) {
+	for _, size := range profileImageSizes {
+		if err := storage.Store.Delete(ctx, avatarStorageKey(avatarID, size)); err != nil {
+			log.Errorf("Failed to delete profile picture %s: %v", avatarStorageKey(avatarID, size), err)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thompsonmanda08/task-sync/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrVersionMismatch is returned when a record was changed since the version named in
+// the If-Match header of a request
+var ErrVersionMismatch = errors.New("record was changed since it was read")
+
+// checkIfMatch locks a versioned record until the end of the transaction and checks its
+// version against the If-Match header of the request
+func checkIfMatch(c *fiber.Ctx, tx *gorm.DB, model interface{}, id string) error {
+	if c.Get(fiber.HeaderIfMatch) == "" {
+		return nil
+	}
+
+	var versions []int64
+	if err := tx.Model(model).Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).Pluck("version", &versions).Error; err != nil {
+		return err
+	}
+
+	if len(versions) == 0 || !utils.IfMatch(c, versions[0]) {
+		return ErrVersionMismatch
+	}
+	return nil
+}
+
+// sendPreconditionFailed responds to an update whose If-Match header does not match,
+// with the current state of the record
+func sendPreconditionFailed(c *fiber.Ctx, version int64, current interface{}) error {
+	c.Set(fiber.HeaderETag, utils.ETag(version))
+
+	return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{
+		"success": false,
+		"message": "The record was changed by someone else, review the current version and retry",
+		"data":    current,
+		"status":  fiber.StatusPreconditionFailed,
+	})
+}
@@ -0,0 +1,390 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thompsonmanda08/task-sync/database"
+	"github.com/thompsonmanda08/task-sync/models"
+	"github.com/thompsonmanda08/task-sync/utils"
+	"github.com/thompsonmanda08/task-sync/webhooks"
+	"gorm.io/gorm"
+)
+
+const (
+	maxWebhooksPerGroup      = 20
+	maxWebhookDescriptionLen = 255
+)
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// GetGroupWebhooks lists the webhooks of a group
+func GetGroupWebhooks(c *fiber.Ctx) error {
+	db := database.DBConn
+
+	var hooks []models.Webhook
+	if err := db.Where("group_id = ?", c.Params("group_id")).Order("created_at ASC").Find(&hooks).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve webhooks", err)
+	}
+
+	response := make([]models.WebhookResponse, 0, len(hooks))
+	for _, hook := range hooks {
+		response = append(response, toWebhookResponse(hook, false))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Webhooks retrieved successfully",
+		"data":    response,
+		"status":  fiber.StatusOK,
+	})
+}
+
+// CreateGroupWebhook registers a webhook receiving a set of activity types of a group.
+// The secret signing its deliveries is only returned in the response.
+func CreateGroupWebhook(c *fiber.Ctx) error {
+	db := database.DBConn
+	userID := c.Locals("userID").(string)
+	groupID := c.Params("group_id")
+
+	var request struct {
+		URL         string   `json:"url"`
+		Events      []string `json:"events"`
+		Description string   `json:"description"`
+		Active      *bool    `json:"active"`
+	}
+
+	if err := c.BodyParser(&request); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid request body", err)
+	}
+
+	// 1. THE ENDPOINT AND THE EVENTS IT RECEIVES
+	request.URL = strings.TrimSpace(request.URL)
+	if err := webhooks.ValidateURL(request.URL, utils.WebhookAllowPrivateURLs()); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid webhook URL", err)
+	}
+
+	events, err := parseWebhookEvents(request.Events)
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid webhook events", err)
+	}
+
+	if len(request.Description) > maxWebhookDescriptionLen {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Description is too long", fmt.Errorf("description must be at most %d characters", maxWebhookDescriptionLen))
+	}
+
+	// 2. LIMIT THE WEBHOOKS OF A GROUP
+	var count int64
+	if err := db.Model(&models.Webhook{}).Where("group_id = ?", groupID).Count(&count).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to create webhook", err)
+	}
+
+	if count >= maxWebhooksPerGroup {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Too many webhooks in this group", fmt.Errorf("a group can have at most %d webhooks", maxWebhooksPerGroup))
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to create webhook", err)
+	}
+
+	hook := models.Webhook{
+		GroupID:     groupID,
+		CreatedByID: userID,
+		URL:         request.URL,
+		Description: strings.TrimSpace(request.Description),
+		Secret:      secret,
+		Events:      strings.Join(events, ","),
+		Active:      request.Active == nil || *request.Active,
+	}
+
+	if err := db.Create(&hook).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to create webhook", err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"message": "Webhook created successfully, store the secret as it will not be shown again",
+		"data":    toWebhookResponse(hook, true),
+		"status":  fiber.StatusCreated,
+	})
+}
+
+// UpdateGroupWebhook changes the URL, events, description or state of a webhook. The
+// deliveries of a deactivated webhook wait until it is active again.
+func UpdateGroupWebhook(c *fiber.Ctx) error {
+	db := database.DBConn
+
+	hook, err := findGroupWebhook(db, c.Params("group_id"), c.Params("webhook_id"))
+	if err != nil {
+		return sendWebhookError(c, err)
+	}
+
+	var request struct {
+		URL         *string   `json:"url"`
+		Events      *[]string `json:"events"`
+		Description *string   `json:"description"`
+		Active      *bool     `json:"active"`
+	}
+
+	if err := c.BodyParser(&request); err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid request body", err)
+	}
+
+	updates := map[string]interface{}{}
+
+	if request.URL != nil {
+		url := strings.TrimSpace(*request.URL)
+		if err := webhooks.ValidateURL(url, utils.WebhookAllowPrivateURLs()); err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid webhook URL", err)
+		}
+		updates["url"] = url
+	}
+
+	if request.Events != nil {
+		events, err := parseWebhookEvents(*request.Events)
+		if err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid webhook events", err)
+		}
+		updates["events"] = strings.Join(events, ",")
+	}
+
+	if request.Description != nil {
+		if len(*request.Description) > maxWebhookDescriptionLen {
+			return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Description is too long", fmt.Errorf("description must be at most %d characters", maxWebhookDescriptionLen))
+		}
+		updates["description"] = strings.TrimSpace(*request.Description)
+	}
+
+	if request.Active != nil {
+		updates["active"] = *request.Active
+	}
+
+	if len(updates) > 0 {
+		if err := db.Model(hook).Updates(updates).Error; err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to update webhook", err)
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Webhook updated successfully",
+		"data":    toWebhookResponse(*hook, false),
+		"status":  fiber.StatusOK,
+	})
+}
+
+// RotateWebhookSecret replaces the secret of a webhook. Deliveries attempted from then on
+// are signed with the new secret, which is only returned in the response.
+func RotateWebhookSecret(c *fiber.Ctx) error {
+	db := database.DBConn
+
+	hook, err := findGroupWebhook(db, c.Params("group_id"), c.Params("webhook_id"))
+	if err != nil {
+		return sendWebhookError(c, err)
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to rotate webhook secret", err)
+	}
+
+	if err := db.Model(hook).Update("secret", secret).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to rotate webhook secret", err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Webhook secret rotated successfully, store the secret as it will not be shown again",
+		"data":    toWebhookResponse(*hook, true),
+		"status":  fiber.StatusOK,
+	})
+}
+
+// DeleteGroupWebhook deletes a webhook along with its pending deliveries and delivery log
+func DeleteGroupWebhook(c *fiber.Ctx) error {
+	db := database.DBConn
+
+	result := db.Where("id = ? AND group_id = ?", c.Params("webhook_id"), c.Params("group_id")).Delete(&models.Webhook{})
+	if result.Error != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to delete webhook", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return sendWebhookError(c, ErrWebhookNotFound)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Webhook deleted successfully",
+		"data":    fiber.Map{"id": c.Params("webhook_id")},
+		"status":  fiber.StatusOK,
+	})
+}
+
+// GetWebhookDeliveries returns the delivery log of a webhook, newest first and
+// paginated. The log can be filtered by "status": pending, delivered or failed.
+func GetWebhookDeliveries(c *fiber.Ctx) error {
+	db := database.DBConn
+	pagination := utils.GetPagination(c)
+
+	hook, err := findGroupWebhook(db, c.Params("group_id"), c.Params("webhook_id"))
+	if err != nil {
+		return sendWebhookError(c, err)
+	}
+
+	query := db.Model(&models.WebhookDelivery{}).Where("webhook_id = ?", hook.ID)
+
+	if status := c.Query("status"); status != "" {
+		if status != models.DeliveryPending && status != models.DeliveryDelivered && status != models.DeliveryFailed {
+			return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid delivery status", fmt.Errorf("%w: status must be pending, delivered or failed", utils.ErrInvalidFilter))
+		}
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve webhook deliveries", err)
+	}
+
+	var deliveries []models.WebhookDelivery
+	if err := query.
+		Order("created_at DESC, id DESC").
+		Limit(pagination.Limit).
+		Offset(pagination.Offset).
+		Find(&deliveries).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve webhook deliveries", err)
+	}
+
+	response := make([]models.WebhookDeliveryResponse, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		response = append(response, toWebhookDeliveryResponse(delivery))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Webhook deliveries retrieved successfully",
+		"data": fiber.Map{
+			"deliveries": response,
+			"count":      len(response),
+			"total":      total,
+			"page":       pagination.Page,
+			"limit":      pagination.Limit,
+		},
+		"status": fiber.StatusOK,
+	})
+}
+
+// RedeliverWebhookDelivery sends a delivery again, whatever its outcome, as a new
+// delivery with the same payload. It is attempted by the next run of the webhooks job.
+func RedeliverWebhookDelivery(c *fiber.Ctx) error {
+	db := database.DBConn
+
+	hook, err := findGroupWebhook(db, c.Params("group_id"), c.Params("webhook_id"))
+	if err != nil {
+		return sendWebhookError(c, err)
+	}
+
+	if !hook.Active {
+		return utils.SendErrorResponse(c, fiber.StatusConflict, "Activate the webhook to redeliver", errors.New("webhook is inactive"))
+	}
+
+	var original models.WebhookDelivery
+	if err := db.Where("id = ? AND webhook_id = ?", c.Params("delivery_id"), hook.ID).First(&original).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return utils.SendErrorResponse(c, fiber.StatusNotFound, "Delivery not found", err)
+		}
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve delivery", err)
+	}
+
+	now := time.Now()
+	delivery := models.WebhookDelivery{
+		WebhookID:     hook.ID,
+		Event:         original.Event,
+		Payload:       original.Payload,
+		RedeliveryOf:  &original.ID,
+		Status:        models.DeliveryPending,
+		NextAttemptAt: &now,
+	}
+
+	if err := db.Create(&delivery).Error; err != nil {
+		return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to redeliver", err)
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"success": true,
+		"message": "Redelivery scheduled successfully",
+		"data":    toWebhookDeliveryResponse(delivery),
+		"status":  fiber.StatusAccepted,
+	})
+}
+
+// parseWebhookEvents checks a set of activity types to subscribe to, dropping duplicates
+func parseWebhookEvents(values []string) ([]string, error) {
+	events := []string{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if !slices.Contains(models.ActivityTypes, value) {
+			return nil, fmt.Errorf("unknown event %q, events must be activity types", value)
+		}
+		if !slices.Contains(events, value) {
+			events = append(events, value)
+		}
+	}
+
+	if len(events) == 0 {
+		return nil, errors.New("at least one event is required")
+	}
+	return events, nil
+}
+
+func findGroupWebhook(db *gorm.DB, groupID string, webhookID string) (*models.Webhook, error) {
+	var hook models.Webhook
+	if err := db.Where("id = ? AND group_id = ?", webhookID, groupID).First(&hook).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, fmt.Errorf("failed to retrieve webhook: %w", err)
+	}
+	return &hook, nil
+}
+
+func sendWebhookError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, ErrWebhookNotFound) {
+		return utils.SendErrorResponse(c, fiber.StatusNotFound, "Webhook not found", err)
+	}
+	return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to retrieve webhook", err)
+}
+
+// toWebhookResponse returns a webhook as sent to clients, with its secret when it was
+// just created or rotated
+func toWebhookResponse(hook models.Webhook, withSecret bool) models.WebhookResponse {
+	response := models.WebhookResponse{
+		ID:          hook.ID,
+		GroupID:     hook.GroupID,
+		URL:         hook.URL,
+		Description: hook.Description,
+		Events:      hook.EventList(),
+		Active:      hook.Active,
+		CreatedByID: hook.CreatedByID,
+		CreatedAt:   hook.CreatedAt,
+		UpdatedAt:   hook.UpdatedAt,
+	}
+
+	if withSecret {
+		response.Secret = hook.Secret
+	}
+	return response
+}
+
+func toWebhookDeliveryResponse(delivery models.WebhookDelivery) models.WebhookDeliveryResponse {
+	return models.WebhookDeliveryResponse{
+		WebhookDelivery: delivery,
+		Payload:         json.RawMessage(delivery.Payload),
+	}
+}
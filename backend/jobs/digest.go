@@ -0,0 +1,31 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/thompsonmanda08/task-sync/digest"
+	"github.com/thompsonmanda08/task-sync/notify"
+	"gorm.io/gorm"
+)
+
+// StartDigests schedules the job sending daily and weekly digest emails. It runs every
+// DIGEST_INTERVAL_MINUTES, every 15 minutes by default, and is safe to run on every app
+// instance. Digests are off when no mail server is configured.
+func StartDigests(db *gorm.DB, mailer notify.Mailer) {
+	if mailer == nil {
+		log.Info("Digests disabled: SMTP_HOST is not set")
+		return
+	}
+
+	interval := intervalFromEnv("DIGEST_INTERVAL_MINUTES", 15*time.Minute)
+
+	Schedule("digests", interval, func(ctx context.Context) error {
+		sent, err := digest.SendDue(ctx, db, mailer, time.Now())
+		if sent > 0 {
+			log.Infof("Sent %d digests", sent)
+		}
+		return err
+	})
+}
@@ -0,0 +1,26 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/thompsonmanda08/task-sync/middleware"
+	"github.com/thompsonmanda08/task-sync/utils"
+	"gorm.io/gorm"
+)
+
+// StartIdempotencyPurge schedules the job deleting the idempotency keys older than the
+// retention period (IDEMPOTENCY_RETENTION_HOURS). It runs every
+// IDEMPOTENCY_PURGE_INTERVAL_MINUTES, hourly by default.
+func StartIdempotencyPurge(db *gorm.DB) {
+	interval := intervalFromEnv("IDEMPOTENCY_PURGE_INTERVAL_MINUTES", time.Hour)
+
+	Schedule("idempotency-purge", interval, func(ctx context.Context) error {
+		purged, err := middleware.PurgeExpiredIdempotencyKeys(ctx, db, time.Now().Add(-utils.IdempotencyRetention()))
+		if purged > 0 {
+			log.Infof("Purged %d expired idempotency keys", purged)
+		}
+		return err
+	})
+}
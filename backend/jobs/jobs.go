@@ -0,0 +1,59 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+)
+
+// Schedule runs a job in the background now and then every interval, for the lifetime of
+// the process. A run that fails or panics is logged and the job runs again at the next
+// tick.
+func Schedule(name string, interval time.Duration, run func(ctx context.Context) error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := runOnce(run); err != nil {
+				log.Errorf("Job %s failed: %v", name, err)
+			}
+			<-ticker.C
+		}
+	}()
+
+	log.Infof("Scheduled job %s every %s", name, interval)
+}
+
+func runOnce(run func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return run(context.Background())
+}
+
+// intervalFromEnv reads a job interval in minutes from an environment variable
+func intervalFromEnv(key string, fallback time.Duration) time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || minutes <= 0 {
+		return fallback
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// secondsFromEnv reads a job interval in seconds from an environment variable, for jobs
+// running more often than every minute
+func secondsFromEnv(key string, fallback time.Duration) time.Duration {
+	seconds, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || seconds <= 0 {
+		return fallback
+	}
+	return time.Duration(seconds) * time.Second
+}
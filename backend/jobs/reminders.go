@@ -0,0 +1,26 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/thompsonmanda08/task-sync/handlers"
+	"github.com/thompsonmanda08/task-sync/notify"
+	"gorm.io/gorm"
+)
+
+// StartReminders schedules the job delivering due reminders. It runs every
+// REMINDER_INTERVAL_MINUTES, every minute by default, and is safe to run on every app
+// instance.
+func StartReminders(db *gorm.DB, notifier *notify.Notifier) {
+	interval := intervalFromEnv("REMINDER_INTERVAL_MINUTES", time.Minute)
+
+	Schedule("reminders", interval, func(ctx context.Context) error {
+		delivered, err := handlers.DeliverDueReminders(ctx, db, notifier, time.Now())
+		if delivered > 0 {
+			log.Infof("Delivered %d reminders", delivered)
+		}
+		return err
+	})
+}
@@ -0,0 +1,26 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/thompsonmanda08/task-sync/handlers"
+	"github.com/thompsonmanda08/task-sync/utils"
+	"gorm.io/gorm"
+)
+
+// StartTrashPurge schedules the job permanently deleting the lists and todos that have
+// been in the trash for longer than the retention period (TRASH_RETENTION_DAYS). It runs
+// every TRASH_PURGE_INTERVAL_MINUTES, hourly by default.
+func StartTrashPurge(db *gorm.DB) {
+	interval := intervalFromEnv("TRASH_PURGE_INTERVAL_MINUTES", time.Hour)
+
+	Schedule("trash-purge", interval, func(ctx context.Context) error {
+		purged, err := handlers.PurgeExpiredTrash(ctx, db, time.Now().Add(-utils.TrashRetention()))
+		if purged > 0 {
+			log.Infof("Purged %d expired items from the trash", purged)
+		}
+		return err
+	})
+}
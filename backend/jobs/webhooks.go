@@ -0,0 +1,38 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/thompsonmanda08/task-sync/utils"
+	"github.com/thompsonmanda08/task-sync/webhooks"
+	"gorm.io/gorm"
+)
+
+// StartWebhooks schedules the job sending the webhook deliveries, every
+// WEBHOOK_INTERVAL_SECONDS (5 seconds by default), and the job deleting the delivery log
+// older than the retention period (WEBHOOK_DELIVERY_RETENTION_DAYS), every
+// WEBHOOK_PURGE_INTERVAL_MINUTES (hourly by default). Both are safe to run on every app
+// instance.
+func StartWebhooks(db *gorm.DB) {
+	sender := webhooks.NewSender(utils.WebhookTimeout(), utils.WebhookAllowPrivateURLs())
+
+	interval := secondsFromEnv("WEBHOOK_INTERVAL_SECONDS", 5*time.Second)
+	Schedule("webhooks", interval, func(ctx context.Context) error {
+		delivered, err := sender.DeliverDue(ctx, db, time.Now())
+		if delivered > 0 {
+			log.Infof("Delivered %d webhooks", delivered)
+		}
+		return err
+	})
+
+	purgeInterval := intervalFromEnv("WEBHOOK_PURGE_INTERVAL_MINUTES", time.Hour)
+	Schedule("webhook-purge", purgeInterval, func(ctx context.Context) error {
+		purged, err := webhooks.PurgeDeliveries(ctx, db, time.Now().Add(-utils.WebhookDeliveryRetention()))
+		if purged > 0 {
+			log.Infof("Purged %d webhook deliveries", purged)
+		}
+		return err
+	})
+}
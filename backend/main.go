@@ -9,11 +9,17 @@ import (
 
 	"github.com/thompsonmanda08/task-sync/database"
 	"github.com/thompsonmanda08/task-sync/handlers"
+	"github.com/thompsonmanda08/task-sync/jobs"
 	"github.com/thompsonmanda08/task-sync/models"
+	"github.com/thompsonmanda08/task-sync/notify"
+	"github.com/thompsonmanda08/task-sync/realtime"
+	"github.com/thompsonmanda08/task-sync/storage"
 )
 
 func main() {
-	app := fiber.New()
+	app := fiber.New(fiber.Config{
+		BodyLimit: 32 * 1024 * 1024, // Leave room for multipart file uploads
+	})
 
 	// COLLECT ALL MODELS IN DB
 	dbModels := []interface{}{
@@ -24,6 +30,19 @@ func main() {
 		&models.TodoList{},
 		&models.Permission{},
 		&models.UserGroupRoleMapping{},
+		&models.Comment{},
+		&models.Blob{},
+		&models.Attachment{},
+		&models.TodoDependency{},
+		&models.ChangeRecord{},
+		&models.Activity{},
+		&models.Notification{},
+		&models.NotificationPreference{},
+		&models.Reminder{},
+		&models.UserPreferences{},
+		&models.IdempotencyKey{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
 	}
 
 	// INITIALIZE DATABASE
@@ -32,9 +51,31 @@ func main() {
 		// panic(err)
 	}
 
+	// INITIALIZE FILE STORAGE
+	if err := storage.Initialize(); err != nil {
+		log.Fatal(err)
+	}
+
+	// INITIALIZE NOTIFICATION CHANNELS
+	if err := notify.Initialize(database.DBConn); err != nil {
+		log.Fatal(err)
+	}
+
+	// INITIALIZE REALTIME EVENTS
+	if err := realtime.Initialize(database.DBConn); err != nil {
+		log.Fatal(err)
+	}
+
 	// SETUP ALL ROUTE HANDLERS
 	handlers.SetupRoutes(app)
 
+	// START BACKGROUND JOBS
+	jobs.StartTrashPurge(database.DBConn)
+	jobs.StartReminders(database.DBConn, notify.Default)
+	jobs.StartDigests(database.DBConn, notify.Mail)
+	jobs.StartIdempotencyPurge(database.DBConn)
+	jobs.StartWebhooks(database.DBConn)
+
 	// DEFINE PORT
 	PORT := os.Getenv("PORT")
 	if PORT == "" {
@@ -0,0 +1,155 @@
+package merge
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxClockDrift is how far ahead of the server's clock a client's timestamp may be.
+// Timestamps further ahead would win every later last-writer-wins merge.
+const MaxClockDrift = 5 * time.Minute
+
+var ErrInvalidTimestamp = errors.New("invalid hybrid logical clock timestamp")
+
+// A Timestamp of a hybrid logical clock: wall time in milliseconds, a counter ordering
+// events within the same millisecond, and the ID of the node that made it, which breaks
+// ties. Its string form, "<millis>-<counter>-<node>" with fixed-width numbers, sorts in
+// timestamp order.
+type Timestamp struct {
+	Millis  int64
+	Counter uint16
+	Node    string
+}
+
+func (t Timestamp) String() string {
+	return fmt.Sprintf("%013d-%04x-%s", t.Millis, t.Counter, t.Node)
+}
+
+func (t Timestamp) IsZero() bool {
+	return t.Millis == 0 && t.Counter == 0 && t.Node == ""
+}
+
+// Compare returns -1, 0 or +1 as t is before, equal to or after u
+func (t Timestamp) Compare(u Timestamp) int {
+	switch {
+	case t.Millis != u.Millis:
+		return compareInts(t.Millis, u.Millis)
+	case t.Counter != u.Counter:
+		return compareInts(int64(t.Counter), int64(u.Counter))
+	default:
+		return strings.Compare(t.Node, u.Node)
+	}
+}
+
+func (t Timestamp) After(u Timestamp) bool {
+	return t.Compare(u) > 0
+}
+
+func compareInts(a int64, b int64) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+// ParseTimestamp parses the string form of a timestamp
+func ParseTimestamp(value string) (Timestamp, error) {
+	parts := strings.SplitN(value, "-", 3)
+	if len(parts) != 3 || len(parts[0]) != 13 || len(parts[1]) != 4 || parts[2] == "" || len(parts[2]) > 64 {
+		return Timestamp{}, ErrInvalidTimestamp
+	}
+
+	millis, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || millis < 0 {
+		return Timestamp{}, ErrInvalidTimestamp
+	}
+
+	counter, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return Timestamp{}, ErrInvalidTimestamp
+	}
+
+	return Timestamp{Millis: millis, Counter: uint16(counter), Node: parts[2]}, nil
+}
+
+// A Clock issues hybrid logical clock timestamps. Timestamps it issues always follow
+// those it issued or observed before, even when the wall clock goes back.
+type Clock struct {
+	mu   sync.Mutex
+	node string
+	last Timestamp
+	now  func() time.Time
+}
+
+// NewClock returns a clock for a node, reading the wall time from now
+func NewClock(node string, now func() time.Time) *Clock {
+	return &Clock{node: node, now: now, last: Timestamp{Node: node}}
+}
+
+// Server is the clock of this server process, with a random node ID
+var Server = NewClock(randomNode(), time.Now)
+
+func randomNode() string {
+	data := make([]byte, 4)
+	if _, err := rand.Read(data); err != nil {
+		return "server"
+	}
+	return hex.EncodeToString(data)
+}
+
+// Now returns a new timestamp
+func (c *Clock) Now() Timestamp {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	wall := c.now().UnixMilli()
+	if wall > c.last.Millis {
+		c.last = Timestamp{Millis: wall, Node: c.node}
+	} else {
+		c.last = c.tick(c.last.Millis, c.last.Counter)
+	}
+	return c.last
+}
+
+// Observe moves the clock past a timestamp received from another node, so the
+// timestamps issued afterwards follow it. Timestamps too far ahead of the wall time are
+// refused.
+func (c *Clock) Observe(remote Timestamp) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	wall := c.now().UnixMilli()
+	if remote.Millis-wall > MaxClockDrift.Milliseconds() {
+		return fmt.Errorf("%w: %s is ahead of the server clock", ErrInvalidTimestamp, remote)
+	}
+
+	switch {
+	case wall > c.last.Millis && wall > remote.Millis:
+		c.last = Timestamp{Millis: wall, Node: c.node}
+	case remote.Millis > c.last.Millis:
+		c.last = c.tick(remote.Millis, remote.Counter)
+	case remote.Millis == c.last.Millis && remote.Counter > c.last.Counter:
+		c.last = c.tick(remote.Millis, remote.Counter)
+	default:
+		c.last = c.tick(c.last.Millis, c.last.Counter)
+	}
+	return nil
+}
+
+// tick returns the timestamp following a millisecond and counter, moving to the next
+// millisecond when the counter overflows
+func (c *Clock) tick(millis int64, counter uint16) Timestamp {
+	if counter == ^uint16(0) {
+		return Timestamp{Millis: millis + 1, Node: c.node}
+	}
+	return Timestamp{Millis: millis, Counter: counter + 1, Node: c.node}
+}
@@ -0,0 +1,247 @@
+package merge
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var wall = time.Date(2026, time.October, 19, 6, 30, 0, 0, time.UTC)
+
+// testClock returns a clock for node "server" whose wall time is set through the
+// returned function
+func testClock() (*Clock, func(time.Time)) {
+	now := wall
+	clock := NewClock("server", func() time.Time { return now })
+	return clock, func(t time.Time) { now = t }
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixMilli()
+}
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  Timestamp
+		err   bool
+	}{
+		{name: "valid", value: "1792391400000-002a-client", want: Timestamp{Millis: 1792391400000, Counter: 42, Node: "client"}},
+		{name: "node with dashes", value: "1792391400000-0000-a-b", want: Timestamp{Millis: 1792391400000, Node: "a-b"}},
+		{name: "empty", value: "", err: true},
+		{name: "missing node", value: "1792391400000-0000-", err: true},
+		{name: "short millis", value: "179239140000-0000-client", err: true},
+		{name: "short counter", value: "1792391400000-000-client", err: true},
+		{name: "counter not hex", value: "1792391400000-zzzz-client", err: true},
+		{name: "negative millis", value: "-792391400000-0000-client", err: true},
+		{name: "node too long", value: "1792391400000-0000-" + strings.Repeat("n", 65), err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseTimestamp(test.value)
+			if test.err {
+				if !errors.Is(err, ErrInvalidTimestamp) {
+					t.Fatalf("ParseTimestamp(%q) error = %v, want ErrInvalidTimestamp", test.value, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTimestamp(%q) error = %v", test.value, err)
+			}
+			if got != test.want {
+				t.Errorf("ParseTimestamp(%q) = %+v, want %+v", test.value, got, test.want)
+			}
+			if got.String() != test.value {
+				t.Errorf("String() = %q, want %q", got.String(), test.value)
+			}
+		})
+	}
+}
+
+func TestTimestampCompare(t *testing.T) {
+	tests := []struct {
+		name string
+		t    Timestamp
+		u    Timestamp
+		want int
+	}{
+		{name: "earlier millis", t: Timestamp{Millis: 1, Counter: 9, Node: "b"}, u: Timestamp{Millis: 2, Node: "a"}, want: -1},
+		{name: "later millis", t: Timestamp{Millis: 2, Node: "a"}, u: Timestamp{Millis: 1, Counter: 9, Node: "b"}, want: 1},
+		{name: "earlier counter", t: Timestamp{Millis: 1, Counter: 1, Node: "b"}, u: Timestamp{Millis: 1, Counter: 2, Node: "a"}, want: -1},
+		{name: "tie broken by node", t: Timestamp{Millis: 1, Counter: 1, Node: "b"}, u: Timestamp{Millis: 1, Counter: 1, Node: "a"}, want: 1},
+		{name: "tie broken by node the other way", t: Timestamp{Millis: 1, Counter: 1, Node: "a"}, u: Timestamp{Millis: 1, Counter: 1, Node: "b"}, want: -1},
+		{name: "equal", t: Timestamp{Millis: 1, Counter: 1, Node: "a"}, u: Timestamp{Millis: 1, Counter: 1, Node: "a"}, want: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.t.Compare(test.u); got != test.want {
+				t.Errorf("Compare() = %d, want %d", got, test.want)
+			}
+			if got := test.t.String() < test.u.String(); got != (test.want < 0) {
+				t.Errorf("string order of %s and %s does not match Compare", test.t, test.u)
+			}
+		})
+	}
+}
+
+func TestClockNow(t *testing.T) {
+	tests := []struct {
+		name  string
+		walls []time.Time // The wall time at each call
+		want  []Timestamp
+	}{
+		{
+			name:  "wall clock moving forward",
+			walls: []time.Time{wall, wall.Add(time.Millisecond), wall.Add(time.Second)},
+			want: []Timestamp{
+				{Millis: millis(wall), Node: "server"},
+				{Millis: millis(wall) + 1, Node: "server"},
+				{Millis: millis(wall.Add(time.Second)), Node: "server"},
+			},
+		},
+		{
+			name:  "same millisecond",
+			walls: []time.Time{wall, wall, wall.Add(time.Microsecond)},
+			want: []Timestamp{
+				{Millis: millis(wall), Node: "server"},
+				{Millis: millis(wall), Counter: 1, Node: "server"},
+				{Millis: millis(wall), Counter: 2, Node: "server"},
+			},
+		},
+		{
+			name:  "wall clock going backwards",
+			walls: []time.Time{wall, wall.Add(-time.Hour), wall.Add(-time.Minute), wall.Add(time.Millisecond)},
+			want: []Timestamp{
+				{Millis: millis(wall), Node: "server"},
+				{Millis: millis(wall), Counter: 1, Node: "server"},
+				{Millis: millis(wall), Counter: 2, Node: "server"},
+				{Millis: millis(wall) + 1, Node: "server"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock, setWall := testClock()
+			for i, at := range test.walls {
+				setWall(at)
+				if got := clock.Now(); got != test.want[i] {
+					t.Fatalf("call %d: Now() = %s, want %s", i, got, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestClockCounterOverflow(t *testing.T) {
+	clock, _ := testClock()
+
+	// THE WALL CLOCK STANDS STILL WHILE THE COUNTER RUNS OUT
+	var last Timestamp
+	for i := 0; i <= int(^uint16(0)); i++ {
+		last = clock.Now()
+	}
+	if want := (Timestamp{Millis: millis(wall), Counter: ^uint16(0), Node: "server"}); last != want {
+		t.Fatalf("Now() = %s, want %s", last, want)
+	}
+
+	next := clock.Now()
+	if want := (Timestamp{Millis: millis(wall) + 1, Node: "server"}); next != want {
+		t.Errorf("Now() after overflow = %s, want %s", next, want)
+	}
+	if !next.After(last) {
+		t.Errorf("%s does not follow %s", next, last)
+	}
+}
+
+func TestClockObserve(t *testing.T) {
+	later := wall.Add(10 * time.Millisecond)
+
+	tests := []struct {
+		name   string
+		wall   time.Time // The wall time when observing, after the clock issued wall-0003
+		remote Timestamp
+		want   Timestamp // The clock after observing the remote timestamp
+		err    bool
+	}{
+		{
+			name:   "remote behind the wall clock",
+			wall:   later,
+			remote: Timestamp{Millis: millis(wall) - 1000, Counter: 7, Node: "client"},
+			want:   Timestamp{Millis: millis(later), Node: "server"},
+		},
+		{
+			name:   "remote ahead within the drift",
+			wall:   later,
+			remote: Timestamp{Millis: millis(wall) + 60000, Counter: 7, Node: "client"},
+			want:   Timestamp{Millis: millis(wall) + 60000, Counter: 8, Node: "server"},
+		},
+		{
+			name:   "remote at the maximum drift",
+			wall:   later,
+			remote: Timestamp{Millis: millis(later) + MaxClockDrift.Milliseconds(), Node: "client"},
+			want:   Timestamp{Millis: millis(later) + MaxClockDrift.Milliseconds(), Counter: 1, Node: "server"},
+		},
+		{
+			name:   "remote beyond the maximum drift",
+			wall:   later,
+			remote: Timestamp{Millis: millis(later) + MaxClockDrift.Milliseconds() + 1, Node: "client"},
+			want:   Timestamp{Millis: millis(wall), Counter: 3, Node: "server"},
+			err:    true,
+		},
+		{
+			name:   "remote in the same millisecond with a later counter",
+			wall:   wall,
+			remote: Timestamp{Millis: millis(wall), Counter: 9, Node: "client"},
+			want:   Timestamp{Millis: millis(wall), Counter: 10, Node: "server"},
+		},
+		{
+			name:   "remote in the same millisecond with an earlier counter",
+			wall:   wall,
+			remote: Timestamp{Millis: millis(wall), Counter: 1, Node: "client"},
+			want:   Timestamp{Millis: millis(wall), Counter: 4, Node: "server"},
+		},
+		{
+			name:   "wall clock gone back behind the clock",
+			wall:   wall.Add(-time.Minute),
+			remote: Timestamp{Millis: millis(wall) - 1000, Node: "client"},
+			want:   Timestamp{Millis: millis(wall), Counter: 4, Node: "server"},
+		},
+		{
+			name:   "remote counter overflowing",
+			wall:   later,
+			remote: Timestamp{Millis: millis(wall) + 5000, Counter: ^uint16(0), Node: "client"},
+			want:   Timestamp{Millis: millis(wall) + 5001, Node: "server"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock, setWall := testClock()
+			for i := 0; i < 4; i++ {
+				clock.Now()
+			}
+
+			setWall(test.wall)
+			err := clock.Observe(test.remote)
+			if test.err {
+				if !errors.Is(err, ErrInvalidTimestamp) {
+					t.Fatalf("Observe() error = %v, want ErrInvalidTimestamp", err)
+				}
+			} else if err != nil {
+				t.Fatalf("Observe() error = %v", err)
+			}
+
+			if clock.last != test.want {
+				t.Errorf("clock = %s, want %s", clock.last, test.want)
+			}
+			if next := clock.Now(); !test.err && !next.After(test.remote) {
+				t.Errorf("Now() = %s does not follow the observed %s", next, test.remote)
+			}
+		})
+	}
+}
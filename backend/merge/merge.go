@@ -0,0 +1,96 @@
+// Package merge resolves concurrent edits of the fields of a record, made by clients
+// that may have been offline, using hybrid logical clock timestamps.
+package merge
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// A Policy decides between concurrent edits of the same field
+type Policy string
+
+const (
+	LastWriterWins Policy = "lww"      // The edit with the latest timestamp is kept
+	Conflict       Policy = "conflict" // The edit is refused and returned to the client
+)
+
+// DefaultPolicy returns the policy set with CONFLICT_POLICY, last-writer-wins by default
+func DefaultPolicy() Policy {
+	if policy, err := ParsePolicy(os.Getenv("CONFLICT_POLICY")); err == nil && policy != "" {
+		return policy
+	}
+	return LastWriterWins
+}
+
+// ParsePolicy checks a policy name; the empty name is returned as is
+func ParsePolicy(name string) (Policy, error) {
+	switch policy := Policy(name); policy {
+	case "", LastWriterWins, Conflict:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown conflict policy %q, expected lww or conflict", name)
+	}
+}
+
+// FieldClock is the last change of a field: its timestamp and the version of the record
+// it produced
+type FieldClock struct {
+	Clock   string `json:"clock"`
+	Version int64  `json:"version"`
+}
+
+// An Edit is a client's change of some fields of a record
+type Edit struct {
+	Fields []string  // The edited fields
+	Clock  Timestamp // When the client made the edit
+
+	// The version of the record the client edited. Fields changed since are concurrent
+	// edits; without it every field changed on the server is treated as one and resolved
+	// by last-writer-wins.
+	BaseVersion *int64
+}
+
+// A Result tells which fields of an edit to apply
+type Result struct {
+	Apply      []string // Fields to apply
+	Overridden []string // Fields kept at the server's value, which won by last-writer-wins
+	Conflicts  []string // Fields concurrently changed on the server, under the conflict policy
+}
+
+// Fields merges an edit into the record whose fields last changed at clocks. Fields not
+// changed on the server since the client's copy are applied. Concurrent edits of the
+// same field are resolved by the policy: the later timestamp wins, or the field is a
+// conflict. The result is sorted by field name.
+func Fields(policy Policy, clocks map[string]FieldClock, edit Edit) Result {
+	result := Result{Apply: []string{}, Overridden: []string{}, Conflicts: []string{}}
+
+	fields := append([]string(nil), edit.Fields...)
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		last, tracked := clocks[field]
+		if !tracked || (edit.BaseVersion != nil && last.Version <= *edit.BaseVersion) {
+			result.Apply = append(result.Apply, field)
+			continue
+		}
+
+		// WITHOUT A BASE VERSION A CONCURRENT EDIT CANNOT BE TOLD FROM A LATER ONE, SO THE
+		// TIMESTAMPS DECIDE
+		if policy == Conflict && edit.BaseVersion != nil {
+			result.Conflicts = append(result.Conflicts, field)
+			continue
+		}
+
+		// A CORRUPT CLOCK LOSES TO ANY EDIT
+		lastClock, err := ParseTimestamp(last.Clock)
+		if err != nil || edit.Clock.After(lastClock) {
+			result.Apply = append(result.Apply, field)
+		} else {
+			result.Overridden = append(result.Overridden, field)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,162 @@
+package merge
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFields(t *testing.T) {
+	version := func(v int64) *int64 { return &v }
+
+	server := Timestamp{Millis: millis(wall), Counter: 2, Node: "server"}
+	earlier := Timestamp{Millis: millis(wall) - 1000, Node: "client"}
+	later := Timestamp{Millis: millis(wall) + 1000, Node: "client"}
+
+	// TASK WAS LAST CHANGED ON THE SERVER AT VERSION 3, DESCRIPTION AT VERSION 1
+	clocks := map[string]FieldClock{
+		"task":        {Clock: server.String(), Version: 3},
+		"description": {Clock: Timestamp{Millis: millis(wall) - 5000, Node: "server"}.String(), Version: 1},
+	}
+
+	tests := []struct {
+		name   string
+		policy Policy
+		clocks map[string]FieldClock
+		edit   Edit
+		want   Result
+	}{
+		{
+			name:   "untracked fields",
+			policy: Conflict,
+			clocks: map[string]FieldClock{},
+			edit:   Edit{Fields: []string{"task", "priority"}, Clock: earlier, BaseVersion: version(1)},
+			want:   Result{Apply: []string{"priority", "task"}, Overridden: []string{}, Conflicts: []string{}},
+		},
+		{
+			name:   "different fields",
+			policy: Conflict,
+			clocks: clocks,
+			edit:   Edit{Fields: []string{"description", "priority"}, Clock: earlier, BaseVersion: version(2)},
+			want:   Result{Apply: []string{"description", "priority"}, Overridden: []string{}, Conflicts: []string{}},
+		},
+		{
+			name:   "field unchanged since the base version",
+			policy: Conflict,
+			clocks: clocks,
+			edit:   Edit{Fields: []string{"task"}, Clock: earlier, BaseVersion: version(3)},
+			want:   Result{Apply: []string{"task"}, Overridden: []string{}, Conflicts: []string{}},
+		},
+		{
+			name:   "same field, last writer wins with a later edit",
+			policy: LastWriterWins,
+			clocks: clocks,
+			edit:   Edit{Fields: []string{"task", "description"}, Clock: later, BaseVersion: version(2)},
+			want:   Result{Apply: []string{"description", "task"}, Overridden: []string{}, Conflicts: []string{}},
+		},
+		{
+			name:   "same field, last writer wins with an earlier edit",
+			policy: LastWriterWins,
+			clocks: clocks,
+			edit:   Edit{Fields: []string{"task", "description"}, Clock: earlier, BaseVersion: version(2)},
+			want:   Result{Apply: []string{"description"}, Overridden: []string{"task"}, Conflicts: []string{}},
+		},
+		{
+			name:   "same field, conflict with a later edit",
+			policy: Conflict,
+			clocks: clocks,
+			edit:   Edit{Fields: []string{"task", "description"}, Clock: later, BaseVersion: version(2)},
+			want:   Result{Apply: []string{"description"}, Overridden: []string{}, Conflicts: []string{"task"}},
+		},
+		{
+			name:   "same field, conflict with an earlier edit",
+			policy: Conflict,
+			clocks: clocks,
+			edit:   Edit{Fields: []string{"task"}, Clock: earlier, BaseVersion: version(2)},
+			want:   Result{Apply: []string{}, Overridden: []string{}, Conflicts: []string{"task"}},
+		},
+		{
+			name:   "no base version falls back to last writer wins with a later edit",
+			policy: Conflict,
+			clocks: clocks,
+			edit:   Edit{Fields: []string{"task", "description"}, Clock: later},
+			want:   Result{Apply: []string{"description", "task"}, Overridden: []string{}, Conflicts: []string{}},
+		},
+		{
+			name:   "no base version falls back to last writer wins with an earlier edit",
+			policy: Conflict,
+			clocks: clocks,
+			edit:   Edit{Fields: []string{"task", "description"}, Clock: earlier},
+			want:   Result{Apply: []string{"description"}, Overridden: []string{"task"}, Conflicts: []string{}},
+		},
+		{
+			name:   "corrupt stored clock loses to any edit",
+			policy: LastWriterWins,
+			clocks: map[string]FieldClock{"task": {Clock: "not a clock", Version: 3}},
+			edit:   Edit{Fields: []string{"task"}, Clock: earlier, BaseVersion: version(2)},
+			want:   Result{Apply: []string{"task"}, Overridden: []string{}, Conflicts: []string{}},
+		},
+		{
+			name:   "corrupt stored clock is still a conflict",
+			policy: Conflict,
+			clocks: map[string]FieldClock{"task": {Clock: "not a clock", Version: 3}},
+			edit:   Edit{Fields: []string{"task"}, Clock: earlier, BaseVersion: version(2)},
+			want:   Result{Apply: []string{}, Overridden: []string{}, Conflicts: []string{"task"}},
+		},
+		{
+			name:   "tie broken by a later node",
+			policy: LastWriterWins,
+			clocks: clocks,
+			edit:   Edit{Fields: []string{"task"}, Clock: Timestamp{Millis: server.Millis, Counter: server.Counter, Node: "tablet"}, BaseVersion: version(2)},
+			want:   Result{Apply: []string{"task"}, Overridden: []string{}, Conflicts: []string{}},
+		},
+		{
+			name:   "tie broken by an earlier node",
+			policy: LastWriterWins,
+			clocks: clocks,
+			edit:   Edit{Fields: []string{"task"}, Clock: Timestamp{Millis: server.Millis, Counter: server.Counter, Node: "phone"}, BaseVersion: version(2)},
+			want:   Result{Apply: []string{}, Overridden: []string{"task"}, Conflicts: []string{}},
+		},
+		{
+			name:   "same timestamp keeps the server's value",
+			policy: LastWriterWins,
+			clocks: clocks,
+			edit:   Edit{Fields: []string{"task"}, Clock: server, BaseVersion: version(2)},
+			want:   Result{Apply: []string{}, Overridden: []string{"task"}, Conflicts: []string{}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fields := append([]string(nil), test.edit.Fields...)
+
+			got := Fields(test.policy, test.clocks, test.edit)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Fields() = %+v, want %+v", got, test.want)
+			}
+			if !reflect.DeepEqual(test.edit.Fields, fields) {
+				t.Errorf("Fields() reordered the edited fields to %v", test.edit.Fields)
+			}
+		})
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		want Policy
+		err  bool
+	}{
+		{name: "", want: ""},
+		{name: "lww", want: LastWriterWins},
+		{name: "conflict", want: Conflict},
+		{name: "LWW", err: true},
+		{name: "merge", err: true},
+	}
+
+	for _, test := range tests {
+		got, err := ParsePolicy(test.name)
+		if (err != nil) != test.err || got != test.want {
+			t.Errorf("ParsePolicy(%q) = %q, %v, want %q", test.name, got, err, test.want)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
 	"github.com/thompsonmanda08/task-sync/utils"
 )
@@ -12,12 +13,19 @@ var SECRET_KEY = os.Getenv("JWT_SECRET")
 
 var AuthSecretKey = []byte(SECRET_KEY)
 
-// JWTMiddleware is the function that checks for a valid JWT in the Authorization header
+// JWTMiddleware is the function that checks for a valid JWT in the Authorization header,
+// or the "token" query parameter of WebSocket upgrades and event streams
 func JWTMiddleware(c *fiber.Ctx) error {
 
 	// Get the token from the Authorization header
 	authHeader := c.Get("Authorization")
 
+	// BROWSERS CANNOT SET HEADERS ON WEBSOCKET AND EVENTSOURCE REQUESTS, THEY PASS THE TOKEN IN THE QUERY
+	streaming := websocket.IsWebSocketUpgrade(c) || c.Get(fiber.HeaderAccept) == "text/event-stream"
+	if authHeader == "" && streaming && c.Query("token") != "" {
+		authHeader = "Bearer " + c.Query("token")
+	}
+
 	// Check for missing header
 	if authHeader == "" {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
@@ -0,0 +1,218 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/thompsonmanda08/task-sync/models"
+	"github.com/thompsonmanda08/task-sync/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	maxIdempotencyKey    = 255
+
+	// Requests still in progress after this long are assumed to have died with their
+	// instance, and their key is taken over by the next retry
+	idempotencyAbandoned = 5 * time.Minute
+)
+
+var (
+	ErrIdempotencyKeyInProgress = errors.New("a request with this idempotency key is still in progress")
+	ErrIdempotencyKeyReused     = errors.New("the idempotency key was used for a different request")
+)
+
+// Idempotency makes POST, PUT, PATCH and DELETE requests sent with an Idempotency-Key
+// header safe to retry. The first request with a key runs and its response is stored;
+// retries with the same key and request receive the stored response, marked with an
+// Idempotent-Replayed header, without running again. Reusing a key for a different
+// request is rejected with 422. Server errors are not stored, so they can be retried.
+// Must run after JWTMiddleware, as keys are scoped to the user.
+func Idempotency(db *gorm.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get(IdempotencyKeyHeader)
+		if key == "" || !isMutating(c.Method()) {
+			return c.Next()
+		}
+
+		if len(key) > maxIdempotencyKey {
+			return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Invalid Idempotency-Key header",
+				fmt.Errorf("the key must be at most %d characters", maxIdempotencyKey))
+		}
+
+		userID := c.Locals("userID").(string)
+
+		fingerprint, err := requestFingerprint(c)
+		if err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusBadRequest, "Failed to read the request body", err)
+		}
+
+		record := models.IdempotencyKey{
+			UserID:      userID,
+			Key:         key,
+			Method:      c.Method(),
+			Path:        c.Path(),
+			Fingerprint: fingerprint,
+		}
+
+		stored, err := claimIdempotencyKey(db, &record)
+		if err != nil {
+			return utils.SendErrorResponse(c, fiber.StatusInternalServerError, "Failed to check the Idempotency-Key", err)
+		}
+
+		if stored != nil {
+			switch {
+			case stored.Fingerprint != fingerprint:
+				return utils.SendErrorResponse(c, fiber.StatusUnprocessableEntity, "Idempotency-Key reused with a different request", ErrIdempotencyKeyReused)
+			case stored.StatusCode == 0:
+				return utils.SendErrorResponse(c, fiber.StatusConflict, "A request with this Idempotency-Key is in progress, retry later", ErrIdempotencyKeyInProgress)
+			}
+
+			if stored.ContentType != "" {
+				c.Set(fiber.HeaderContentType, stored.ContentType)
+			}
+			if stored.ETag != "" {
+				c.Set(fiber.HeaderETag, stored.ETag)
+			}
+			c.Set("Idempotent-Replayed", "true")
+			return c.Status(stored.StatusCode).Send(stored.Body)
+		}
+
+		// RELEASE THE KEY WHEN THE REQUEST FAILS, SO THAT IT CAN BE RETRIED
+		completed := false
+		defer func() {
+			if !completed {
+				db.Delete(&models.IdempotencyKey{}, "id = ?", record.ID)
+			}
+		}()
+
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		status := c.Response().StatusCode()
+		if status >= fiber.StatusInternalServerError {
+			return nil
+		}
+
+		now := time.Now()
+		err = db.Model(&record).
+			Select("StatusCode", "ContentType", "ETag", "Body", "CompletedAt").
+			Updates(models.IdempotencyKey{
+				StatusCode:  status,
+				ContentType: string(c.Response().Header.ContentType()),
+				ETag:        string(c.Response().Header.Peek(fiber.HeaderETag)),
+				Body:        append([]byte(nil), c.Response().Body()...),
+				CompletedAt: &now,
+			}).Error
+		completed = err == nil
+
+		return nil
+	}
+}
+
+// claimIdempotencyKey reserves a key for a request. It returns nil once the key is
+// reserved, or the request already stored for it.
+func claimIdempotencyKey(db *gorm.DB, record *models.IdempotencyKey) (*models.IdempotencyKey, error) {
+	// A SECOND ATTEMPT FOLLOWS THE REMOVAL OF AN EXPIRED OR ABANDONED KEY
+	for attempt := 0; attempt < 2; attempt++ {
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			return nil, nil
+		}
+
+		var stored models.IdempotencyKey
+		err := db.Where("user_id = ? AND key = ?", record.UserID, record.Key).First(&stored).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue // RELEASED IN THE MEANTIME
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		expired := stored.CreatedAt.Before(time.Now().Add(-utils.IdempotencyRetention()))
+		abandoned := stored.StatusCode == 0 && stored.CreatedAt.Before(time.Now().Add(-idempotencyAbandoned))
+		if !expired && !abandoned {
+			return &stored, nil
+		}
+
+		if err := db.Delete(&models.IdempotencyKey{}, "id = ? AND created_at = ?", stored.ID, stored.CreatedAt).Error; err != nil {
+			return nil, err
+		}
+		record.ID = ""
+	}
+
+	return nil, errors.New("failed to reserve the idempotency key")
+}
+
+// requestFingerprint hashes the method, path and body of a request. Multipart bodies are
+// hashed by their fields and files, as their boundary changes from one retry to the next.
+func requestFingerprint(c *fiber.Ctx) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", c.Method(), c.OriginalURL())
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		h.Write(c.Body())
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	names := make([]string, 0, len(form.Value))
+	for name := range form.Value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "value %q %q\n", name, form.Value[name])
+	}
+
+	names = names[:0]
+	for name := range form.File {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, header := range form.File[name] {
+			fmt.Fprintf(h, "file %q %q %d\n", name, header.Filename, header.Size)
+
+			file, err := header.Open()
+			if err != nil {
+				return "", err
+			}
+			_, err = io.Copy(h, file)
+			file.Close()
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// PurgeExpiredIdempotencyKeys deletes the keys stored before a time, returning how many
+// were deleted
+func PurgeExpiredIdempotencyKeys(ctx context.Context, db *gorm.DB, before time.Time) (int64, error) {
+	result := db.WithContext(ctx).Where("created_at < ?", before).Delete(&models.IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch, fiber.MethodDelete:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lucsky/cuid"
+	"gorm.io/gorm"
+)
+
+// ACTIVITY TYPES
+const (
+	ActivityGroupCreated = "group_created"
+	ActivityGroupUpdated = "group_updated"
+	ActivityGroupDeleted = "group_deleted"
+
+	ActivityMemberJoined  = "member_joined"
+	ActivityMemberRemoved = "member_removed"
+	ActivityMemberLeft    = "member_left"
+	ActivityRoleChanged   = "role_changed"
+
+	ActivityListCreated          = "list_created"
+	ActivityListUpdated          = "list_updated"
+	ActivityListRenamed          = "list_renamed"
+	ActivityListDeleted          = "list_deleted"
+	ActivityListRestored         = "list_restored"
+	ActivityListAddedToGroup     = "list_added_to_group"
+	ActivityListRemovedFromGroup = "list_removed_from_group"
+
+	ActivityTaskCreated   = "task_created"
+	ActivityTaskUpdated   = "task_updated"
+	ActivityTaskAssigned  = "task_assigned"
+	ActivityTaskCompleted = "task_completed"
+	ActivityTaskReopened  = "task_reopened"
+	ActivityTaskMoved     = "task_moved"
+	ActivityTaskDeleted   = "task_deleted"
+	ActivityTaskRestored  = "task_restored"
+)
+
+// ActivityTypes lists every activity type, to validate filters
+var ActivityTypes = []string{
+	ActivityGroupCreated, ActivityGroupUpdated, ActivityGroupDeleted,
+	ActivityMemberJoined, ActivityMemberRemoved, ActivityMemberLeft, ActivityRoleChanged,
+	ActivityListCreated, ActivityListUpdated, ActivityListRenamed, ActivityListDeleted, ActivityListRestored,
+	ActivityListAddedToGroup, ActivityListRemovedFromGroup,
+	ActivityTaskCreated, ActivityTaskUpdated, ActivityTaskAssigned, ActivityTaskCompleted, ActivityTaskReopened,
+	ActivityTaskMoved, ActivityTaskDeleted, ActivityTaskRestored,
+}
+
+// An Activity is an entry of a group's activity feed, a readable summary of the changes
+// made to the group, its members and its lists. Activities are derived from the change
+// history in the database package and carry the names needed to display them, as they
+// were at the time of the change.
+type Activity struct {
+	ID string `json:"id" gorm:"primaryKey;unique;not null"`
+
+	GroupID string `json:"group_id" gorm:"not null;index:idx_activities_group"`
+	Type    string `json:"type" gorm:"not null;index"`
+
+	Actor   *User   `gorm:"foreignKey:ActorID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"-"`
+	ActorID *string `json:"actor_id" gorm:"index"` // Empty for changes made by the system
+
+	ResourceType string  `json:"resource_type"` // todo, todo_list, group or group_member
+	ResourceID   string  `json:"resource_id"`
+	Data         *string `json:"-" gorm:"type:jsonb"` // Details depending on the type, e.g. the list name
+
+	CreatedAt time.Time `json:"created_at" gorm:"index:idx_activities_group"`
+}
+
+type ActivityResponse struct {
+	ID           string          `json:"id"`
+	GroupID      string          `json:"group_id"`
+	Type         string          `json:"type"`
+	Actor        *UserMinimal    `json:"actor"`
+	ResourceType string          `json:"resource_type"`
+	ResourceID   string          `json:"resource_id"`
+	Data         json.RawMessage `json:"data,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+func (a *Activity) BeforeCreate(tx *gorm.DB) (err error) {
+	if a.ID == "" {
+		a.ID = cuid.New()
+	}
+	return
+}
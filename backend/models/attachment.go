@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lucsky/cuid"
+	"gorm.io/gorm"
+)
+
+// A Blob is a stored file, deduplicated by the SHA-256 checksum of its contents.
+// Several attachments can point at the same blob.
+type Blob struct {
+	ID          string    `json:"id" gorm:"primaryKey;unique;not null"`
+	Checksum    string    `json:"checksum" gorm:"uniqueIndex;not null"` // Hex encoded SHA-256
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	StorageKey  string    `json:"-" gorm:"not null"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// An Attachment is a file uploaded to a todo item
+type Attachment struct {
+	ID       string `json:"id" gorm:"primaryKey;unique;not null"`
+	FileName string `json:"file_name" gorm:"not null"`
+
+	Todo   Todo   `gorm:"foreignKey:TodoID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	TodoID string `json:"todo_id" gorm:"index;not null"`
+
+	Blob   Blob   `gorm:"foreignKey:BlobID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;" json:"-"`
+	BlobID string `json:"blob_id" gorm:"index;not null"`
+
+	UploadedBy   *User  `gorm:"foreignKey:UploadedByID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"-"`
+	UploadedByID string `json:"uploaded_by_id" gorm:"index"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type AttachmentResponse struct {
+	ID           string    `json:"id"`
+	FileName     string    `json:"file_name"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	Checksum     string    `json:"checksum"`
+	TodoID       string    `json:"todo_id"`
+	UploadedByID string    `json:"uploaded_by_id"`
+	DownloadURL  string    `json:"download_url"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (b *Blob) BeforeCreate(tx *gorm.DB) (err error) {
+	if b.ID == "" {
+		b.ID = cuid.New()
+	}
+	return
+}
+
+func (a *Attachment) BeforeCreate(tx *gorm.DB) (err error) {
+	if a.ID == "" {
+		a.ID = cuid.New()
+	}
+	return
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lucsky/cuid"
+	"gorm.io/gorm"
+)
+
+// CHANGE ACTIONS
+const (
+	ChangeCreate  = "create"
+	ChangeUpdate  = "update"
+	ChangeDelete  = "delete"  // Moved to the trash
+	ChangeRestore = "restore" // Restored from the trash
+	ChangePurge   = "purge"   // Permanently deleted
+)
+
+// A ChangeRecord is an entry of the append-only change history of todos, todo lists and
+// groups. Updates produce one record per changed field with its value before and after
+// the change, JSON-encoded. Purges keep the audited columns of the row as an object in
+// OldValue. Records are written by the audit callbacks in the database
+// package and are never modified.
+type ChangeRecord struct {
+	ID string `json:"id" gorm:"primaryKey;unique;not null"`
+
+	ResourceType string `json:"resource_type" gorm:"not null;index:idx_change_records_resource"` // todo, todo_list or group
+	ResourceID   string `json:"resource_id" gorm:"not null;index:idx_change_records_resource"`
+
+	Action   string  `json:"action" gorm:"not null"`
+	Field    string  `json:"field,omitempty"` // The changed column, for updates
+	OldValue *string `json:"-" gorm:"type:jsonb"`
+	NewValue *string `json:"-" gorm:"type:jsonb"`
+
+	Actor   *User   `gorm:"foreignKey:ActorID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"-"`
+	ActorID *string `json:"actor_id"` // Empty for changes made by the system
+
+	Clock string `json:"clock,omitempty"` // Hybrid logical clock timestamp of the change, the client's for pushed edits
+
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+type ChangeRecordResponse struct {
+	ID           string          `json:"id"`
+	ResourceType string          `json:"resource_type"`
+	ResourceID   string          `json:"resource_id"`
+	Action       string          `json:"action"`
+	Field        string          `json:"field,omitempty"`
+	OldValue     json.RawMessage `json:"old_value,omitempty"`
+	NewValue     json.RawMessage `json:"new_value,omitempty"`
+	Actor        *UserMinimal    `json:"actor"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+func (r *ChangeRecord) BeforeCreate(tx *gorm.DB) (err error) {
+	if r.ID == "" {
+		r.ID = cuid.New()
+	}
+	return
+}
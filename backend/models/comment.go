@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lucsky/cuid"
+	"gorm.io/gorm"
+)
+
+// A Comment on a todo item. Replies point at the comment they answer through ParentID.
+type Comment struct {
+	ID   string `json:"id" gorm:"primaryKey;unique;not null"`
+	Body string `json:"body" gorm:"type:text;not null"` // Markdown
+
+	Todo   Todo   `gorm:"foreignKey:TodoID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	TodoID string `json:"todo_id" gorm:"index;not null"`
+
+	Author   *User  `gorm:"foreignKey:AuthorID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"author,omitempty"`
+	AuthorID string `json:"author_id" gorm:"index;not null"`
+
+	Parent   *Comment `gorm:"foreignKey:ParentID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	ParentID *string  `json:"parent_id" gorm:"index"` // Nil for top-level comments
+
+	EditedAt  *time.Time     `json:"edited_at,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"` // `omitempty` hides if null
+}
+
+type CommentResponse struct {
+	ID         string       `json:"id"`
+	Body       string       `json:"body"`
+	TodoID     string       `json:"todo_id"`
+	ParentID   *string      `json:"parent_id,omitempty"`
+	Author     *UserMinimal `json:"author,omitempty"`
+	ReplyCount int          `json:"reply_count"`
+	EditedAt   *time.Time   `json:"edited_at,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+func (comment *Comment) BeforeCreate(tx *gorm.DB) (err error) {
+	if comment.ID == "" {
+		comment.ID = cuid.New()
+	}
+	return
+}
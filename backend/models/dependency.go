@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lucsky/cuid"
+	"gorm.io/gorm"
+)
+
+// A TodoDependency records that a todo is blocked by another todo, which may live in a
+// different list. The todo stays blocked until the todo it depends on is completed.
+type TodoDependency struct {
+	ID string `json:"id" gorm:"primaryKey;unique;not null"`
+
+	Todo   Todo   `gorm:"foreignKey:TodoID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	TodoID string `json:"todo_id" gorm:"not null;uniqueIndex:idx_todo_dependency"` // The blocked todo
+
+	DependsOn   Todo   `gorm:"foreignKey:DependsOnID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	DependsOnID string `json:"depends_on_id" gorm:"not null;index;uniqueIndex:idx_todo_dependency"` // The blocking todo
+
+	CreatedByID string    `json:"created_by_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// DependencyNode is a todo in a dependency graph response
+type DependencyNode struct {
+	ID          string `json:"id"`
+	Task        string `json:"task"`
+	IsCompleted bool   `json:"is_completed"`
+	TodoListID  string `json:"todo_list_id"`
+	Blocked     bool   `json:"blocked"`
+}
+
+// DependencyEdge points from a blocked todo to the todo it depends on
+type DependencyEdge struct {
+	TodoID      string `json:"todo_id"`
+	DependsOnID string `json:"depends_on_id"`
+}
+
+func (d *TodoDependency) BeforeCreate(tx *gorm.DB) (err error) {
+	if d.ID == "" {
+		d.ID = cuid.New()
+	}
+	return
+}
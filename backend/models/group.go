@@ -19,6 +19,8 @@ type Group struct {
 	Owner   User   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
 	OwnerID string `json:"owner_id" gorm:"index,foreignKey:OwnerID"` // User FK
 
+	Version int64 `json:"version" gorm:"not null;default:1"` // Increased by the database on every update, sent as the ETag
+
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"` // `omitempty` hides if null
@@ -41,6 +43,7 @@ type GroupResponse struct {
 	TodoLists     *[]TodoListResponse `json:"todo_lists,omitempty"`
 	TodoListCount int                 `json:"todo_lists_count"`
 	Owner         *UserMinimal        `json:"owner"`
+	Version       int64               `json:"version"`
 	// OwnerID       string       `json:"owner_id,omitempty"`
 }
 
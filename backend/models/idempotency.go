@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lucsky/cuid"
+	"gorm.io/gorm"
+)
+
+// An IdempotencyKey records the response to a mutating request sent with an
+// Idempotency-Key header, so that retries of the request receive the same response
+// instead of repeating it. Keys are scoped to the user and kept for the retention period.
+type IdempotencyKey struct {
+	ID string `json:"id" gorm:"primaryKey;unique;not null"`
+
+	User   *User  `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	UserID string `json:"user_id" gorm:"not null;uniqueIndex:idx_idempotency_key"`
+	Key    string `json:"key" gorm:"not null;uniqueIndex:idx_idempotency_key"`
+
+	Method      string `json:"method" gorm:"not null"`
+	Path        string `json:"path" gorm:"not null"`
+	Fingerprint string `json:"-" gorm:"not null"` // Hex encoded SHA-256 of the method, path and body
+
+	// The stored response, set once the request completes. A zero status code means the
+	// request is still in progress.
+	StatusCode  int    `json:"status_code" gorm:"not null;default:0"`
+	ContentType string `json:"-"`
+	ETag        string `json:"-"`
+	Body        []byte `json:"-"`
+
+	CreatedAt   time.Time  `json:"created_at" gorm:"index"`
+	CompletedAt *time.Time `json:"completed_at"`
+}
+
+func (k *IdempotencyKey) BeforeCreate(tx *gorm.DB) (err error) {
+	if k.ID == "" {
+		k.ID = cuid.New()
+	}
+	return
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/lucsky/cuid"
+	"gorm.io/gorm"
+)
+
+// NOTIFICATION EVENTS
+const (
+	NotificationAssigned    = "assigned"            // A todo was assigned to the user
+	NotificationGroupInvite = "group_invite"        // The user was added to a group
+	NotificationMention     = "mention"             // The user was mentioned in a comment
+	NotificationListChanged = "shared_list_changed" // A list shared with the user was changed by someone else
+	NotificationReminder    = "reminder"            // A reminder set by the user, delivered on the channels chosen for it
+)
+
+// NotificationEvents lists the events users can choose the notification channels of
+var NotificationEvents = []string{NotificationAssigned, NotificationGroupInvite, NotificationMention, NotificationListChanged}
+
+// DefaultNotificationChannels are the channels of an event for users who have not set a
+// preference for it
+var DefaultNotificationChannels = []string{"in_app"}
+
+// A Notification is a message in a user's in-app inbox
+type Notification struct {
+	ID string `json:"id" gorm:"primaryKey;unique;not null"`
+
+	User   *User  `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	UserID string `json:"user_id" gorm:"not null;index:idx_notifications_user"`
+
+	Type  string  `json:"type" gorm:"not null"` // What the notification is about, e.g. "reminder"
+	Title string  `json:"title"`
+	Body  string  `json:"body"`
+	Data  *string `json:"-" gorm:"type:jsonb"` // IDs of the resources the notification is about
+
+	ReadAt    *time.Time `json:"read_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"index:idx_notifications_user"`
+}
+
+type NotificationResponse struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Title     string          `json:"title"`
+	Body      string          `json:"body"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	ReadAt    *time.Time      `json:"read_at"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// A NotificationPreference sets the channels a user is notified on for an event. No
+// channels turns the event off.
+type NotificationPreference struct {
+	ID string `json:"id" gorm:"primaryKey;unique;not null"`
+
+	User   *User  `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	UserID string `json:"user_id" gorm:"not null;uniqueIndex:idx_notification_preference"`
+
+	Event    string `json:"event" gorm:"not null;uniqueIndex:idx_notification_preference"`
+	Channels string `json:"-"` // Comma separated notification channels
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type NotificationPreferenceResponse struct {
+	Event    string   `json:"event"`
+	Channels []string `json:"channels"`
+}
+
+// ChannelList returns the notification channels of the preference
+func (p *NotificationPreference) ChannelList() []string {
+	if p.Channels == "" {
+		return []string{}
+	}
+	return strings.Split(p.Channels, ",")
+}
+
+func (n *Notification) BeforeCreate(tx *gorm.DB) (err error) {
+	if n.ID == "" {
+		n.ID = cuid.New()
+	}
+	return
+}
+
+func (p *NotificationPreference) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == "" {
+		p.ID = cuid.New()
+	}
+	return
+}
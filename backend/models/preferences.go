@@ -0,0 +1,93 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lucsky/cuid"
+	"gorm.io/gorm"
+)
+
+// DIGEST FREQUENCIES
+const (
+	DigestOff    = "off"
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// DateFormats maps the date formats users can choose to their Go layouts
+var DateFormats = map[string]string{
+	"YYYY-MM-DD": "2006-01-02",
+	"DD/MM/YYYY": "02/01/2006",
+	"MM/DD/YYYY": "01/02/2006",
+	"DD.MM.YYYY": "02.01.2006",
+}
+
+// UserPreferences holds the settings of a user. Users without preferences use the
+// defaults of DefaultUserPreferences.
+type UserPreferences struct {
+	ID string `json:"-" gorm:"primaryKey;unique;not null"`
+
+	User   *User  `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	UserID string `json:"user_id" gorm:"not null;uniqueIndex"`
+
+	Timezone   string `json:"timezone" gorm:"not null;default:'UTC'"`           // IANA name, e.g. Africa/Lusaka
+	WeekStart  int    `json:"week_start" gorm:"not null"`                       // First day of the week, 0 is Sunday
+	DateFormat string `json:"date_format" gorm:"not null;default:'YYYY-MM-DD'"` // One of DateFormats
+
+	DefaultList   *TodoList `gorm:"foreignKey:DefaultListID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"-"`
+	DefaultListID *string   `json:"default_list_id"` // The list clients open first
+
+	DigestFrequency string     `json:"digest_frequency" gorm:"not null;default:'off';index"` // off, daily or weekly
+	DigestHour      int        `json:"digest_hour" gorm:"not null"`                          // Local hour the digest is sent at
+	DigestWeekday   int        `json:"digest_weekday" gorm:"not null"`                       // Day of weekly digests, 0 is Sunday
+	LastDigestAt    *time.Time `json:"last_digest_at"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DefaultUserPreferences returns the preferences of a user who has not changed any
+func DefaultUserPreferences(userID string) UserPreferences {
+	return UserPreferences{
+		UserID:          userID,
+		Timezone:        "UTC",
+		WeekStart:       int(time.Monday),
+		DateFormat:      "YYYY-MM-DD",
+		DigestFrequency: DigestOff,
+		DigestHour:      7,
+		DigestWeekday:   int(time.Monday),
+	}
+}
+
+// DateLayout returns the Go layout of the user's date format
+func (p *UserPreferences) DateLayout() string {
+	if layout, ok := DateFormats[p.DateFormat]; ok {
+		return layout
+	}
+	return DateFormats["YYYY-MM-DD"]
+}
+
+func (p *UserPreferences) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == "" {
+		p.ID = cuid.New()
+	}
+	return
+}
+
+type DigestSettingsResponse struct {
+	Frequency    string     `json:"frequency"`
+	Hour         int        `json:"hour"`
+	Weekday      int        `json:"weekday"`
+	Timezone     string     `json:"timezone"`
+	LastDigestAt *time.Time `json:"last_digest_at"`
+	Available    bool       `json:"available"` // Whether the server can send email
+}
+
+type UserPreferencesResponse struct {
+	Timezone      string                           `json:"timezone"`
+	WeekStart     int                              `json:"week_start"`
+	DateFormat    string                           `json:"date_format"`
+	DefaultListID *string                          `json:"default_list_id"`
+	Notifications []NotificationPreferenceResponse `json:"notifications"`
+	Digest        DigestSettingsResponse           `json:"digest"`
+}
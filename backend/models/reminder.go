@@ -0,0 +1,78 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/lucsky/cuid"
+	"gorm.io/gorm"
+)
+
+// A Reminder notifies a user about a todo, either at a fixed time or a number of minutes
+// before the todo's end date. DueAt is when the reminder fires: it follows the end date
+// of the todo for relative reminders and is empty while the todo has no end date.
+// Deliveries in progress and retries wait for NextAttemptAt and leave DueAt as is.
+type Reminder struct {
+	ID string `json:"id" gorm:"primaryKey;unique;not null"`
+
+	Todo   *Todo  `gorm:"foreignKey:TodoID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	TodoID string `json:"todo_id" gorm:"not null;index"`
+
+	User   *User  `gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	UserID string `json:"user_id" gorm:"not null;index"` // The user reminded
+
+	RemindAt      *time.Time `json:"remind_at"`         // Fixed time, for absolute reminders
+	OffsetMinutes *int       `json:"offset_minutes"`    // Minutes before the end date, for relative reminders
+	Channels      string     `json:"-" gorm:"not null"` // Comma separated notification channels
+
+	DueAt         *time.Time `json:"due_at" gorm:"index:idx_reminders_due"`
+	SentAt        *time.Time `json:"sent_at" gorm:"index:idx_reminders_due"`
+	NextAttemptAt *time.Time `json:"-"`                           // The end of the lease of a claimed reminder, or when a failed one is retried
+	Attempts      int        `json:"-" gorm:"not null;default:0"` // Failed deliveries
+	LastError     string     `json:"-"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type ReminderResponse struct {
+	ID            string     `json:"id"`
+	TodoID        string     `json:"todo_id"`
+	RemindAt      *time.Time `json:"remind_at,omitempty"`
+	OffsetMinutes *int       `json:"offset_minutes,omitempty"`
+	Channels      []string   `json:"channels"`
+	DueAt         *time.Time `json:"due_at"`
+	SentAt        *time.Time `json:"sent_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// ChannelList returns the notification channels of the reminder
+func (r *Reminder) ChannelList() []string {
+	if r.Channels == "" {
+		return []string{}
+	}
+	return strings.Split(r.Channels, ",")
+}
+
+// ReminderDueAt returns when a reminder fires for a todo ending at endDate, or nil if a
+// relative reminder has no end date to follow
+func ReminderDueAt(remindAt *time.Time, offsetMinutes *int, endDate time.Time) *time.Time {
+	if remindAt != nil {
+		return remindAt
+	}
+
+	// TODOS WITHOUT AN END DATE STORE THE ZERO TIME
+	if offsetMinutes == nil || endDate.Year() <= 1 {
+		return nil
+	}
+
+	dueAt := endDate.Add(-time.Duration(*offsetMinutes) * time.Minute)
+	return &dueAt
+}
+
+func (r *Reminder) BeforeCreate(tx *gorm.DB) (err error) {
+	if r.ID == "" {
+		r.ID = cuid.New()
+	}
+	return
+}
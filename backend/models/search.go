@@ -0,0 +1,14 @@
+package models
+
+// SearchResult is a todo, todo list, group or comment matching a search query, with the
+// IDs needed to link to it
+type SearchResult struct {
+	Type    string  `json:"type"` // todo, list, group or comment
+	ID      string  `json:"id"`
+	Title   string  `json:"title"`
+	Snippet string  `json:"snippet"` // Matching text, HTML-escaped, with matches wrapped in <mark> tags
+	Rank    float64 `json:"rank"`
+	ListID  *string `json:"list_id,omitempty"`
+	TodoID  *string `json:"todo_id,omitempty"`
+	GroupID *string `json:"group_id,omitempty"`
+}
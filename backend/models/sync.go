@@ -0,0 +1,144 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SYNC RESOURCE TYPES, THE SAME AS THE RESOURCE TYPES OF THE CHANGE HISTORY
+const (
+	SyncGroup      = "group"
+	SyncMembership = "group_member"
+	SyncTodoList   = "todo_list"
+	SyncTodo       = "todo"
+
+	SyncDependency = "todo_dependency" // Only pushed, dependencies are not in the change history
+)
+
+// TOMBSTONE REASONS
+const (
+	TombstoneDeleted = "deleted" // Moved to the trash
+	TombstonePurged  = "purged"  // Permanently deleted
+	TombstoneRevoked = "revoked" // The user can no longer see it
+)
+
+// PUSH OPERATION RESULTS
+const (
+	PushApplied  = "applied"
+	PushConflict = "conflict" // The server's record changed since the client's copy, or already exists
+	PushRejected = "rejected" // The operation is invalid or not allowed
+	PushSkipped  = "skipped"  // Rolled back or not attempted, because another operation of an atomic batch failed
+)
+
+// A PushOperation is a change made by a client, possibly offline, replayed with POST
+// /sync/push
+type PushOperation struct {
+	OpID   string `json:"op_id"`  // Client ID of the operation, echoed in its result
+	Type   string `json:"type"`   // todo, todo_list or todo_dependency
+	Action string `json:"action"` // create, update or delete
+	ID     string `json:"id"`     // The record, with a client-generated CUID for creates
+
+	// The hybrid logical clock timestamp of the client's edit. Todo updates with a clock
+	// are merged field by field with the changes made on the server since base_version.
+	Clock string `json:"clock,omitempty"`
+
+	// The version, or else the updated_at, of the record the client changed. Updates and
+	// deletes of records changed on the server since are conflicts; without either they
+	// always apply.
+	BaseVersion   *int64     `json:"base_version,omitempty"`
+	BaseUpdatedAt *time.Time `json:"base_updated_at,omitempty"`
+
+	// Completes a todo even when todos it depends on are not completed yet
+	Force bool `json:"force,omitempty"`
+
+	Data json.RawMessage `json:"data,omitempty"` // The fields to create or update
+}
+
+type PushResult struct {
+	OpID   string      `json:"op_id"`
+	Type   string      `json:"type"`
+	ID     string      `json:"id"`
+	Status string      `json:"status"` // applied, conflict, rejected or skipped
+	Error  string      `json:"error,omitempty"`
+	Record interface{} `json:"record"` // The server's version of the record, null when it is deleted
+
+	// Fields of a merged update that were not applied: kept at a later value set on the
+	// server, or changed on the server concurrently under the conflict policy
+	Overridden []string `json:"overridden,omitempty"`
+	Conflicts  []string `json:"conflicts,omitempty"`
+
+	BlockedBy []DependencyNode `json:"blocked_by,omitempty"` // The open todos refusing a completion
+}
+
+// SyncResponse is a page of the changes visible to a user since a sync cursor. Rows are
+// sent whole; clients replace their copy. Removing a list removes its todos, and
+// removing a group removes its memberships.
+type SyncResponse struct {
+	Cursor  string `json:"cursor"`   // Pass as "since" to get the next page or the next changes
+	HasMore bool   `json:"has_more"` // More changes are waiting, request the next page right away
+
+	Groups      []SyncGroupResponse      `json:"groups"`
+	Memberships []SyncMembershipResponse `json:"memberships"`
+	TodoLists   []SyncTodoListResponse   `json:"todo_lists"`
+	Todos       []SyncTodoResponse       `json:"todos"`
+	Deleted     []Tombstone              `json:"deleted"`
+}
+
+type SyncGroupResponse struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	OwnerID     string    `json:"owner_id"`
+	Version     int64     `json:"version"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type SyncMembershipResponse struct {
+	ID        string       `json:"id"`
+	GroupID   string       `json:"group_id"`
+	User      *UserMinimal `json:"user"`
+	RoleID    string       `json:"role_id"`
+	RoleName  string       `json:"role_name"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+type SyncTodoListResponse struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Color       string    `json:"color"`
+	Position    string    `json:"position"`
+	GroupID     *string   `json:"group_id"`
+	OwnerID     string    `json:"owner_id"`
+	Version     int64     `json:"version"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type SyncTodoResponse struct {
+	ID          string    `json:"id"`
+	TodoListID  string    `json:"todo_list_id"`
+	ParentID    *string   `json:"parent_id"`
+	AssigneeID  *string   `json:"assignee_id"`
+	Task        string    `json:"task"`
+	Description string    `json:"description"`
+	IsCompleted bool      `json:"is_completed"`
+	StartDate   time.Time `json:"start_date"`
+	EndDate     time.Time `json:"end_date"`
+	AllDay      bool      `json:"all_day"`
+	Priority    Priority  `json:"priority"`
+	Position    string    `json:"position"`
+	Version     int64     `json:"version"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// A Tombstone tells a client to remove a row
+type Tombstone struct {
+	Type      string    `json:"type"` // group, group_member, todo_list or todo
+	ID        string    `json:"id"`
+	Reason    string    `json:"reason"` // deleted, purged or revoked
+	DeletedAt time.Time `json:"deleted_at"`
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/lucsky/cuid"
@@ -20,20 +22,56 @@ const (
 	Critical Priority = "critical"
 )
 
+// Priorities lists the priorities from least to most important
+var Priorities = []Priority{Low, Normal, Medium, High, Urgent, Critical}
+
+// Rank returns the importance of a priority, or -1 for an unknown priority
+func (p Priority) Rank() int {
+	for i, priority := range Priorities {
+		if priority == p {
+			return i
+		}
+	}
+	return -1
+}
+
+// PriorityRankSQL returns an SQL expression ranking the priority column by importance,
+// so that sorting by it does not sort alphabetically
+func PriorityRankSQL(column string) string {
+	var sql strings.Builder
+	sql.WriteString("CASE " + column)
+	for i, priority := range Priorities {
+		fmt.Fprintf(&sql, " WHEN '%s' THEN %d", priority, i)
+	}
+	sql.WriteString(" ELSE -1 END")
+	return sql.String()
+}
+
 type Todo struct {
 	ID string `json:"id" gorm:"primaryKey;unique;not null"`
 
 	Task        string    `json:"task" gorm:"not null"`
 	Description string    `json:"description"`
 	IsCompleted bool      `json:"is_completed" gorm:"default:false"`
-	StartDate   time.Time `json:"start_date,omitempty"`             // Optional start date
-	EndDate     time.Time `json:"end_date,omitempty"`               // Optional end date
-	Priority    Priority  `json:"priority" gorm:"default:'normal'"` // Default to 'normal', can be 'low', 'medium', 'high'
+	StartDate   time.Time `json:"start_date,omitempty"`                          // Optional start date
+	EndDate     time.Time `json:"end_date,omitempty"`                            // Optional end date
+	AllDay      bool      `json:"all_day" gorm:"not null;default:false"`         // The dates are calendar dates, stored as midnight UTC
+	Priority    Priority  `json:"priority" gorm:"default:'normal'"`              // Default to 'normal', can be 'low', 'medium', 'high'
+	Position    string    `json:"position" gorm:"type:text COLLATE \"C\";index"` // Fractional index key, ordered byte-wise within the list
 	// Tags        []string  `json:"tags"`
 
 	TodoList   TodoList `gorm:"foreignKey:TodoListID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 	TodoListID string   `json:"todo_list_id" gorm:"index;not null" validate:"required"` // Foreign key for TodoList
 
+	Parent   *Todo   `gorm:"foreignKey:ParentID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	ParentID *string `json:"parent_id" gorm:"index"` // Set on subtasks, points at the parent todo in the same list
+
+	Assignee   *User   `gorm:"foreignKey:AssigneeID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"-"`
+	AssigneeID *string `json:"assignee_id" gorm:"index"` // The user responsible for the todo, who must be able to read the list
+
+	Version     int64   `json:"version" gorm:"not null;default:1"` // Increased by the database on every update, sent as the ETag
+	FieldClocks *string `json:"-" gorm:"type:jsonb"`               // The last change of each field, a merge.FieldClock per column, to merge concurrent edits
+
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"` // `omitempty` hides if null
@@ -46,8 +84,9 @@ type TodoList struct {
 	Name            string `json:"name"`
 	Description     string `json:"description"`
 	Color           string `json:"color"`
-	TodoItems       []Todo `gorm:"foreignKey:TodoListID"`                     // Association                               // List of todo items in this list
-	SharedWithUsers []User `gorm:"many2many:shared_with;" json:"shared_with"` //users who can see the todo list even if its not part of a group
+	Position        string `json:"position" gorm:"type:text COLLATE \"C\";index"` // Fractional index key, ordered byte-wise among the owner's lists
+	TodoItems       []Todo `gorm:"foreignKey:TodoListID"`                         // Association                               // List of todo items in this list
+	SharedWithUsers []User `gorm:"many2many:shared_with;" json:"shared_with"`     //users who can see the todo list even if its not part of a group
 
 	Group   *Group  `gorm:"foreignKey:GroupID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"group"`
 	GroupID *string `json:"group_id"` // Foreign key for Group
@@ -55,6 +94,8 @@ type TodoList struct {
 	Owner   *User  `gorm:"foreignKey:OwnerID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"owner"`
 	OwnerID string `json:"owner_id" gorm:"index;not null"` // Foreign key for User
 
+	Version int64 `json:"version" gorm:"not null;default:1"` // Increased by the database on every update, sent as the ETag
+
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"` // `omitempty` hides if null
@@ -67,7 +108,15 @@ type TodoItemResponse struct {
 	IsCompleted bool      `json:"is_completed"`
 	StartDate   time.Time `json:"start_date,omitempty"` // Optional start date
 	EndDate     time.Time `json:"end_date,omitempty"`   // Optional end date
-	Priority    Priority  `json:"priority,omitempty"`   // Default to 'normal', can be 'low', 'medium', 'high'
+	AllDay      bool      `json:"all_day"`
+	Overdue     bool      `json:"overdue"`            // In the user's timezone
+	DueToday    bool      `json:"due_today"`          // In the user's timezone
+	Priority    Priority  `json:"priority,omitempty"` // Default to 'normal', can be 'low', 'medium', 'high'
+	Position    string    `json:"position"`
+	ParentID    *string   `json:"parent_id,omitempty"`
+	AssigneeID  *string   `json:"assignee_id,omitempty"`
+	Blocked     bool      `json:"blocked"` // True while a todo it depends on is not completed
+	Version     int64     `json:"version"`
 	// CreatedAt   time.Time `json:"created_at,omitempty"`
 	// UpdatedAt   time.Time `json:"updated_at,omitempty"`
 }
@@ -84,10 +133,62 @@ type TodoListResponse struct {
 	SharedWith      []UserMinimal      `json:"shared_with,omitempty"`
 	SharedWithCount int                `json:"shared_with_count"`
 	CompletedCount  int                `json:"completed_count"`
+	Position        string             `json:"position"`
+	Version         int64              `json:"version"`
 	// CreatedAt       time.Time          `json:"created_at,omitempty"`
 	// UpdatedAt       time.Time          `json:"updated_at,omitempty"`
 }
 
+// AllDayDate returns the calendar date of t as midnight UTC, how the dates of all-day
+// todos are stored. The zero time is returned unchanged.
+func AllDayDate(t time.Time) time.Time {
+	if t.Year() <= 1 {
+		return t
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// DueState reports whether an open todo is overdue and whether it is due today, for a
+// user in location at the given time. Timed todos are overdue once their end date has
+// passed, all-day todos once their date is before the user's date.
+func (t *Todo) DueState(now time.Time, location *time.Location) (overdue bool, dueToday bool) {
+	if t.IsCompleted || t.EndDate.Year() <= 1 {
+		return false, false
+	}
+
+	local := now.In(location)
+
+	if t.AllDay {
+		today := AllDayDate(local)
+		date := AllDayDate(t.EndDate.UTC())
+		return date.Before(today), date.Equal(today)
+	}
+
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, location)
+	return t.EndDate.Before(now), !t.EndDate.Before(today) && t.EndDate.Before(today.AddDate(0, 0, 1))
+}
+
+// OverdueSQL returns an SQL condition on the todos table matching the open todos that are
+// overdue for a user in location at the given time
+func OverdueSQL(now time.Time, location *time.Location) (string, []interface{}) {
+	return "(todos.is_completed = false AND EXTRACT(YEAR FROM todos.end_date) > 1 AND " +
+			"((todos.all_day AND todos.end_date < ?) OR (NOT todos.all_day AND todos.end_date < ?)))",
+		[]interface{}{AllDayDate(now.In(location)), now}
+}
+
+// DueOnSQL returns an SQL condition on the todos table matching the todos due on the days
+// from `from` up to, but excluding, `to`, counted from the user's today: 0 and 1 match
+// the todos due today. All-day todos match on their date.
+func DueOnSQL(now time.Time, location *time.Location, from int, to int) (string, []interface{}) {
+	local := now.In(location)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, location)
+	date := AllDayDate(local)
+
+	return "((todos.all_day AND todos.end_date >= ? AND todos.end_date < ?) OR " +
+			"(NOT todos.all_day AND todos.end_date >= ? AND todos.end_date < ?))",
+		[]interface{}{date.AddDate(0, 0, from), date.AddDate(0, 0, to), today.AddDate(0, 0, from), today.AddDate(0, 0, to)}
+}
+
 func (t *TodoList) BeforeCreate(tx *gorm.DB) (err error) {
 	if t.ID == "" {
 		t.ID = cuid.New()
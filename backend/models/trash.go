@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// TrashedTodoList is a deleted todo list waiting in the trash
+type TrashedTodoList struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	Description    string    `json:"description"`
+	Color          string    `json:"color"`
+	TodoItemsCount int       `json:"todo_items_count"` // Todos deleted with the list, restored with it
+	DeletedAt      time.Time `json:"deleted_at"`
+	PurgeAt        time.Time `json:"purge_at"` // When the list is permanently deleted
+}
+
+// TrashedTodo is a deleted todo waiting in the trash, together with its deleted subtasks
+type TrashedTodo struct {
+	ID            string    `json:"id"`
+	Task          string    `json:"task"`
+	TodoListID    string    `json:"todo_list_id"`
+	TodoListName  string    `json:"todo_list_name"`
+	SubtasksCount int       `json:"subtasks_count"`
+	DeletedAt     time.Time `json:"deleted_at"`
+	PurgeAt       time.Time `json:"purge_at"` // When the todo is permanently deleted
+}
@@ -73,7 +73,8 @@ type User struct {
 	Name      string         `json:"name" gorm:"not null"`               // Not null, can be empty
 	Email     string         `json:"email" gorm:"unique;not null;index"` // Unique email, not null
 	Password  string         `json:"-"`
-	Image     string         `json:"profile_picture"`                                    // Hashed password
+	Image     string         `json:"profile_picture"`                                    // Managed URL of the uploaded profile picture
+	AvatarID  string         `json:"-"`                                                  // Storage folder of the current profile picture variants
 	Groups    []Group        `gorm:"many2many:group_members;" json:"groups"`             // Many-to-many relationship with Group
 	TodoLists []TodoList     `gorm:"foreignKey:OwnerID;references:ID" json:"todo_lists"` // List of todo lists owned by the user
 	CreatedAt time.Time      `json:"created_at"`
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/lucsky/cuid"
+	"gorm.io/gorm"
+)
+
+// WEBHOOK DELIVERY STATUSES
+const (
+	DeliveryPending   = "pending"   // Waiting for its first or next attempt
+	DeliveryDelivered = "delivered" // The endpoint answered with a 2xx status
+	DeliveryFailed    = "failed"    // Every attempt failed
+)
+
+// A Webhook posts the activities of a group to an endpoint of the group owner, e.g. a
+// chat or CI integration. Webhooks subscribe to activity types, their events.
+type Webhook struct {
+	ID string `json:"id" gorm:"primaryKey;unique;not null"`
+
+	Group   *Group `gorm:"foreignKey:GroupID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	GroupID string `json:"group_id" gorm:"not null;index"`
+
+	CreatedByID string `json:"created_by_id"`
+	URL         string `json:"url" gorm:"not null"`
+	Description string `json:"description"`
+	Secret      string `json:"-" gorm:"not null"` // Signs the deliveries
+	Events      string `json:"-" gorm:"not null"` // Comma separated activity types
+	Active      bool   `json:"active" gorm:"not null"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// A WebhookDelivery is an activity to post to a webhook. Deliveries are written in the
+// transaction of the change they report, as an outbox, and keep the outcome of their
+// last attempt as the delivery log.
+type WebhookDelivery struct {
+	ID string `json:"id" gorm:"primaryKey;unique;not null"`
+
+	Webhook   *Webhook `gorm:"foreignKey:WebhookID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	WebhookID string   `json:"webhook_id" gorm:"not null;index:idx_webhook_deliveries_webhook"`
+
+	Event        string  `json:"event" gorm:"not null"`
+	Payload      string  `json:"-" gorm:"type:jsonb;not null"`
+	RedeliveryOf *string `json:"redelivery_of"` // The delivery this one sends again
+
+	Status         string     `json:"status" gorm:"not null;index:idx_webhook_deliveries_due"`
+	Attempts       int        `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at" gorm:"index:idx_webhook_deliveries_due"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at"`
+	ResponseStatus int        `json:"response_status"`
+	ResponseBody   string     `json:"response_body"` // The start of the body, for debugging
+	LastError      string     `json:"last_error"`
+
+	CreatedAt   time.Time  `json:"created_at" gorm:"index:idx_webhook_deliveries_webhook"`
+	DeliveredAt *time.Time `json:"delivered_at"`
+}
+
+// WebhookPayload is the body posted to webhooks. Receivers recognise redeliveries by the
+// ID of the activity.
+type WebhookPayload struct {
+	Event    string           `json:"event"`
+	Activity ActivityResponse `json:"activity"`
+}
+
+type WebhookResponse struct {
+	ID          string    `json:"id"`
+	GroupID     string    `json:"group_id"`
+	URL         string    `json:"url"`
+	Description string    `json:"description"`
+	Events      []string  `json:"events"`
+	Active      bool      `json:"active"`
+	Secret      string    `json:"secret,omitempty"` // Only returned when created or rotated
+	CreatedByID string    `json:"created_by_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type WebhookDeliveryResponse struct {
+	WebhookDelivery
+	Payload json.RawMessage `json:"payload"`
+}
+
+// EventList returns the events the webhook subscribes to
+func (w *Webhook) EventList() []string {
+	if w.Events == "" {
+		return []string{}
+	}
+	return strings.Split(w.Events, ",")
+}
+
+func (w *Webhook) BeforeCreate(tx *gorm.DB) (err error) {
+	if w.ID == "" {
+		w.ID = cuid.New()
+	}
+	return
+}
+
+func (d *WebhookDelivery) BeforeCreate(tx *gorm.DB) (err error) {
+	if d.ID == "" {
+		d.ID = cuid.New()
+	}
+	return
+}
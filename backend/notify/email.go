@@ -0,0 +1,195 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thompsonmanda08/task-sync/models"
+)
+
+// An Email is a message to send by email. HTML is optional, clients that cannot display
+// it show the plain text.
+type Email struct {
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// A Mailer sends emails
+type Mailer interface {
+	Send(ctx context.Context, email Email) error
+}
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string // Optional, the server is used without authentication when empty
+	Password string
+	From     string // e.g. "Task Sync <no-reply@example.com>"
+}
+
+// SMTPMailer sends emails through an SMTP server. STARTTLS is used when the server
+// offers it.
+type SMTPMailer struct {
+	config SMTPConfig
+	from   string // The address part of config.From, for the envelope
+}
+
+func NewSMTPMailer(config SMTPConfig) (*SMTPMailer, error) {
+	if config.From == "" {
+		return nil, errors.New("SMTP_FROM is required to send emails")
+	}
+
+	from, err := mail.ParseAddress(config.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP_FROM %q: %w", config.From, err)
+	}
+
+	return &SMTPMailer{config: config, from: from.Address}, nil
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, email Email) error {
+	if len(email.To) == 0 {
+		return errors.New("email has no recipients")
+	}
+
+	message, err := m.message(email)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(m.config.Host, strconv.Itoa(m.config.Port))
+	conn, err := (&net.Dialer{Timeout: 30 * time.Second}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to the mail server: %w", err)
+	}
+
+	// THE WHOLE EXCHANGE MUST FINISH BEFORE THE CONTEXT IS DONE
+	deadline := time.Now().Add(time.Minute)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, m.config.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to connect to the mail server: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.config.Host}); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+
+	if m.config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)); err != nil {
+			return fmt.Errorf("failed to authenticate with the mail server: %w", err)
+		}
+	}
+
+	if err := client.Mail(m.from); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	for _, to := range email.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("failed to send email to %s: %w", to, err)
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	if _, err := writer.Write(message); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// message renders an email as a MIME message, multipart when it has an HTML version
+func (m *SMTPMailer) message(email Email) ([]byte, error) {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "From: %s\r\n", m.config.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(email.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", email.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if email.HTML == "" {
+		writePart(&buf, "text/plain", email.Text)
+		return buf.Bytes(), nil
+	}
+
+	boundary, err := randomBoundary()
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+	fmt.Fprintf(&buf, "--%s\r\n", boundary)
+	writePart(&buf, "text/plain", email.Text)
+	fmt.Fprintf(&buf, "\r\n--%s\r\n", boundary)
+	writePart(&buf, "text/html", email.HTML)
+	fmt.Fprintf(&buf, "\r\n--%s--\r\n", boundary)
+
+	return buf.Bytes(), nil
+}
+
+func writePart(buf *bytes.Buffer, contentType string, body string) {
+	fmt.Fprintf(buf, "Content-Type: %s; charset=utf-8\r\n", contentType)
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	writer := quotedprintable.NewWriter(buf)
+	writer.Write([]byte(body))
+	writer.Close()
+}
+
+func randomBoundary() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// EmailChannel delivers messages by email to the user's address
+type EmailChannel struct {
+	mailer Mailer
+}
+
+func NewEmailChannel(mailer Mailer) *EmailChannel {
+	return &EmailChannel{mailer: mailer}
+}
+
+func (ch *EmailChannel) Send(ctx context.Context, user models.User, message Message) error {
+	return ch.mailer.Send(ctx, Email{
+		To:      []string{user.Email},
+		Subject: message.Title,
+		Text:    message.Body,
+	})
+}
@@ -0,0 +1,38 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/thompsonmanda08/task-sync/models"
+	"gorm.io/gorm"
+)
+
+// InAppChannel delivers messages to the user's notification inbox in the database
+type InAppChannel struct {
+	db *gorm.DB
+}
+
+func NewInAppChannel(db *gorm.DB) *InAppChannel {
+	return &InAppChannel{db: db}
+}
+
+func (ch *InAppChannel) Send(ctx context.Context, user models.User, message Message) error {
+	notification := models.Notification{
+		UserID: user.ID,
+		Type:   message.Type,
+		Title:  message.Title,
+		Body:   message.Body,
+	}
+
+	if len(message.Data) > 0 {
+		data, err := json.Marshal(message.Data)
+		if err != nil {
+			return err
+		}
+		value := string(data)
+		notification.Data = &value
+	}
+
+	return ch.db.WithContext(ctx).Create(&notification).Error
+}
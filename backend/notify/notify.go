@@ -0,0 +1,144 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/thompsonmanda08/task-sync/models"
+	"gorm.io/gorm"
+)
+
+// CHANNELS
+const (
+	ChannelInApp   = "in_app"
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+)
+
+// Channels lists every notification channel
+var Channels = []string{ChannelInApp, ChannelEmail, ChannelWebhook}
+
+var (
+	Default *Notifier
+	Mail    Mailer // Nil when no mail server is configured
+
+	ErrUnknownChannel  = errors.New("unknown notification channel")
+	ErrChannelDisabled = errors.New("notification channel is not configured")
+)
+
+// A Message is a notification to deliver to a user
+type Message struct {
+	Type  string                 `json:"type"` // What the notification is about, e.g. "reminder"
+	Title string                 `json:"title"`
+	Body  string                 `json:"body"`
+	Data  map[string]interface{} `json:"data,omitempty"` // IDs of the resources the notification is about
+}
+
+// A Channel delivers messages to users, e.g. by email
+type Channel interface {
+	Send(ctx context.Context, user models.User, message Message) error
+}
+
+// Notifier delivers messages through the channels registered with it
+type Notifier struct {
+	channels map[string]Channel
+}
+
+func NewNotifier() *Notifier {
+	return &Notifier{channels: map[string]Channel{}}
+}
+
+// Register adds a channel under a name, replacing any channel registered under it
+func (n *Notifier) Register(name string, channel Channel) {
+	n.channels[name] = channel
+}
+
+// Enabled reports whether a channel is registered
+func (n *Notifier) Enabled(name string) bool {
+	_, ok := n.channels[name]
+	return ok
+}
+
+// Check returns an error if a channel is unknown or not configured on this server
+func (n *Notifier) Check(name string) error {
+	known := false
+	for _, channel := range Channels {
+		known = known || channel == name
+	}
+
+	switch {
+	case !known:
+		return fmt.Errorf("%w %q", ErrUnknownChannel, name)
+	case !n.Enabled(name):
+		return fmt.Errorf("%w: %s", ErrChannelDisabled, name)
+	}
+	return nil
+}
+
+// Send delivers a message to a user through each of the given channels. It returns the
+// channels that delivered the message, and the errors of those that failed.
+func (n *Notifier) Send(ctx context.Context, user models.User, channels []string, message Message) ([]string, error) {
+	delivered := []string{}
+	var errs []error
+
+	for _, name := range channels {
+		channel, ok := n.channels[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %w", name, ErrChannelDisabled))
+			continue
+		}
+
+		if err := channel.Send(ctx, user, message); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		delivered = append(delivered, name)
+	}
+
+	return delivered, errors.Join(errs...)
+}
+
+// Initialize sets up the default notifier. In-app notifications are always available,
+// email when SMTP_HOST is set and the webhook when NOTIFY_WEBHOOK_URL is set.
+func Initialize(db *gorm.DB) error {
+	notifier := NewNotifier()
+	notifier.Register(ChannelInApp, NewInAppChannel(db))
+
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		port := 587
+		if raw := os.Getenv("SMTP_PORT"); raw != "" {
+			value, err := strconv.Atoi(raw)
+			if err != nil {
+				return fmt.Errorf("invalid SMTP_PORT value: %s, must be a number: %w", raw, err)
+			}
+			port = value
+		}
+
+		mailer, err := NewSMTPMailer(SMTPConfig{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+		})
+		if err != nil {
+			return err
+		}
+		Mail = mailer
+		notifier.Register(ChannelEmail, NewEmailChannel(mailer))
+	}
+
+	if url := os.Getenv("NOTIFY_WEBHOOK_URL"); url != "" {
+		notifier.Register(ChannelWebhook, NewWebhookChannel(url, os.Getenv("NOTIFY_WEBHOOK_SECRET"), 10*time.Second))
+	}
+
+	Default = notifier
+
+	fmt.Println("Notifications initialized")
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/thompsonmanda08/task-sync/models"
+)
+
+// WebhookChannel delivers messages by posting them as JSON to a URL, e.g. a chat
+// integration. When a secret is set, the body is signed with HMAC-SHA256 and the
+// signature sent in the X-TaskSync-Signature header as "sha256=<hex>".
+type WebhookChannel struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// webhookPayload is the body posted by the webhook channel
+type webhookPayload struct {
+	Message
+	User   models.UserMinimal `json:"user"`
+	SentAt time.Time          `json:"sent_at"`
+}
+
+func NewWebhookChannel(url string, secret string, timeout time.Duration) *WebhookChannel {
+	return &WebhookChannel{
+		url:    url,
+		secret: secret,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (ch *WebhookChannel) Send(ctx context.Context, user models.User, message Message) error {
+	body, err := json.Marshal(webhookPayload{
+		Message: message,
+		User:    models.UserMinimal{ID: user.ID, Name: user.Name, Email: user.Email},
+		SentAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ch.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if ch.secret != "" {
+		mac := hmac.New(sha256.New, []byte(ch.secret))
+		mac.Write(body)
+		req.Header.Set("X-TaskSync-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := ch.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package realtime
+
+import (
+	"encoding/json"
+
+	"github.com/thompsonmanda08/task-sync/models"
+	"gorm.io/gorm"
+)
+
+// publishedResources are the resource types of the change history published as events
+var publishedResources = map[string]bool{"todo": true, "todo_list": true, "group_member": true}
+
+// publishChanges is a change listener turning the change records of a statement into one
+// event per changed record, published once the transaction commits
+func publishChanges(tx *gorm.DB, records []models.ChangeRecord) error {
+	var events []*Event
+	byResource := map[string]*Event{}
+	snapshots := map[string]map[string]interface{}{}
+
+	for _, record := range records {
+		if !publishedResources[record.ResourceType] {
+			continue
+		}
+
+		key := record.ResourceType + ":" + record.ResourceID
+		event, ok := byResource[key]
+		if !ok {
+			event = &Event{
+				Type:    record.ResourceType,
+				Action:  models.ChangeUpdate,
+				ID:      record.ResourceID,
+				ActorID: record.ActorID,
+				At:      record.CreatedAt,
+			}
+			byResource[key] = event
+			events = append(events, event)
+		}
+
+		switch {
+		case record.Action != models.ChangeUpdate:
+			event.Action = record.Action
+			if record.Action == models.ChangePurge && record.OldValue != nil {
+				var snapshot map[string]interface{}
+				if json.Unmarshal([]byte(*record.OldValue), &snapshot) == nil {
+					snapshots[key] = snapshot
+				}
+			}
+		case record.Field != "":
+			event.Fields = append(event.Fields, record.Field)
+
+			// MOVES ARE ALSO PUBLISHED WHERE THE RECORD WAS
+			if record.OldValue != nil && (record.Field == "todo_list_id" || record.Field == "group_id") {
+				var from string
+				if json.Unmarshal([]byte(*record.OldValue), &from) == nil {
+					if record.Field == "todo_list_id" {
+						event.FromListID = from
+					} else {
+						event.FromGroupID = from
+					}
+				}
+			}
+		}
+	}
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	if err := locateEvents(tx, events, snapshots); err != nil {
+		return err
+	}
+
+	published := make([]Event, 0, len(events))
+	for _, event := range events {
+		published = append(published, *event)
+	}
+	return broker.Publish(tx, published)
+}
+
+// locateEvents sets the list and group of each event, from the changed rows or, for
+// purged rows, their last state
+func locateEvents(tx *gorm.DB, events []*Event, snapshots map[string]map[string]interface{}) error {
+	ids := map[string][]string{}
+	for _, event := range events {
+		ids[event.Type] = append(ids[event.Type], event.ID)
+	}
+
+	type row struct {
+		ID         string
+		TodoListID string
+		GroupID    *string
+		UserID     string
+		OwnerID    string
+	}
+
+	rows := map[string]row{}
+	load := func(resource string, table string, columns ...string) error {
+		if len(ids[resource]) == 0 {
+			return nil
+		}
+
+		var found []row
+		if err := tx.Table(table).Select(append([]string{"id"}, columns...)).Where("id IN ?", ids[resource]).Find(&found).Error; err != nil {
+			return err
+		}
+		for _, r := range found {
+			rows[resource+":"+r.ID] = r
+		}
+		return nil
+	}
+
+	if err := load("todo", "todos", "todo_list_id"); err != nil {
+		return err
+	}
+	if err := load("todo_list", "todo_lists", "group_id", "owner_id"); err != nil {
+		return err
+	}
+	if err := load("group_member", "user_group_role_mappings", "group_id", "user_id"); err != nil {
+		return err
+	}
+
+	listIDs := []string{}
+	for _, event := range events {
+		key := event.Type + ":" + event.ID
+		r, ok := rows[key]
+		if !ok {
+			r = row{ID: event.ID}
+			snapshot := snapshots[key]
+			r.TodoListID, _ = snapshot["todo_list_id"].(string)
+			r.UserID, _ = snapshot["user_id"].(string)
+			r.OwnerID, _ = snapshot["owner_id"].(string)
+			if groupID, ok := snapshot["group_id"].(string); ok {
+				r.GroupID = &groupID
+			}
+		}
+
+		switch event.Type {
+		case "todo":
+			event.ListID = r.TodoListID
+			listIDs = append(listIDs, r.TodoListID)
+		case "todo_list":
+			event.ListID = event.ID
+			event.OwnerID = r.OwnerID
+		case "group_member":
+			event.UserID = r.UserID
+		}
+		if r.GroupID != nil {
+			event.GroupID = *r.GroupID
+		}
+	}
+
+	// TODOS ARE ALSO PUBLISHED ON THE GROUP OF THEIR LIST
+	if len(listIDs) > 0 {
+		var lists []row
+		if err := tx.Table("todo_lists").Select("id", "group_id").Where("id IN ?", listIDs).Find(&lists).Error; err != nil {
+			return err
+		}
+
+		groups := map[string]string{}
+		for _, list := range lists {
+			if list.GroupID != nil {
+				groups[list.ID] = *list.GroupID
+			}
+		}
+		for _, event := range events {
+			if event.Type == "todo" {
+				event.GroupID = groups[event.ListID]
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,240 @@
+package realtime
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// subscriberBuffer is how many events may wait for a slow subscriber before it is
+	// disconnected
+	subscriberBuffer = 256
+
+	// replayBuffer is how many of the latest events a hub keeps, at least, for clients
+	// resuming a stream
+	replayBuffer = 1000
+)
+
+// A Subscriber receives the events of the topics it subscribed to, on one node
+type Subscriber struct {
+	UserID string
+	Events chan Event // Closed when the subscriber is removed or falls behind
+
+	hub    *Hub
+	topics map[string]bool
+	closed bool
+}
+
+// A Hub fans the events delivered on a node out to the subscribers of their topics
+type Hub struct {
+	mu     sync.Mutex
+	topics map[string]map[*Subscriber]bool
+
+	presence map[string]map[string]Presence // Sessions by topic and session ID
+
+	epoch  string  // Tells the event IDs of this hub apart from those of other nodes and restarts
+	seq    uint64  // The sequence number of the last delivered event
+	recent []Event // The latest delivered events, oldest first
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		topics:   map[string]map[*Subscriber]bool{},
+		presence: map[string]map[string]Presence{},
+		epoch:    strconv.FormatInt(time.Now().UnixNano(), 36),
+	}
+}
+
+// Add returns a new subscriber for a user, without topics
+func (h *Hub) Add(userID string) *Subscriber {
+	return &Subscriber{
+		UserID: userID,
+		Events: make(chan Event, subscriberBuffer),
+		hub:    h,
+		topics: map[string]bool{},
+	}
+}
+
+// Resume returns a new subscriber for a user, subscribed to topics, and the buffered
+// events on those topics since lastEventID. It returns false when some of the events
+// since then are no longer buffered, or the ID comes from another node or an earlier run,
+// in which case the client must sync instead.
+func (h *Hub) Resume(userID string, topics []string, lastEventID string) (*Subscriber, []Event, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.Add(userID)
+	for _, topic := range topics {
+		h.subscribe(s, topic)
+	}
+
+	if lastEventID == "" {
+		return s, nil, true
+	}
+
+	epoch, seqText, _ := strings.Cut(lastEventID, "-")
+	seq, err := strconv.ParseUint(seqText, 10, 64)
+	if err != nil || epoch != h.epoch || seq > h.seq {
+		return s, nil, false
+	}
+	if seq < h.seq && (len(h.recent) == 0 || seq+1 < h.recent[0].Seq) {
+		return s, nil, false
+	}
+
+	missed := []Event{}
+	for _, event := range h.recent {
+		if event.Seq <= seq {
+			continue
+		}
+		for _, topic := range event.Topics() {
+			if s.topics[topic] {
+				missed = append(missed, event)
+				break
+			}
+		}
+	}
+	return s, missed, true
+}
+
+// EventID returns the ID of an event delivered by this hub, for clients to resume from
+func (h *Hub) EventID(event Event) string {
+	return fmt.Sprintf("%s-%d", h.epoch, event.Seq)
+}
+
+// LastEventID returns the ID of the last event this hub delivered
+func (h *Hub) LastEventID() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.EventID(Event{Seq: h.seq})
+}
+
+// Subscribe adds a topic to a subscriber
+func (s *Subscriber) Subscribe(topic string) {
+	h := s.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.subscribe(s, topic)
+}
+
+// SetTopics replaces the topics of a subscriber
+func (s *Subscriber) SetTopics(topics []string) {
+	h := s.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	keep := map[string]bool{}
+	for _, topic := range topics {
+		keep[topic] = true
+		h.subscribe(s, topic)
+	}
+	for topic := range s.topics {
+		if !keep[topic] {
+			h.unsubscribe(s, topic)
+		}
+	}
+}
+
+// Unsubscribe removes a topic from a subscriber
+func (s *Subscriber) Unsubscribe(topic string) {
+	h := s.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.unsubscribe(s, topic)
+}
+
+// Topics returns the topics of a subscriber
+func (s *Subscriber) Topics() []string {
+	h := s.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	topics := make([]string, 0, len(s.topics))
+	for topic := range s.topics {
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+// Close removes a subscriber from all its topics and closes its events
+func (s *Subscriber) Close() {
+	h := s.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.close(s)
+}
+
+func (h *Hub) subscribe(s *Subscriber, topic string) {
+	if s.closed {
+		return
+	}
+
+	if h.topics[topic] == nil {
+		h.topics[topic] = map[*Subscriber]bool{}
+	}
+	h.topics[topic][s] = true
+	s.topics[topic] = true
+}
+
+func (h *Hub) unsubscribe(s *Subscriber, topic string) {
+	delete(s.topics, topic)
+	delete(h.topics[topic], s)
+	if len(h.topics[topic]) == 0 {
+		delete(h.topics, topic)
+	}
+}
+
+func (h *Hub) close(s *Subscriber) {
+	if s.closed {
+		return
+	}
+
+	for topic := range s.topics {
+		h.unsubscribe(s, topic)
+	}
+	s.closed = true
+	close(s.Events)
+}
+
+// Deliver sends an event to the subscribers of its topics, once each, and keeps it for
+// replays. Subscribers whose buffer is full are closed rather than slowing down the
+// others; their clients reconnect and resume or catch up with a sync. Presence events
+// update the presence of their topic instead, which is sent to its subscribers.
+func (h *Hub) Deliver(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if event.Type == TypePresence {
+		h.applyPresence(event)
+		return
+	}
+
+	h.seq++
+	event.Seq = h.seq
+	h.recent = append(h.recent, event)
+	if len(h.recent) == 2*replayBuffer {
+		h.recent = append(h.recent[:0], h.recent[replayBuffer:]...)
+	}
+
+	sent := map[*Subscriber]bool{}
+	for _, topic := range event.Topics() {
+		for s := range h.topics[topic] {
+			if sent[s] {
+				continue
+			}
+			sent[s] = true
+
+			select {
+			case s.Events <- event:
+			default:
+				h.close(s)
+			}
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package realtime
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// testHub returns a hub that delivered n events, on list "odd" or "even" by their
+// sequence number
+func testHub(n int) *Hub {
+	h := NewHub()
+	for seq := 1; seq <= n; seq++ {
+		list := "even"
+		if seq%2 == 1 {
+			list = "odd"
+		}
+		h.Deliver(Event{Type: "todo", Action: "update", ID: fmt.Sprintf("todo-%d", seq), ListID: list})
+	}
+	return h
+}
+
+func seqs(events []Event) []uint64 {
+	result := []uint64{}
+	for _, event := range events {
+		result = append(result, event.Seq)
+	}
+	return result
+}
+
+func seqRange(from uint64, to uint64) []uint64 {
+	result := []uint64{}
+	for seq := from; seq <= to; seq++ {
+		result = append(result, seq)
+	}
+	return result
+}
+
+func TestHubResume(t *testing.T) {
+	odd, even := Topic(TopicList, "odd"), Topic(TopicList, "even")
+
+	tests := []struct {
+		name        string
+		delivered   int
+		topics      []string
+		lastEventID func(h *Hub) string
+		wantOK      bool
+		wantSeqs    []uint64
+	}{
+		{
+			name:        "no last event ID",
+			delivered:   10,
+			topics:      []string{odd, even},
+			lastEventID: func(h *Hub) string { return "" },
+			wantOK:      true,
+			wantSeqs:    []uint64{},
+		},
+		{
+			name:        "inside the buffer",
+			delivered:   10,
+			topics:      []string{odd, even},
+			lastEventID: func(h *Hub) string { return h.EventID(Event{Seq: 5}) },
+			wantOK:      true,
+			wantSeqs:    seqRange(6, 10),
+		},
+		{
+			name:        "filtered by topic",
+			delivered:   10,
+			topics:      []string{odd},
+			lastEventID: func(h *Hub) string { return h.EventID(Event{Seq: 5}) },
+			wantOK:      true,
+			wantSeqs:    []uint64{7, 9},
+		},
+		{
+			name:        "other topics only",
+			delivered:   10,
+			topics:      []string{Topic(TopicGroup, "other")},
+			lastEventID: func(h *Hub) string { return h.EventID(Event{Seq: 5}) },
+			wantOK:      true,
+			wantSeqs:    []uint64{},
+		},
+		{
+			name:        "up to date",
+			delivered:   10,
+			topics:      []string{odd, even},
+			lastEventID: func(h *Hub) string { return h.LastEventID() },
+			wantOK:      true,
+			wantSeqs:    []uint64{},
+		},
+		{
+			name:        "from the start of the buffer",
+			delivered:   10,
+			topics:      []string{odd, even},
+			lastEventID: func(h *Hub) string { return h.EventID(Event{Seq: 0}) },
+			wantOK:      true,
+			wantSeqs:    seqRange(1, 10),
+		},
+		{
+			name:        "at the oldest event kept after a trim",
+			delivered:   2 * replayBuffer,
+			topics:      []string{odd, even},
+			lastEventID: func(h *Hub) string { return h.EventID(Event{Seq: replayBuffer}) },
+			wantOK:      true,
+			wantSeqs:    seqRange(replayBuffer+1, 2*replayBuffer),
+		},
+		{
+			name:        "before the oldest event kept after a trim",
+			delivered:   2 * replayBuffer,
+			topics:      []string{odd, even},
+			lastEventID: func(h *Hub) string { return h.EventID(Event{Seq: replayBuffer - 1}) },
+			wantOK:      false,
+		},
+		{
+			name:        "other epoch",
+			delivered:   10,
+			topics:      []string{odd, even},
+			lastEventID: func(h *Hub) string { return "0earlier-5" },
+			wantOK:      false,
+		},
+		{
+			name:        "ahead of the hub",
+			delivered:   10,
+			topics:      []string{odd, even},
+			lastEventID: func(h *Hub) string { return h.EventID(Event{Seq: 11}) },
+			wantOK:      false,
+		},
+		{
+			name:        "malformed",
+			delivered:   10,
+			topics:      []string{odd, even},
+			lastEventID: func(h *Hub) string { return h.epoch + "-five" },
+			wantOK:      false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := testHub(test.delivered)
+			lastEventID := test.lastEventID(h)
+
+			s, missed, ok := h.Resume("user", test.topics, lastEventID)
+			if ok != test.wantOK {
+				t.Fatalf("Resume(%q) ok = %v, want %v", lastEventID, ok, test.wantOK)
+			}
+			if test.wantOK && !reflect.DeepEqual(seqs(missed), test.wantSeqs) {
+				t.Errorf("Resume(%q) replayed %v, want %v", lastEventID, seqs(missed), test.wantSeqs)
+			}
+			if !test.wantOK && len(missed) > 0 {
+				t.Errorf("Resume(%q) replayed %d events without resuming", lastEventID, len(missed))
+			}
+
+			// THE SUBSCRIBER GETS THE NEXT EVENTS OF ITS TOPICS EITHER WAY
+			want := 0
+			for _, list := range []string{"odd", "even"} {
+				event := Event{Type: "todo", Action: "update", ID: "next", ListID: list}
+				h.Deliver(event)
+				for _, topic := range test.topics {
+					if topic == event.Topics()[0] {
+						want++
+					}
+				}
+			}
+			if got := len(s.Events); got != want {
+				t.Errorf("subscriber received %d events after resuming, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestHubResumeReplaysEventsOnce(t *testing.T) {
+	h := NewHub()
+	h.Deliver(Event{Type: "todo", Action: "update", ID: "moved", ListID: "to", FromListID: "from"})
+
+	_, missed, ok := h.Resume("user", []string{Topic(TopicList, "from"), Topic(TopicList, "to")}, h.EventID(Event{Seq: 0}))
+	if !ok {
+		t.Fatal("Resume() did not resume")
+	}
+	if len(missed) != 1 || missed[0].ID != "moved" {
+		t.Errorf("Resume() replayed %v, want the moved todo once", missed)
+	}
+}
+
+func TestHubTrimsReplayBuffer(t *testing.T) {
+	tests := []struct {
+		delivered int
+		wantKept  int
+		wantFirst uint64
+	}{
+		{delivered: replayBuffer, wantKept: replayBuffer, wantFirst: 1},
+		{delivered: 2*replayBuffer - 1, wantKept: 2*replayBuffer - 1, wantFirst: 1},
+		{delivered: 2 * replayBuffer, wantKept: replayBuffer, wantFirst: replayBuffer + 1},
+		{delivered: 2*replayBuffer + 1, wantKept: replayBuffer + 1, wantFirst: replayBuffer + 1},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprint(test.delivered), func(t *testing.T) {
+			h := testHub(test.delivered)
+			if len(h.recent) != test.wantKept || h.recent[0].Seq != test.wantFirst {
+				t.Errorf("kept %d events from %d, want %d from %d", len(h.recent), h.recent[0].Seq, test.wantKept, test.wantFirst)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package realtime
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"gorm.io/gorm"
+)
+
+const (
+	commitPollInterval = 20 * time.Millisecond
+	commitPollTimeout  = 10 * time.Minute
+)
+
+// MemoryBroker delivers events on the node that published them, for deployments of a
+// single node. It waits for the publishing transaction to commit by polling its status.
+type MemoryBroker struct {
+	db *gorm.DB
+
+	mu      sync.Mutex
+	deliver func(Event)
+}
+
+func NewMemoryBroker(db *gorm.DB) *MemoryBroker {
+	return &MemoryBroker{db: db}
+}
+
+func (b *MemoryBroker) Listen(deliver func(Event)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.deliver = deliver
+	return nil
+}
+
+func (b *MemoryBroker) Publish(tx *gorm.DB, events []Event) error {
+	var txid int64
+	if err := tx.Raw("SELECT txid_current()").Scan(&txid).Error; err != nil {
+		return err
+	}
+
+	go b.deliverOnCommit(txid, events)
+	return nil
+}
+
+func (b *MemoryBroker) Broadcast(event Event) error {
+	b.mu.Lock()
+	deliver := b.deliver
+	b.mu.Unlock()
+
+	if deliver != nil {
+		deliver(event)
+	}
+	return nil
+}
+
+// deliverOnCommit delivers events once their transaction commits, and drops them if it
+// rolls back
+func (b *MemoryBroker) deliverOnCommit(txid int64, events []Event) {
+	deadline := time.Now().Add(commitPollTimeout)
+
+	for time.Now().Before(deadline) {
+		time.Sleep(commitPollInterval)
+
+		var status *string
+		if err := b.db.Raw("SELECT txid_status(?)", txid).Scan(&status).Error; err != nil {
+			log.Errorf("Failed to check the commit of realtime events: %v", err)
+			continue
+		}
+
+		switch {
+		case status == nil || *status == "aborted":
+			return
+		case *status == "committed":
+			b.mu.Lock()
+			deliver := b.deliver
+			b.mu.Unlock()
+
+			if deliver != nil {
+				for _, event := range events {
+					deliver(event)
+				}
+			}
+			return
+		}
+	}
+
+	log.Errorf("Dropped realtime events of transaction %d, which did not finish in %s", txid, commitPollTimeout)
+}
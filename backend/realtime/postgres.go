@@ -0,0 +1,116 @@
+package realtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2/log"
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/gorm"
+)
+
+// notifyChannel is the Postgres channel events are sent on
+const notifyChannel = "task_sync_events"
+
+// PostgresBroker shares events between nodes with LISTEN/NOTIFY. Notifications are sent
+// in the publishing transaction, so Postgres only delivers them once it commits. Each node
+// holds one connection listening for them.
+type PostgresBroker struct {
+	db *gorm.DB
+}
+
+func NewPostgresBroker(db *gorm.DB) *PostgresBroker {
+	return &PostgresBroker{db: db}
+}
+
+func (b *PostgresBroker) Publish(tx *gorm.DB, events []Event) error {
+	for _, event := range events {
+		if err := notify(tx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *PostgresBroker) Broadcast(event Event) error {
+	return notify(b.db, event)
+}
+
+func notify(db *gorm.DB, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if err := db.Exec("SELECT pg_notify(?, ?)", notifyChannel, string(payload)).Error; err != nil {
+		return fmt.Errorf("failed to publish realtime event: %w", err)
+	}
+	return nil
+}
+
+// Listen starts listening in the background. Events sent while the connection is being
+// re-established are lost; clients catch up with a sync.
+func (b *PostgresBroker) Listen(deliver func(Event)) error {
+	sqlDB, err := b.db.DB()
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		backoff := time.Second
+		for {
+			started := time.Now()
+			err := b.listen(context.Background(), sqlDB.Conn, deliver)
+
+			// A CONNECTION THAT LASTED RESETS THE BACKOFF
+			if time.Since(started) > time.Minute {
+				backoff = time.Second
+			}
+			log.Errorf("Realtime listener disconnected, retrying in %s: %v", backoff, err)
+			time.Sleep(backoff)
+			backoff = min(backoff*2, time.Minute)
+		}
+	}()
+
+	return nil
+}
+
+func (b *PostgresBroker) listen(ctx context.Context, connect func(context.Context) (*sql.Conn, error), deliver func(Event)) error {
+	conn, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// THE CONNECTION IS TAKEN OUT OF THE POOL FOR AS LONG AS IT LISTENS
+	return conn.Raw(func(driverConn interface{}) error {
+		stdlibConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errors.New("the realtime postgres broker needs the pgx driver")
+		}
+		pgConn := stdlibConn.Conn()
+
+		if _, err := pgConn.Exec(ctx, "LISTEN "+notifyChannel); err != nil {
+			return err
+		}
+		log.Infof("Listening for realtime events on %s", notifyChannel)
+
+		for {
+			notification, err := pgConn.WaitForNotification(ctx)
+			if err != nil {
+				return err
+			}
+
+			var event Event
+			if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+				log.Errorf("Invalid realtime event: %v", err)
+				continue
+			}
+			deliver(event)
+		}
+	})
+}
@@ -0,0 +1,142 @@
+package realtime
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// TypePresence is the type of the events announcing and listing who is on a topic
+	TypePresence = "presence"
+
+	PresenceUpdate = "update" // A session is on the topic, or changed what it is doing
+	PresenceLeave  = "leave"  // A session left the topic
+
+	// PresenceRefresh is how often sessions announce themselves again, so that the
+	// presence of sessions on nodes that died expires
+	PresenceRefresh = 30 * time.Second
+	presenceTimeout = 75 * time.Second
+
+	// TypingTimeout is how long a typing indicator lasts unless the client repeats it
+	TypingTimeout = 10 * time.Second
+
+	presenceSweepInterval = 5 * time.Second
+)
+
+// A Presence is one session, a connection of a user, viewing a list or group
+type Presence struct {
+	SessionID     string    `json:"session_id"`
+	UserID        string    `json:"user_id"`
+	EditingTodoID string    `json:"editing_todo_id,omitempty"` // The todo the user has open for editing
+	Typing        bool      `json:"typing"`
+	Since         time.Time `json:"since"` // When the session started viewing the topic
+
+	// When this node last heard of the session, and of it typing. Expiry uses the time of
+	// the node rather than of the session, so clock skew between nodes does not matter.
+	seenAt   time.Time
+	typingAt time.Time
+}
+
+// Presence returns the sessions on a topic, the longest present first
+func (h *Hub) Presence(topic string) []Presence {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.presenceOf(topic)
+}
+
+func (h *Hub) presenceOf(topic string) []Presence {
+	sessions := make([]Presence, 0, len(h.presence[topic]))
+	for _, p := range h.presence[topic] {
+		sessions = append(sessions, p)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].Since.Equal(sessions[j].Since) {
+			return sessions[i].Since.Before(sessions[j].Since)
+		}
+		return sessions[i].SessionID < sessions[j].SessionID
+	})
+	return sessions
+}
+
+// applyPresence records a presence event and sends the new presence of the topic to its
+// subscribers. The hub must be locked.
+func (h *Hub) applyPresence(event Event) {
+	now := time.Now()
+	sessions := h.presence[event.Topic]
+
+	for _, p := range event.Presence {
+		if event.Action == PresenceLeave {
+			delete(sessions, p.SessionID)
+			continue
+		}
+
+		if sessions == nil {
+			sessions = map[string]Presence{}
+			h.presence[event.Topic] = sessions
+		}
+		p.seenAt = now
+		if p.Typing {
+			p.typingAt = now
+		}
+		sessions[p.SessionID] = p
+	}
+
+	if len(sessions) == 0 {
+		delete(h.presence, event.Topic)
+	}
+	h.sendPresence(event.Topic)
+}
+
+// sendPresence sends the presence of a topic to its subscribers. The hub must be locked.
+func (h *Hub) sendPresence(topic string) {
+	event := Event{Type: TypePresence, Topic: topic, Presence: h.presenceOf(topic), At: time.Now()}
+
+	for s := range h.topics[topic] {
+		select {
+		case s.Events <- event:
+		default:
+			h.close(s)
+		}
+	}
+}
+
+// ExpirePresence removes the sessions not heard of since the presence timeout and the
+// typing indicators not repeated since the typing timeout, and sends the topics that
+// changed to their subscribers
+func (h *Hub) ExpirePresence(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for topic, sessions := range h.presence {
+		changed := false
+		for id, p := range sessions {
+			switch {
+			case now.Sub(p.seenAt) > presenceTimeout:
+				delete(sessions, id)
+				changed = true
+			case p.Typing && now.Sub(p.typingAt) > TypingTimeout:
+				p.Typing = false
+				sessions[id] = p
+				changed = true
+			}
+		}
+
+		if len(sessions) == 0 {
+			delete(h.presence, topic)
+		}
+		if changed {
+			h.sendPresence(topic)
+		}
+	}
+}
+
+// sweepPresence expires presence for the lifetime of the process
+func (h *Hub) sweepPresence() {
+	ticker := time.NewTicker(presenceSweepInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		h.ExpirePresence(now)
+	}
+}
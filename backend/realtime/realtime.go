@@ -0,0 +1,142 @@
+// Package realtime publishes the changes of todos, todo lists and group memberships to
+// the clients subscribed to them, on every node of the deployment.
+package realtime
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/thompsonmanda08/task-sync/database"
+	"gorm.io/gorm"
+)
+
+// TOPIC PREFIXES, A TOPIC IS A PREFIX AND AN ID, e.g. "list:<id>"
+const (
+	TopicList  = "list"
+	TopicGroup = "group"
+	TopicUser  = "user" // Lists a user owns and their memberships, for streams of everything a user can access
+)
+
+// An Event tells subscribers that a record changed. Events only carry IDs; clients fetch
+// the records, or sync, to see the change.
+type Event struct {
+	Type    string   `json:"type"`   // todo, todo_list, group_member or presence
+	Action  string   `json:"action"` // create, update, delete, restore or purge
+	ID      string   `json:"id"`
+	ListID  string   `json:"list_id,omitempty"`  // The list of a todo, or the list itself
+	GroupID string   `json:"group_id,omitempty"` // The group of a list or membership
+	UserID  string   `json:"user_id,omitempty"`  // The member, for membership events
+	OwnerID string   `json:"owner_id,omitempty"` // The owner of a list, for list events
+	Fields  []string `json:"fields,omitempty"`   // The changed fields, for updates
+	ActorID *string  `json:"actor_id"`
+
+	// Where the record was before a move, so subscribers of the old list or group learn
+	// it left
+	FromListID  string `json:"from_list_id,omitempty"`
+	FromGroupID string `json:"from_group_id,omitempty"`
+
+	// The topic and its sessions, for presence events
+	Topic    string     `json:"topic,omitempty"`
+	Presence []Presence `json:"presence,omitempty"`
+
+	At time.Time `json:"at"`
+
+	Seq uint64 `json:"-"` // The order in which the hub of this node delivered the event
+}
+
+// Topic returns the topic of a list or group
+func Topic(prefix string, id string) string {
+	return prefix + ":" + id
+}
+
+// ParseTopic splits a topic clients can subscribe to into its prefix and ID
+func ParseTopic(topic string) (string, string, error) {
+	prefix, id, ok := strings.Cut(topic, ":")
+	if !ok || id == "" || (prefix != TopicList && prefix != TopicGroup) {
+		return "", "", fmt.Errorf("invalid topic %q, expected list:<id> or group:<id>", topic)
+	}
+	return prefix, id, nil
+}
+
+// Topics returns the topics an event is published on
+func (e Event) Topics() []string {
+	if e.Type == TypePresence {
+		return []string{e.Topic}
+	}
+
+	topics := []string{}
+	for _, id := range []string{e.ListID, e.FromListID} {
+		if id != "" {
+			topics = append(topics, Topic(TopicList, id))
+		}
+	}
+	for _, id := range []string{e.GroupID, e.FromGroupID} {
+		if id != "" {
+			topics = append(topics, Topic(TopicGroup, id))
+		}
+	}
+	for _, id := range []string{e.OwnerID, e.UserID} {
+		if id != "" {
+			topics = append(topics, Topic(TopicUser, id))
+		}
+	}
+	return topics
+}
+
+// A Broker carries events between the nodes of a deployment
+type Broker interface {
+	// Publish sends events to every node once the transaction of tx commits. Events of
+	// transactions that roll back are never delivered.
+	Publish(tx *gorm.DB, events []Event) error
+
+	// Broadcast sends an event that is not part of a transaction to every node
+	Broadcast(event Event) error
+
+	// Listen delivers the events published by every node, for the lifetime of the process
+	Listen(deliver func(Event)) error
+}
+
+var (
+	Default *Hub
+	broker  Broker
+)
+
+// PublishPresence tells every node that a session is on a topic, or left it
+func PublishPresence(action string, topic string, presence Presence) error {
+	return broker.Broadcast(Event{
+		Type:     TypePresence,
+		Action:   action,
+		Topic:    topic,
+		Presence: []Presence{presence},
+		At:       time.Now(),
+	})
+}
+
+// Initialize sets up the hub of this node and the broker selected with REALTIME_BROKER:
+// "memory" for a single node, the default, or "postgres" to share events between nodes
+// with LISTEN/NOTIFY. Changes are published from the change history.
+func Initialize(db *gorm.DB) error {
+	switch name := os.Getenv("REALTIME_BROKER"); name {
+	case "", "memory":
+		broker = NewMemoryBroker(db)
+	case "postgres":
+		broker = NewPostgresBroker(db)
+	default:
+		return fmt.Errorf("invalid REALTIME_BROKER value: %s, must be memory or postgres", name)
+	}
+
+	Default = NewHub()
+	if err := broker.Listen(Default.Deliver); err != nil {
+		return fmt.Errorf("failed to listen for realtime events: %w", err)
+	}
+
+	go Default.sweepPresence()
+
+	database.OnChange(publishChanges)
+
+	fmt.Println("Realtime events initialized")
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var (
+	Store Storage
+
+	ErrObjectNotFound = errors.New("object not found")
+)
+
+// Storage is a blob store for uploaded files. Keys are slash separated paths such as
+// "attachments/ab/abcdef...".
+type Storage interface {
+	// Put stores the contents of r under key, replacing any existing object.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the object stored under key. Callers must close the returned reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object stored under key. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Initialize sets up the storage backend selected by STORAGE_DRIVER ("local" or "s3").
+func Initialize() error {
+	driver := os.Getenv("STORAGE_DRIVER")
+	if driver == "" {
+		driver = "local"
+	}
+
+	switch driver {
+	case "local":
+		root := os.Getenv("STORAGE_LOCAL_PATH")
+		if root == "" {
+			root = "./uploads" // Relative to the working directory of the app
+		}
+
+		store, err := NewLocalStorage(root)
+		if err != nil {
+			return err
+		}
+		Store = store
+
+	case "s3":
+		store, err := NewS3Storage(S3Config{
+			Endpoint:     os.Getenv("S3_ENDPOINT"),
+			Region:       os.Getenv("S3_REGION"),
+			Bucket:       os.Getenv("S3_BUCKET"),
+			AccessKey:    os.Getenv("S3_ACCESS_KEY"),
+			SecretKey:    os.Getenv("S3_SECRET_KEY"),
+			UsePathStyle: os.Getenv("S3_USE_PATH_STYLE") != "false", // MinIO and most S3-compatible servers need path style
+		})
+		if err != nil {
+			return err
+		}
+		Store = store
+
+	default:
+		return fmt.Errorf("unknown STORAGE_DRIVER %q, expected \"local\" or \"s3\"", driver)
+	}
+
+	fmt.Println("Storage initialized with driver: " + driver)
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+// The s3 driver is tested against MinIO when S3_TEST_ENDPOINT is set, e.g. with the
+// minio service of docker-compose:
+//
+//	S3_TEST_ENDPOINT=http://localhost:9000 S3_TEST_BUCKET=task-sync-test \
+//	S3_TEST_ACCESS_KEY=... S3_TEST_SECRET_KEY=... go test ./storage
+//
+// The bucket must exist.
+func TestS3StorageRoundTrip(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT is not set")
+	}
+
+	store, err := NewS3Storage(S3Config{
+		Endpoint:     endpoint,
+		Region:       os.Getenv("S3_TEST_REGION"),
+		Bucket:       os.Getenv("S3_TEST_BUCKET"),
+		AccessKey:    os.Getenv("S3_TEST_ACCESS_KEY"),
+		SecretKey:    os.Getenv("S3_TEST_SECRET_KEY"),
+		UsePathStyle: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testRoundTrip(t, store)
+}
+
+func TestLocalStorageRoundTrip(t *testing.T) {
+	store, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testRoundTrip(t, store)
+}
+
+// testRoundTrip stores, reads back and deletes objects, with keys that need escaping
+func testRoundTrip(t *testing.T, store Storage) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		key  string
+		data []byte
+	}{
+		{"text", "tests/round-trip/hello.txt", []byte("hello, world")},
+		{"binary", "tests/round-trip/binary", []byte{0, 1, 2, 0xff, 0xfe}},
+		{"empty", "tests/round-trip/empty", []byte{}},
+		{"escaped key", "tests/round-trip/with space+plus", []byte("escaped")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := store.Put(ctx, tt.key, bytes.NewReader(tt.data), int64(len(tt.data)), "application/octet-stream"); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			t.Cleanup(func() { store.Delete(ctx, tt.key) })
+
+			reader, err := store.Get(ctx, tt.key)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			got, err := io.ReadAll(reader)
+			reader.Close()
+			if err != nil {
+				t.Fatalf("reading object: %v", err)
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Fatalf("Get returned %q, want %q", got, tt.data)
+			}
+
+			// PUT REPLACES THE OBJECT
+			replacement := append([]byte("replaced "), tt.data...)
+			if err := store.Put(ctx, tt.key, bytes.NewReader(replacement), int64(len(replacement)), "text/plain"); err != nil {
+				t.Fatalf("Put again: %v", err)
+			}
+			reader, err = store.Get(ctx, tt.key)
+			if err != nil {
+				t.Fatalf("Get after replace: %v", err)
+			}
+			got, _ = io.ReadAll(reader)
+			reader.Close()
+			if !bytes.Equal(got, replacement) {
+				t.Fatalf("Get after replace returned %q, want %q", got, replacement)
+			}
+
+			if err := store.Delete(ctx, tt.key); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if _, err := store.Get(ctx, tt.key); !errors.Is(err, ErrObjectNotFound) {
+				t.Fatalf("Get after delete returned %v, want ErrObjectNotFound", err)
+			}
+
+			// DELETING A MISSING OBJECT IS NOT AN ERROR
+			if err := store.Delete(ctx, tt.key); err != nil {
+				t.Fatalf("Delete of a missing object: %v", err)
+			}
+		})
+	}
+}
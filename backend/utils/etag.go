@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ETag returns the entity tag of a record at a version, e.g. "7"
+func ETag(version int64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// RepresentationETag returns the entity tag of a response representing a record at a
+// version, e.g. "7.1f0c4e9a2b3d5c6e". Responses also carry embedded records and values
+// derived at request time, so the tag includes a hash of the response. It starts with
+// the record's version, which is what If-Match compares.
+func RepresentationETag(version int64, representation interface{}) string {
+	data, err := json.Marshal(representation)
+	if err != nil {
+		return ETag(version)
+	}
+
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf(`"%d.%x"`, version, sum[:8])
+}
+
+// etagVersion returns the record version of a strong entity tag. Weak tags, "W/"-prefixed,
+// have no version since If-Match compares tags strongly.
+func etagVersion(tag string) (int64, bool) {
+	tag = strings.TrimSpace(tag)
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+
+	value, _, _ := strings.Cut(tag[1:len(tag)-1], ".")
+	version, err := strconv.ParseInt(value, 10, 64)
+	return version, err == nil
+}
+
+// IfMatch reports whether the If-Match header of a request allows changing a record at
+// a version. Requests without the header are unconditional. Weak tags never match, as
+// If-Match uses the strong comparison of RFC 9110.
+func IfMatch(c *fiber.Ctx, version int64) bool {
+	header := strings.TrimSpace(c.Get(fiber.HeaderIfMatch))
+	if header == "" || header == "*" {
+		return true
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		if tagVersion, ok := etagVersion(tag); ok && tagVersion == version {
+			return true
+		}
+	}
+	return false
+}
+
+// NotModified sets the ETag header of a response and reports whether the If-None-Match
+// header of the request already has it, in which case 304 Not Modified is sent instead.
+// If-None-Match uses the weak comparison, so weak tags match too.
+func NotModified(c *fiber.Ctx, etag string) bool {
+	c.Set(fiber.HeaderETag, etag)
+
+	header := strings.TrimSpace(c.Get(fiber.HeaderIfNoneMatch))
+	if header == "*" {
+		return true
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
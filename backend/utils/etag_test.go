@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// conditional runs check in a request carrying a header and returns its result
+func conditional(t *testing.T, header string, value string, check func(c *fiber.Ctx) bool) bool {
+	t.Helper()
+
+	var result bool
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		result = check(c)
+		return nil
+	})
+
+	request := httptest.NewRequest("GET", "/", nil)
+	if value != "" {
+		request.Header.Set(header, value)
+	}
+	if _, err := app.Test(request, -1); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestIfMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{name: "no header", header: "", want: true},
+		{name: "any", header: "*", want: true},
+		{name: "same version", header: `"7"`, want: true},
+		{name: "representation of the same version", header: `"7.1f0c4e9a2b3d5c6e"`, want: true},
+		{name: "one of several tags", header: `"6", "7"`, want: true},
+		{name: "other version", header: `"6"`, want: false},
+		{name: "weak tag of the same version", header: `W/"7"`, want: false},
+		{name: "unquoted", header: `7`, want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := conditional(t, fiber.HeaderIfMatch, test.header, func(c *fiber.Ctx) bool { return IfMatch(c, 7) })
+			if got != test.want {
+				t.Errorf("IfMatch(%q) = %v, want %v", test.header, got, test.want)
+			}
+		})
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{name: "no header", header: "", want: false},
+		{name: "any", header: "*", want: true},
+		{name: "same tag", header: `"7.1f0c4e9a2b3d5c6e"`, want: true},
+		{name: "weak tag", header: `W/"7.1f0c4e9a2b3d5c6e"`, want: true},
+		{name: "one of several tags", header: `"6.0000000000000000", "7.1f0c4e9a2b3d5c6e"`, want: true},
+		{name: "other representation", header: `"7.0000000000000000"`, want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := conditional(t, fiber.HeaderIfNoneMatch, test.header, func(c *fiber.Ctx) bool { return NotModified(c, `"7.1f0c4e9a2b3d5c6e"`) })
+			if got != test.want {
+				t.Errorf("NotModified(%q) = %v, want %v", test.header, got, test.want)
+			}
+		})
+	}
+}
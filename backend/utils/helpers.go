@@ -3,6 +3,7 @@ package utils
 import (
 	"errors"
 	"fmt"
+	"regexp"
 	"strings"
 	"unicode"
 
@@ -53,6 +54,13 @@ func GenerateCUID() string {
 	return cuid.New()
 }
 
+var cuidPattern = regexp.MustCompile(`^c[0-9a-z]{24}$`)
+
+// IsCUID reports whether an ID has the format of the IDs generated by GenerateCUID
+func IsCUID(id string) bool {
+	return cuidPattern.MatchString(id)
+}
+
 func ErrString(err error) string {
 	if err != nil {
 		return err.Error()
@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+const defaultIdempotencyRetentionHours = 24
+
+// IdempotencyRetention returns how long the responses to requests sent with an
+// Idempotency-Key are kept for replays, from IDEMPOTENCY_RETENTION_HOURS (24 hours by
+// default)
+func IdempotencyRetention() time.Duration {
+	hours, err := strconv.Atoi(os.Getenv("IDEMPOTENCY_RETENTION_HOURS"))
+	if err != nil || hours <= 0 {
+		hours = defaultIdempotencyRetentionHours
+	}
+	return time.Duration(hours) * time.Hour
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"errors"
+	"regexp"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidID = errors.New("id must be a CUID, an upper case ULID or a lower case UUIDv7")
+	ErrIDInUse   = errors.New("id is already in use")
+)
+
+var (
+	ulidPattern   = regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+	uuidV7Pattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+)
+
+// IsClientID reports whether an ID generated by a client for a new record has a valid
+// format, so that the client can reference the record before the server has seen it.
+// CUIDs, ULIDs and UUIDv7s are accepted, as they are unique without coordination, in
+// canonical form: ULIDs in upper case and UUIDs in lower case.
+func IsClientID(id string) bool {
+	return IsCUID(id) || ulidPattern.MatchString(id) || uuidV7Pattern.MatchString(id)
+}
+
+// CheckNewID checks that a client-generated ID is valid and that no record of the model
+// uses it, including records in the trash
+func CheckNewID(db *gorm.DB, model interface{}, id string) error {
+	if !IsClientID(id) {
+		return ErrInvalidID
+	}
+
+	var count int64
+	if err := db.Unscoped().Model(model).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrIDInUse
+	}
+
+	return nil
+}
@@ -0,0 +1,191 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // Register decoders for image.Decode
+	"image/jpeg"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Largest width or height accepted for uploaded images, to guard against decompression bombs
+const maxImageDimension = 8000
+
+var ErrUnsupportedImage = errors.New("unsupported image format, expected jpeg, png, gif or webp")
+
+// ResizeSquareImages decodes an uploaded image and renders a square JPEG variant for every
+// size in sizes (in pixels). The image is centre-cropped to a square and its EXIF
+// orientation applied. Re-encoding drops all metadata, including EXIF location data.
+func ResizeSquareImages(data []byte, sizes []int) (map[int][]byte, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	if config.Width > maxImageDimension || config.Height > maxImageDimension {
+		return nil, fmt.Errorf("image is too large, maximum dimensions are %dx%d", maxImageDimension, maxImageDimension)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	if format == "jpeg" {
+		src = applyOrientation(src, jpegOrientation(data))
+	}
+
+	src = cropToSquare(src)
+
+	variants := make(map[int][]byte, len(sizes))
+	for _, size := range sizes {
+		dst := image.NewRGBA(image.Rect(0, 0, size, size))
+
+		// Flatten transparent images onto white, JPEG has no alpha channel
+		draw.Draw(dst, dst.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Over, nil)
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85}); err != nil {
+			return nil, fmt.Errorf("failed to encode image: %w", err)
+		}
+		variants[size] = buf.Bytes()
+	}
+
+	return variants, nil
+}
+
+func cropToSquare(src image.Image) image.Image {
+	bounds := src.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+
+	x := bounds.Min.X + (bounds.Dx()-side)/2
+	y := bounds.Min.Y + (bounds.Dy()-side)/2
+
+	dst := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(dst, dst.Bounds(), src, image.Point{X: x, Y: y}, draw.Src)
+
+	return dst
+}
+
+// applyOrientation rotates/flips an image according to its EXIF orientation (1-8)
+func applyOrientation(src image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// Orientations 5-8 swap the width and height
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // Rotated 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // Mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // Mirrored horizontally, rotated 270 clockwise
+				dx, dy = y, x
+			case 6: // Rotated 90 clockwise
+				dx, dy = h-1-y, x
+			case 7: // Mirrored horizontally, rotated 90 clockwise
+				dx, dy = h-1-y, w-1-x
+			case 8: // Rotated 270 clockwise
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, src.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+
+	return dst
+}
+
+// jpegOrientation reads the EXIF orientation tag of a JPEG file, returning 1 (normal)
+// when the file has no EXIF data or it cannot be parsed
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	offset := 2
+	for offset+4 <= len(data) {
+		if data[offset] != 0xFF {
+			return 1
+		}
+
+		marker := data[offset+1]
+		segmentLength := int(binary.BigEndian.Uint16(data[offset+2:]))
+		segmentStart := offset + 4
+		segmentEnd := offset + 2 + segmentLength
+
+		if segmentLength < 2 || segmentEnd > len(data) {
+			return 1
+		}
+
+		// APP1 segment holding EXIF data
+		if marker == 0xE1 && segmentEnd-segmentStart > 6 && string(data[segmentStart:segmentStart+6]) == "Exif\x00\x00" {
+			return tiffOrientation(data[segmentStart+6 : segmentEnd])
+		}
+
+		// Start of scan, no metadata segments follow
+		if marker == 0xDA {
+			return 1
+		}
+
+		offset = segmentEnd
+	}
+
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifdOffset := int(order.Uint32(tiff[4:]))
+	if ifdOffset+2 > len(tiff) {
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[ifdOffset:]))
+	for i := 0; i < entries; i++ {
+		entry := ifdOffset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+
+	return 1
+}
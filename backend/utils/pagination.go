@@ -0,0 +1,38 @@
+package utils
+
+import "github.com/gofiber/fiber/v2"
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// Pagination holds the page/limit query parameters of a paginated request
+type Pagination struct {
+	Page   int `json:"page"`
+	Limit  int `json:"limit"`
+	Offset int `json:"-"`
+}
+
+// GetPagination reads the "page" and "limit" query parameters, falling back to the
+// first page and DefaultPageLimit. The limit is capped at MaxPageLimit.
+func GetPagination(c *fiber.Ctx) Pagination {
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+
+	limit := c.QueryInt("limit", DefaultPageLimit)
+	if limit < 1 {
+		limit = DefaultPageLimit
+	}
+	if limit > MaxPageLimit {
+		limit = MaxPageLimit
+	}
+
+	return Pagination{
+		Page:   page,
+		Limit:  limit,
+		Offset: (page - 1) * limit,
+	}
+}
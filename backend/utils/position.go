@@ -0,0 +1,330 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Position keys implement fractional indexing: every key sorts between its neighbours
+// byte-wise, so moving an item only rewrites that item's key. A key is an "integer
+// part" whose length is encoded by its first character ('a'-'z' for positive lengths,
+// 'A'-'Z' for negative ones) followed by an optional fraction without trailing zeros.
+// Appending at the end increments the integer part, which keeps keys short.
+//
+// Keys must be compared byte-wise, e.g. with the "C" collation in Postgres.
+
+const positionDigits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// FirstPosition is the key given to the first item of an empty collection
+const FirstPosition = "a0"
+
+var (
+	ErrInvalidPosition = errors.New("invalid position key")
+
+	smallestInteger = "A" + strings.Repeat("0", 26)
+)
+
+// PositionBetween returns a key that sorts strictly between a and b. An empty a means
+// "before b" and an empty b means "after a"; with both empty it returns the first key.
+func PositionBetween(a string, b string) (string, error) {
+	if a != "" {
+		if err := validatePosition(a); err != nil {
+			return "", err
+		}
+	}
+
+	if b != "" {
+		if err := validatePosition(b); err != nil {
+			return "", err
+		}
+	}
+
+	if a != "" && b != "" && a >= b {
+		return "", fmt.Errorf("%w: %q is not before %q", ErrInvalidPosition, a, b)
+	}
+
+	if a == "" {
+		if b == "" {
+			return FirstPosition, nil
+		}
+
+		ib := integerPart(b)
+		fb := b[len(ib):]
+
+		if ib == smallestInteger {
+			return ib + midpoint("", fb, false), nil
+		}
+
+		if ib < b {
+			return ib, nil
+		}
+
+		decremented, ok := decrementInteger(ib)
+		if !ok {
+			return "", fmt.Errorf("%w: cannot position before %q", ErrInvalidPosition, b)
+		}
+		return decremented, nil
+	}
+
+	ia := integerPart(a)
+	fa := a[len(ia):]
+
+	if b == "" {
+		incremented, ok := incrementInteger(ia)
+		if !ok {
+			return ia + midpoint(fa, "", true), nil
+		}
+		return incremented, nil
+	}
+
+	ib := integerPart(b)
+	fb := b[len(ib):]
+
+	if ia == ib {
+		return ia + midpoint(fa, fb, false), nil
+	}
+
+	incremented, ok := incrementInteger(ia)
+	if !ok {
+		return "", fmt.Errorf("%w: cannot position after %q", ErrInvalidPosition, a)
+	}
+
+	if incremented < b {
+		return incremented, nil
+	}
+
+	return ia + midpoint(fa, "", true), nil
+}
+
+// PositionsBetween returns n ordered keys between a and b, spread evenly so that
+// bulk assignments (e.g. backfilling existing rows) produce short keys.
+func PositionsBetween(a string, b string, n int) ([]string, error) {
+	if n <= 0 {
+		return []string{}, nil
+	}
+
+	if n == 1 {
+		key, err := PositionBetween(a, b)
+		if err != nil {
+			return nil, err
+		}
+		return []string{key}, nil
+	}
+
+	if b == "" {
+		keys := make([]string, 0, n)
+		current := a
+		for i := 0; i < n; i++ {
+			key, err := PositionBetween(current, "")
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+			current = key
+		}
+		return keys, nil
+	}
+
+	if a == "" {
+		keys := make([]string, n)
+		current := b
+		for i := n - 1; i >= 0; i-- {
+			key, err := PositionBetween("", current)
+			if err != nil {
+				return nil, err
+			}
+			keys[i] = key
+			current = key
+		}
+		return keys, nil
+	}
+
+	mid := n / 2
+	middle, err := PositionBetween(a, b)
+	if err != nil {
+		return nil, err
+	}
+
+	before, err := PositionsBetween(a, middle, mid)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := PositionsBetween(middle, b, n-mid-1)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := append(before, middle)
+	return append(keys, after...), nil
+}
+
+// midpoint returns a fraction between the fractions a and b. An unbounded b (noUpperBound)
+// means "anything after a".
+func midpoint(a string, b string, noUpperBound bool) string {
+	zero := positionDigits[0]
+
+	if !noUpperBound {
+		// Skip the common prefix
+		n := 0
+		for n < len(b) && digitAt(a, n, zero) == b[n] {
+			n++
+		}
+
+		if n > 0 {
+			rest := ""
+			if n < len(a) {
+				rest = a[n:]
+			}
+			return b[:n] + midpoint(rest, b[n:], false)
+		}
+	}
+
+	digitA := 0
+	if a != "" {
+		digitA = strings.IndexByte(positionDigits, a[0])
+	}
+
+	digitB := len(positionDigits)
+	if !noUpperBound {
+		digitB = strings.IndexByte(positionDigits, b[0])
+	}
+
+	if digitB-digitA > 1 {
+		return string(positionDigits[(digitA+digitB+1)/2])
+	}
+
+	// The first digits are consecutive
+	if !noUpperBound && len(b) > 1 {
+		return b[:1]
+	}
+
+	rest := ""
+	if len(a) > 1 {
+		rest = a[1:]
+	}
+	return string(positionDigits[digitA]) + midpoint(rest, "", true)
+}
+
+func digitAt(s string, i int, fallback byte) byte {
+	if i < len(s) {
+		return s[i]
+	}
+	return fallback
+}
+
+func integerLength(head byte) (int, bool) {
+	switch {
+	case head >= 'a' && head <= 'z':
+		return int(head-'a') + 2, true
+	case head >= 'A' && head <= 'Z':
+		return int('Z'-head) + 2, true
+	default:
+		return 0, false
+	}
+}
+
+// integerPart returns the integer part of a key that has already been validated
+func integerPart(key string) string {
+	length, _ := integerLength(key[0])
+	return key[:length]
+}
+
+func validatePosition(key string) error {
+	if key == "" || key == smallestInteger {
+		return fmt.Errorf("%w: %q", ErrInvalidPosition, key)
+	}
+
+	length, ok := integerLength(key[0])
+	if !ok || length > len(key) {
+		return fmt.Errorf("%w: %q", ErrInvalidPosition, key)
+	}
+
+	for i := 1; i < len(key); i++ {
+		if strings.IndexByte(positionDigits, key[i]) < 0 {
+			return fmt.Errorf("%w: %q", ErrInvalidPosition, key)
+		}
+	}
+
+	if len(key) > length && key[len(key)-1] == positionDigits[0] {
+		return fmt.Errorf("%w: %q has a trailing zero", ErrInvalidPosition, key)
+	}
+
+	return nil
+}
+
+func incrementInteger(x string) (string, bool) {
+	head := x[0]
+	digits := []byte(x[1:])
+
+	carry := true
+	for i := len(digits) - 1; carry && i >= 0; i-- {
+		d := strings.IndexByte(positionDigits, digits[i]) + 1
+		if d == len(positionDigits) {
+			digits[i] = positionDigits[0]
+		} else {
+			digits[i] = positionDigits[d]
+			carry = false
+		}
+	}
+
+	if !carry {
+		return string(head) + string(digits), true
+	}
+
+	if head == 'Z' {
+		return "a" + string(positionDigits[0]), true
+	}
+
+	if head == 'z' {
+		return "", false
+	}
+
+	next := head + 1
+	if next > 'a' {
+		digits = append(digits, positionDigits[0])
+	} else {
+		digits = digits[:len(digits)-1]
+	}
+
+	return string(next) + string(digits), true
+}
+
+func decrementInteger(x string) (string, bool) {
+	head := x[0]
+	digits := []byte(x[1:])
+	last := positionDigits[len(positionDigits)-1]
+
+	borrow := true
+	for i := len(digits) - 1; borrow && i >= 0; i-- {
+		d := strings.IndexByte(positionDigits, digits[i]) - 1
+		if d == -1 {
+			digits[i] = last
+		} else {
+			digits[i] = positionDigits[d]
+			borrow = false
+		}
+	}
+
+	if !borrow {
+		return string(head) + string(digits), true
+	}
+
+	if head == 'a' {
+		return "Z" + string(last), true
+	}
+
+	if head == 'A' {
+		return "", false
+	}
+
+	previous := head - 1
+	if previous < 'Z' {
+		digits = append(digits, last)
+	} else {
+		digits = digits[:len(digits)-1]
+	}
+
+	return string(previous) + string(digits), true
+}
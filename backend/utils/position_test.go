@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPositionBetween(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want string
+		err  bool
+	}{
+		{name: "empty bounds", a: "", b: "", want: FirstPosition},
+		{name: "after a key", a: "a0", b: "", want: "a1"},
+		{name: "before a key", a: "", b: "a0", want: "Zz"},
+		{name: "after the last digit", a: "az", b: "", want: "b00"},
+		{name: "before the first digit", a: "", b: "b00", want: "az"},
+		{name: "adjacent keys", a: "a0", b: "a1", want: "a0V"},
+		{name: "adjacent fractions", a: "a0", b: "a0V", want: "a0G"},
+		{name: "between fractions", a: "a0V", b: "a1", want: "a0l"},
+		{name: "consecutive fraction digits", a: "a0G", b: "a0H", want: "a0GV"},
+		{name: "different integer parts", a: "a0", b: "a5", want: "a1"},
+		{name: "equal keys", a: "a0", b: "a0", err: true},
+		{name: "keys out of order", a: "a1", b: "a0", err: true},
+		{name: "integer part too short", a: "b1", b: "", err: true},
+		{name: "trailing zero", a: "a00", b: "", err: true},
+		{name: "invalid head", a: "", b: "!0", err: true},
+		{name: "invalid digit", a: "a0-", b: "", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := PositionBetween(test.a, test.b)
+			if test.err {
+				if !errors.Is(err, ErrInvalidPosition) {
+					t.Fatalf("PositionBetween(%q, %q) = %q, %v, want ErrInvalidPosition", test.a, test.b, got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PositionBetween(%q, %q) error = %v", test.a, test.b, err)
+			}
+			if got != test.want {
+				t.Errorf("PositionBetween(%q, %q) = %q, want %q", test.a, test.b, got, test.want)
+			}
+			checkBetween(t, test.a, got, test.b)
+		})
+	}
+}
+
+func TestPositionBetweenRepeated(t *testing.T) {
+	tests := []struct {
+		name   string
+		next   func(previous string) (string, error)
+		after  bool // Each key sorts after the previous one
+		maxLen int
+	}{
+		{
+			name:   "append",
+			next:   func(previous string) (string, error) { return PositionBetween(previous, "") },
+			after:  true,
+			maxLen: 3,
+		},
+		{
+			name:   "prepend",
+			next:   func(previous string) (string, error) { return PositionBetween("", previous) },
+			maxLen: 3,
+		},
+		{
+			name:   "insert after the first key",
+			next:   func(previous string) (string, error) { return PositionBetween(FirstPosition, previous) },
+			maxLen: 200,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			previous := "a1"
+			for i := 0; i < 1000; i++ {
+				key, err := test.next(previous)
+				if err != nil {
+					t.Fatalf("step %d after %q: %v", i, previous, err)
+				}
+				if err := validatePosition(key); err != nil {
+					t.Fatalf("step %d: %v", i, err)
+				}
+				if (key > previous) != test.after || key == previous {
+					t.Fatalf("step %d: %q is on the wrong side of %q", i, key, previous)
+				}
+				if len(key) > test.maxLen {
+					t.Fatalf("step %d: %q is longer than %d", i, key, test.maxLen)
+				}
+				previous = key
+			}
+		})
+	}
+}
+
+func TestPositionsBetween(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		n    int
+		err  bool
+	}{
+		{name: "none", a: "a0", b: "a1", n: 0},
+		{name: "one", a: "a0", b: "a1", n: 1},
+		{name: "empty bounds", a: "", b: "", n: 10},
+		{name: "after a key", a: "a0", b: "", n: 10},
+		{name: "before a key", a: "", b: "a0", n: 10},
+		{name: "between adjacent keys", a: "a0", b: "a1", n: 100},
+		{name: "keys out of order", a: "a1", b: "a0", n: 3, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keys, err := PositionsBetween(test.a, test.b, test.n)
+			if test.err {
+				if !errors.Is(err, ErrInvalidPosition) {
+					t.Fatalf("PositionsBetween() error = %v, want ErrInvalidPosition", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PositionsBetween() error = %v", err)
+			}
+			if len(keys) != test.n {
+				t.Fatalf("PositionsBetween() returned %d keys, want %d", len(keys), test.n)
+			}
+
+			previous := test.a
+			for _, key := range keys {
+				checkBetween(t, previous, key, test.b)
+				previous = key
+			}
+		})
+	}
+}
+
+// checkBetween fails unless key is a valid key sorting strictly between a and b, where
+// empty bounds are open
+func checkBetween(t *testing.T, a string, key string, b string) {
+	t.Helper()
+
+	if err := validatePosition(key); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if (a != "" && key <= a) || (b != "" && key >= b) {
+		t.Fatalf("%q does not sort between %q and %q", key, a, b)
+	}
+}
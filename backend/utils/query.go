@@ -0,0 +1,265 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidSort   = errors.New("invalid sort parameter")
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidFilter = errors.New("invalid filter parameter")
+)
+
+// SortField is one key of a multi-field sort. Name is the sort key exposed in the API
+// and Column the SQL expression it orders by.
+type SortField struct {
+	Name   string
+	Column string
+	Desc   bool
+}
+
+// ParseSort parses a comma separated "sort" query parameter such as "-priority,end_date",
+// where a leading "-" sorts descending. allowed maps the accepted sort keys to their SQL
+// expressions; fallback is used when the parameter is empty.
+func ParseSort(raw string, allowed map[string]string, fallback string) ([]SortField, error) {
+	if strings.TrimSpace(raw) == "" {
+		raw = fallback
+	}
+
+	fields := []SortField{}
+	seen := make(map[string]bool)
+
+	for _, key := range strings.Split(raw, ",") {
+		key = strings.TrimSpace(key)
+		desc := strings.HasPrefix(key, "-")
+		key = strings.TrimPrefix(key, "-")
+
+		column, ok := allowed[key]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown sort key %q", ErrInvalidSort, key)
+		}
+
+		if seen[key] {
+			return nil, fmt.Errorf("%w: duplicate sort key %q", ErrInvalidSort, key)
+		}
+		seen[key] = true
+
+		fields = append(fields, SortField{Name: key, Column: column, Desc: desc})
+	}
+
+	return fields, nil
+}
+
+// sortSpec is the canonical form of a sort, stored in cursors so a cursor cannot be
+// reused with a different sort
+func sortSpec(fields []SortField) string {
+	keys := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if field.Desc {
+			keys = append(keys, "-"+field.Name)
+		} else {
+			keys = append(keys, field.Name)
+		}
+	}
+	return strings.Join(keys, ",")
+}
+
+// ApplySort orders a query by the sort fields, with the "id" column as the final tie-breaker
+// so the order is total and cursors are stable
+func ApplySort(query *gorm.DB, table string, fields []SortField) *gorm.DB {
+	for _, field := range fields {
+		if field.Desc {
+			query = query.Order(field.Column + " DESC")
+		} else {
+			query = query.Order(field.Column + " ASC")
+		}
+	}
+	return query.Order(table + ".id ASC")
+}
+
+// Cursor marks the position after the last row of a page: the values of the sort
+// fields for that row and its ID. It is sent to clients as an opaque string.
+type Cursor struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+	ID     string        `json:"id"`
+}
+
+// EncodeCursor builds the opaque cursor for the row with the given sort values and ID.
+// Time values are encoded with nanosecond precision.
+func EncodeCursor(fields []SortField, values []interface{}, id string) string {
+	encoded := make([]interface{}, len(values))
+	for i, value := range values {
+		if t, ok := value.(time.Time); ok {
+			encoded[i] = t.UTC().Format(time.RFC3339Nano)
+		} else {
+			encoded[i] = value
+		}
+	}
+
+	data, _ := json.Marshal(Cursor{Sort: sortSpec(fields), Values: encoded, ID: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor decodes a cursor produced by EncodeCursor and checks it was issued for
+// the same sort
+func DecodeCursor(raw string, fields []SortField) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	if cursor.Sort != sortSpec(fields) || len(cursor.Values) != len(fields) || cursor.ID == "" {
+		return nil, fmt.Errorf("%w: cursor does not match the requested sort", ErrInvalidCursor)
+	}
+
+	return &cursor, nil
+}
+
+// ApplyCursor restricts a query sorted with ApplySort to the rows after the cursor. The
+// keyset condition is expanded to (a > x) OR (a = x AND b > y) OR ... so each field can
+// have its own direction.
+func ApplyCursor(query *gorm.DB, table string, fields []SortField, cursor *Cursor) *gorm.DB {
+	if cursor == nil {
+		return query
+	}
+
+	columns := make([]string, 0, len(fields)+1)
+	operators := make([]string, 0, len(fields)+1)
+	for _, field := range fields {
+		columns = append(columns, field.Column)
+		if field.Desc {
+			operators = append(operators, "<")
+		} else {
+			operators = append(operators, ">")
+		}
+	}
+	columns = append(columns, table+".id")
+	operators = append(operators, ">")
+
+	values := append(append([]interface{}{}, cursor.Values...), cursor.ID)
+
+	conditions := make([]string, 0, len(columns))
+	args := []interface{}{}
+	for i := range columns {
+		parts := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			parts = append(parts, columns[j]+" = ?")
+			args = append(args, values[j])
+		}
+		parts = append(parts, columns[i]+" "+operators[i]+" ?")
+		args = append(args, values[i])
+
+		conditions = append(conditions, "("+strings.Join(parts, " AND ")+")")
+	}
+
+	return query.Where(strings.Join(conditions, " OR "), args...)
+}
+
+// CursorPage holds the cursor pagination parameters of a request
+type CursorPage struct {
+	Enabled bool // False when the client asked for neither a limit nor a cursor
+	Limit   int
+	Cursor  *Cursor
+}
+
+// GetCursorPage reads the "limit" and "cursor" query parameters. Pagination is opt-in:
+// without either parameter, Enabled is false and callers return every row.
+func GetCursorPage(c *fiber.Ctx, fields []SortField) (CursorPage, error) {
+	raw := c.Query("cursor")
+	if raw == "" && c.Query("limit") == "" {
+		return CursorPage{}, nil
+	}
+
+	limit := c.QueryInt("limit", DefaultPageLimit)
+	if limit < 1 {
+		limit = DefaultPageLimit
+	}
+	if limit > MaxPageLimit {
+		limit = MaxPageLimit
+	}
+
+	page := CursorPage{Enabled: true, Limit: limit}
+
+	if raw != "" {
+		cursor, err := DecodeCursor(raw, fields)
+		if err != nil {
+			return CursorPage{}, err
+		}
+		page.Cursor = cursor
+	}
+
+	return page, nil
+}
+
+// ParseTimeQuery reads an optional time query parameter, in RFC 3339 or YYYY-MM-DD form.
+// It returns nil when the parameter is absent.
+func ParseTimeQuery(c *fiber.Ctx, key string) (*time.Time, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return nil, nil
+	}
+
+	for _, layout := range []string{time.RFC3339Nano, time.DateOnly} {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return &t, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s must be an RFC 3339 timestamp or a YYYY-MM-DD date", ErrInvalidFilter, key)
+}
+
+// ParseTimeQueryEnd reads an optional time query parameter closing an inclusive range.
+// A YYYY-MM-DD date covers the whole day, so for a date it returns the start of the next
+// day and reports that the returned end is exclusive.
+func ParseTimeQueryEnd(c *fiber.Ctx, key string) (*time.Time, bool, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return nil, false, nil
+	}
+
+	if t, err := time.Parse(time.DateOnly, raw); err == nil {
+		next := t.AddDate(0, 0, 1)
+		return &next, true, nil
+	}
+
+	t, err := ParseTimeQuery(c, key)
+	return t, false, err
+}
+
+// ParseBoolQuery reads an optional boolean query parameter. It returns nil when the
+// parameter is absent.
+func ParseBoolQuery(c *fiber.Ctx, key string) (*bool, error) {
+	switch strings.ToLower(c.Query(key)) {
+	case "":
+		return nil, nil
+	case "true", "1":
+		value := true
+		return &value, nil
+	case "false", "0":
+		value := false
+		return &value, nil
+	default:
+		return nil, fmt.Errorf("%w: %s must be true or false", ErrInvalidFilter, key)
+	}
+}
+
+// LikePattern turns user input into an ILIKE pattern matching it anywhere, escaping the
+// LIKE wildcards
+func LikePattern(text string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + replacer.Replace(text) + "%"
+}
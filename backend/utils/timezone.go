@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	// EMBED THE TIMEZONE DATABASE, CONTAINERS OFTEN SHIP WITHOUT ONE
+	_ "time/tzdata"
+)
+
+var ErrInvalidTimezone = errors.New("invalid timezone")
+
+// LoadTimezone loads a timezone by IANA name, e.g. "Africa/Lusaka"
+func LoadTimezone(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("%w %q", ErrInvalidTimezone, name)
+	}
+
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q", ErrInvalidTimezone, name)
+	}
+	return location, nil
+}
+
+// StartOfDay returns midnight of the day of t, in t's timezone
+func StartOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+const defaultTrashRetentionDays = 30
+
+// TrashRetention returns how long deleted lists and todos stay in the trash before they
+// are purged, from TRASH_RETENTION_DAYS (30 days by default)
+func TrashRetention() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS"))
+	if err != nil || days <= 0 {
+		days = defaultTrashRetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
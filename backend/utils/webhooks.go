@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultWebhookTimeoutSeconds = 10
+	defaultWebhookRetentionDays  = 30
+)
+
+// WebhookTimeout returns how long webhook endpoints have to answer a delivery, from
+// WEBHOOK_TIMEOUT_SECONDS (10 seconds by default)
+func WebhookTimeout() time.Duration {
+	seconds, err := strconv.Atoi(os.Getenv("WEBHOOK_TIMEOUT_SECONDS"))
+	if err != nil || seconds <= 0 {
+		seconds = defaultWebhookTimeoutSeconds
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// WebhookAllowPrivateURLs reports whether webhooks may post to loopback and private
+// network addresses, from WEBHOOK_ALLOW_PRIVATE_URLS. They may not by default, so that
+// webhooks cannot reach services behind the firewall.
+func WebhookAllowPrivateURLs() bool {
+	allow, _ := strconv.ParseBool(os.Getenv("WEBHOOK_ALLOW_PRIVATE_URLS"))
+	return allow
+}
+
+// WebhookDeliveryRetention returns how long the log of finished webhook deliveries is
+// kept, from WEBHOOK_DELIVERY_RETENTION_DAYS (30 days by default)
+func WebhookDeliveryRetention() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("WEBHOOK_DELIVERY_RETENTION_DAYS"))
+	if err != nil || days <= 0 {
+		days = defaultWebhookRetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
@@ -0,0 +1,316 @@
+// Package webhooks sends the deliveries of the group webhooks. Deliveries are written to
+// an outbox table in the transaction of the change they report (see the database
+// package) and sent from there by DeliverDue, with retries and exponential backoff.
+//
+// Each delivery is posted as JSON with the headers:
+//
+//	X-TaskSync-Event:     the activity type, e.g. task_completed
+//	X-TaskSync-Delivery:  the ID of the delivery
+//	X-TaskSync-Timestamp: the time of the attempt, in Unix seconds
+//	X-TaskSync-Signature: "sha256=<hex>", the HMAC-SHA256 of "<timestamp>.<body>" keyed
+//	                      with the secret of the webhook
+//
+// Receivers should check the signature, reject old timestamps to prevent replays, and
+// recognise deliveries sent more than once by the ID of their activity. Deliveries are
+// not ordered, the activity has the time of the change.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/thompsonmanda08/task-sync/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	SecretPrefix = "whsec_"
+	MaxURLLength = 2048
+
+	maxAttempts  = 10 // About four hours of retries
+	firstRetry   = 30 * time.Second
+	maxRetry     = 6 * time.Hour
+	batchSize    = 20
+	responseSize = 1024 // How much of the response body the delivery log keeps
+)
+
+var (
+	ErrInvalidURL     = errors.New("invalid webhook URL")
+	ErrPrivateAddress = errors.New("webhook URLs must not point to loopback or private network addresses")
+)
+
+// A Sender posts webhook deliveries
+type Sender struct {
+	client  *http.Client
+	timeout time.Duration
+}
+
+// NewSender returns a sender waiting up to timeout for each delivery. Unless
+// allowPrivate is set, it refuses to connect to loopback and private network addresses,
+// checked after the host is resolved so DNS cannot be used to get around it, and does
+// not go through the proxy set in the environment.
+func NewSender(timeout time.Duration, allowPrivate bool) *Sender {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isPrivate(ip) {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	if !allowPrivate {
+		// A PROXY FROM THE ENVIRONMENT WOULD BE DIALED INSTEAD OF THE WEBHOOK HOST AND
+		// RESOLVE IT ITSELF, SO DELIVERIES GO DIRECTLY TO THE CHECKED ADDRESS
+		transport.Proxy = nil
+	}
+
+	return &Sender{
+		timeout: timeout,
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			// A REDIRECT IS AN ANSWER OF ITS OWN, ENDPOINTS MUST BE REGISTERED WHERE THEY ARE
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// NewSecret returns a random secret to sign the deliveries of a webhook
+func NewSecret() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return SecretPrefix + hex.EncodeToString(key), nil
+}
+
+// Sign returns the signature of a delivery body sent at a time, as "sha256=<hex>"
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidateURL checks that a webhook URL is an absolute HTTP or HTTPS URL and, unless
+// allowPrivate is set, that it does not name a loopback or private network address.
+// Hosts resolving to such addresses are refused when deliveries are sent.
+func ValidateURL(raw string, allowPrivate bool) error {
+	if len(raw) > MaxURLLength {
+		return fmt.Errorf("%w: longer than %d characters", ErrInvalidURL, MaxURLLength)
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: the scheme must be http or https", ErrInvalidURL)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("%w: the host is missing", ErrInvalidURL)
+	}
+	if u.User != nil {
+		return fmt.Errorf("%w: credentials are not allowed in the URL, use the signature to authenticate deliveries", ErrInvalidURL)
+	}
+
+	if !allowPrivate {
+		host := strings.ToLower(u.Hostname())
+		if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+			return ErrPrivateAddress
+		}
+		if ip := net.ParseIP(host); ip != nil && isPrivate(ip) {
+			return ErrPrivateAddress
+		}
+	}
+
+	return nil
+}
+
+func isPrivate(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+}
+
+// Backoff returns how long to wait before the next attempt of a delivery, after a number
+// of failed attempts: 30 seconds, doubling up to 6 hours
+func Backoff(attempts int) time.Duration {
+	delay := firstRetry
+	for i := 1; i < attempts && delay < maxRetry; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetry)
+}
+
+// DeliverDue sends the deliveries due at the given time, of the active webhooks, and
+// returns how many were delivered. Deliveries are claimed with FOR UPDATE SKIP LOCKED and
+// leased for the time of their attempt, so any number of app instances can run it at
+// once, and a delivery whose instance died is attempted again once its lease ends.
+func (s *Sender) DeliverDue(ctx context.Context, db *gorm.DB, now time.Time) (int, error) {
+	delivered := 0
+
+	for {
+		var deliveries []models.WebhookDelivery
+		err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Table: clause.Table{Name: "webhook_deliveries"}, Options: "SKIP LOCKED"}).
+				Joins("JOIN webhooks ON webhooks.id = webhook_deliveries.webhook_id AND webhooks.active = ?", true).
+				Where("webhook_deliveries.status = ? AND webhook_deliveries.next_attempt_at <= ?", models.DeliveryPending, now).
+				Preload("Webhook").
+				Order("webhook_deliveries.next_attempt_at ASC").
+				Limit(batchSize).
+				Find(&deliveries).Error; err != nil {
+				return err
+			}
+
+			if len(deliveries) == 0 {
+				return nil
+			}
+
+			ids := make([]string, 0, len(deliveries))
+			for _, delivery := range deliveries {
+				ids = append(ids, delivery.ID)
+			}
+
+			// THE LEASE OUTLASTS THE ATTEMPT, WHICH IS MADE OUTSIDE OF THE TRANSACTION
+			return tx.Model(&models.WebhookDelivery{}).Where("id IN ?", ids).
+				Update("next_attempt_at", time.Now().Add(s.timeout+time.Minute)).Error
+		})
+		if err != nil {
+			return delivered, err
+		}
+
+		// A SLOW ENDPOINT DOES NOT HOLD UP THE OTHERS OF THE BATCH
+		var wg sync.WaitGroup
+		results := make([]map[string]interface{}, len(deliveries))
+		for i := range deliveries {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i] = s.attempt(ctx, deliveries[i])
+			}(i)
+		}
+		wg.Wait()
+
+		for i, delivery := range deliveries {
+			if results[i]["status"] == models.DeliveryDelivered {
+				delivered++
+			}
+			if err := db.WithContext(ctx).Model(&delivery).Updates(results[i]).Error; err != nil {
+				return delivered, err
+			}
+		}
+
+		if len(deliveries) < batchSize || ctx.Err() != nil {
+			return delivered, nil
+		}
+	}
+}
+
+// attempt posts a delivery and returns the updates recording its outcome
+func (s *Sender) attempt(ctx context.Context, delivery models.WebhookDelivery) map[string]interface{} {
+	now := time.Now()
+	attempts := delivery.Attempts + 1
+
+	updates := map[string]interface{}{
+		"attempts":        attempts,
+		"last_attempt_at": now,
+		"last_error":      "",
+	}
+
+	status, body, err := s.post(ctx, delivery, now)
+	updates["response_status"] = status
+	updates["response_body"] = body
+
+	if err == nil {
+		updates["status"] = models.DeliveryDelivered
+		updates["delivered_at"] = now
+		updates["next_attempt_at"] = nil
+		return updates
+	}
+
+	updates["last_error"] = err.Error()
+	if attempts >= maxAttempts {
+		updates["status"] = models.DeliveryFailed
+		updates["next_attempt_at"] = nil
+	} else {
+		updates["status"] = models.DeliveryPending
+		updates["next_attempt_at"] = now.Add(Backoff(attempts))
+	}
+	return updates
+}
+
+// post sends a delivery and returns the status and start of the body of the response
+func (s *Sender) post(ctx context.Context, delivery models.WebhookDelivery, now time.Time) (int, string, error) {
+	if delivery.Webhook == nil {
+		return 0, "", errors.New("webhook no longer exists")
+	}
+
+	body := []byte(delivery.Payload)
+	timestamp := now.Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "TaskSync-Webhooks")
+	req.Header.Set("X-TaskSync-Event", delivery.Event)
+	req.Header.Set("X-TaskSync-Delivery", delivery.ID)
+	req.Header.Set("X-TaskSync-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-TaskSync-Signature", Sign(delivery.Webhook.Secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to call webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	start, _ := io.ReadAll(io.LimitReader(resp.Body, responseSize))
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	// POSTGRES TEXT CANNOT HOLD NUL BYTES OR INVALID UTF-8
+	excerpt := strings.ToValidUTF8(strings.ReplaceAll(string(start), "\x00", ""), "")
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, excerpt, fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, excerpt, nil
+}
+
+// PurgeDeliveries deletes the delivered and failed deliveries created before a time,
+// returning how many were deleted
+func PurgeDeliveries(ctx context.Context, db *gorm.DB, before time.Time) (int64, error) {
+	result := db.WithContext(ctx).
+		Where("status IN ? AND created_at < ?", []string{models.DeliveryDelivered, models.DeliveryFailed}, before).
+		Delete(&models.WebhookDelivery{})
+	return result.RowsAffected, result.Error
+}